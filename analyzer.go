@@ -0,0 +1,232 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	analyzer "github.com/rekki/go-query-analyze"
+	norm "github.com/rekki/go-query-analyze/normalize"
+	tokenize "github.com/rekki/go-query-analyze/tokenize"
+)
+
+// AnalyzerBuilder assembles an analyzer and validates it before use
+//
+// Example:
+//  a, err := index.NewAnalyzerBuilder().
+//  	Normalize(index.DefaultNormalizer...).
+//  	IndexTokens(index.AutocompleteIndexTokenizer...).
+//  	SearchTokens(index.DefaultSearchTokenizer...).
+//  	Build()
+type AnalyzerBuilder struct {
+	normalizers []norm.Normalizer
+	search      []tokenize.Tokenizer
+	index       []tokenize.Tokenizer
+}
+
+// NewAnalyzerBuilder creates empty analyzer builder
+func NewAnalyzerBuilder() *AnalyzerBuilder {
+	return &AnalyzerBuilder{}
+}
+
+// Normalize appends normalizers, applied both at index and search time
+func (b *AnalyzerBuilder) Normalize(n ...norm.Normalizer) *AnalyzerBuilder {
+	b.normalizers = append(b.normalizers, n...)
+	return b
+}
+
+// IndexTokens appends index time tokenizers
+func (b *AnalyzerBuilder) IndexTokens(t ...tokenize.Tokenizer) *AnalyzerBuilder {
+	b.index = append(b.index, t...)
+	return b
+}
+
+// SearchTokens appends search time tokenizers
+func (b *AnalyzerBuilder) SearchTokens(t ...tokenize.Tokenizer) *AnalyzerBuilder {
+	b.search = append(b.search, t...)
+	return b
+}
+
+// Build creates the analyzer, or returns error if the pipeline is invalid (see ValidateAnalyzer)
+func (b *AnalyzerBuilder) Build() (*analyzer.Analyzer, error) {
+	problems := []string{}
+	if len(b.index) == 0 {
+		problems = append(problems, "no index tokenizers, nothing would be indexed")
+	}
+	if len(b.search) == 0 {
+		problems = append(problems, "no search tokenizers, nothing would be searched")
+	}
+	for _, t := range b.search {
+		if _, ok := t.(*tokenize.LeftEdge); ok {
+			problems = append(problems, "left edge search tokenizer, every prefix of the query would match")
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, ", "))
+	}
+
+	a := analyzer.NewAnalyzer(b.normalizers, b.search, b.index)
+	if err := ValidateAnalyzer(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// AnalyzerProbe is the text ValidateAnalyzer analyzes to detect mismatched index and search analysis
+var AnalyzerProbe = "Amsterdam University 2019"
+
+// ValidateAnalyzer analyzes AnalyzerProbe at index and search time and returns error when it looks like a misconfiguration:
+//  - the search or the index analysis produces no tokens
+//  - the search analysis produces a token the index analysis does not, so it could never match
+//  - the search analysis produces prefixes of its own tokens (e.g. edge ngrams), so the query would match way too much
+func ValidateAnalyzer(a *analyzer.Analyzer) error {
+	indexed := a.AnalyzeIndex(AnalyzerProbe)
+	searched := a.AnalyzeSearch(AnalyzerProbe)
+
+	problems := []string{}
+	if len(indexed) == 0 {
+		problems = append(problems, "index analysis produces no tokens")
+	}
+	if len(searched) == 0 {
+		problems = append(problems, "search analysis produces no tokens")
+	}
+
+	seen := map[string]bool{}
+	for _, t := range indexed {
+		seen[t] = true
+	}
+	for _, t := range searched {
+		if !seen[t] {
+			problems = append(problems, fmt.Sprintf("search token %q is not produced at index time", t))
+		}
+	}
+
+	for _, t := range searched {
+		for _, other := range searched {
+			if len(t) < len(other) && strings.HasPrefix(other, t) {
+				problems = append(problems, fmt.Sprintf("search token %q is a prefix of %q, the query would over match", t, other))
+				break
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// Analyzers is a perField analyzer configuration
+type Analyzers map[string]*analyzer.Analyzer
+
+// Validate validates every analyzer with ValidateAnalyzer and returns the problems of all invalid fields
+func (a Analyzers) Validate() error {
+	fields := make([]string, 0, len(a))
+	for field := range a {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	problems := []string{}
+	for _, field := range fields {
+		if err := ValidateAnalyzer(a[field]); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", field, err))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Analysis is the index and search time analysis of a text, see ExplainAnalysis
+type Analysis struct {
+	Field string `json:"field"`
+	// Index are the tokens indexed for the text
+	Index []string `json:"index"`
+	// Search are the tokens queried by Terms for the text
+	Search []string `json:"search"`
+	// NotIndexed are the search tokens the index analysis of the same text does not produce, so the text would not find itself
+	NotIndexed []string `json:"not_indexed"`
+	// DocFreq is the number of documents each search token matches in the index
+	DocFreq map[string]int `json:"doc_freq"`
+}
+
+// ExplainAnalysis analyzes the text as the index does when indexing and when searching (with Terms) this field,
+// to verify that the search tokens hit the indexed ones, for example:
+//  a := m.ExplainAnalysis("name", "Amsterdam")
+//  // with AutocompleteAnalyzer: Index [a am ams ... amsterdam], Search [amsterdam]
+func (m *MemOnlyIndex) ExplainAnalysis(field, text string) Analysis {
+	m.RLock()
+	defer m.RUnlock()
+
+	out := Analysis{
+		Field:      field,
+		Index:      m.analyzeIndex(m.analyzerFor(field), text),
+		Search:     m.searchTokensLocked(field, text),
+		NotIndexed: []string{},
+		DocFreq:    map[string]int{},
+	}
+
+	indexed := map[string]bool{}
+	for _, t := range out.Index {
+		indexed[t] = true
+	}
+	for _, t := range out.Search {
+		if !indexed[t] {
+			out.NotIndexed = append(out.NotIndexed, t)
+		}
+		out.DocFreq[t] = len(m.postings.Get(field, t))
+	}
+	return out
+}
+
+// AnalyzeReaderChunk is the number of bytes AnalyzeReader analyzes at once
+var AnalyzeReaderChunk = 64 * 1024
+
+// AnalyzeReader analyzes the text from the reader with the index analysis and calls cb for every token,
+// without reading the whole text in memory, the text is analyzed in chunks of AnalyzeReaderChunk bytes cut at whitespace.
+// Tokenizers combining tokens (e.g. shingles) do not combine tokens across chunks, and a word longer than a chunk is split
+func AnalyzeReader(a *analyzer.Analyzer, r io.Reader, cb func(token string)) error {
+	buf := make([]byte, AnalyzeReaderChunk)
+	pending := 0
+	for {
+		n, err := io.ReadFull(r, buf[pending:])
+		pending += n
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return err
+		}
+
+		cut := pending
+		if !eof {
+			cut = chunkCut(buf[:pending])
+		}
+		for _, t := range a.AnalyzeIndex(string(buf[:cut])) {
+			cb(t)
+		}
+		pending = copy(buf, buf[cut:pending])
+		if eof {
+			return nil
+		}
+	}
+}
+
+// chunkCut returns the position after the last whitespace, or the start of the last rune if there is no whitespace
+func chunkCut(b []byte) int {
+	for i := len(b) - 1; i > 0; i-- {
+		switch b[i] {
+		case ' ', '\t', '\n', '\r':
+			return i + 1
+		}
+	}
+	for i := len(b) - 1; i > 0; i-- {
+		if utf8.RuneStart(b[i]) {
+			return i
+		}
+	}
+	return len(b)
+}
@@ -0,0 +1,166 @@
+package index
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+	analyzer "github.com/rekki/go-query-analyze"
+	tokenize "github.com/rekki/go-query-analyze/tokenize"
+)
+
+func TestValidateAnalyzerPresets(t *testing.T) {
+	for name, a := range map[string]*analyzer.Analyzer{
+		"default":       DefaultAnalyzer,
+		"id":            IDAnalyzer,
+		"soundex":       SoundexAnalyzer,
+		"fuzzy":         FuzzyAnalyzer,
+		"autocomplete":  AutocompleteAnalyzer,
+		"casesensitive": CaseSensitiveAnalyzer,
+		"identifier":    IdentifierAnalyzer,
+		"unicode":       UnicodeAnalyzer,
+	} {
+		if err := ValidateAnalyzer(a); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestAnalyzerBuilder(t *testing.T) {
+	a, err := NewAnalyzerBuilder().
+		Normalize(DefaultNormalizer...).
+		IndexTokens(AutocompleteIndexTokenizer...).
+		SearchTokens(DefaultSearchTokenizer...).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.AnalyzeIndex("ams")) != 3 {
+		t.Fatalf("unexpected tokens %v", a.AnalyzeIndex("ams"))
+	}
+
+	_, err = NewAnalyzerBuilder().
+		Normalize(DefaultNormalizer...).
+		IndexTokens(AutocompleteIndexTokenizer...).
+		SearchTokens(AutocompleteIndexTokenizer...).
+		Build()
+	if err == nil || !strings.Contains(err.Error(), "left edge") {
+		t.Fatalf("expected left edge error, got %v", err)
+	}
+
+	_, err = NewAnalyzerBuilder().Normalize(DefaultNormalizer...).SearchTokens(DefaultSearchTokenizer...).Build()
+	if err == nil || !strings.Contains(err.Error(), "no index tokenizers") {
+		t.Fatalf("expected no index tokenizers error, got %v", err)
+	}
+
+	_, err = NewAnalyzerBuilder().
+		Normalize(DefaultNormalizer...).
+		IndexTokens(SoundexTokenizer...).
+		SearchTokens(tokenize.NewWhitespace()).
+		Build()
+	if err == nil || !strings.Contains(err.Error(), "not produced at index time") {
+		t.Fatalf("expected mismatch error, got %v", err)
+	}
+}
+
+func TestAnalyzersValidate(t *testing.T) {
+	autocompleteEverywhere := analyzer.NewAnalyzer(DefaultNormalizer, AutocompleteIndexTokenizer, AutocompleteIndexTokenizer)
+	perField := Analyzers{
+		"name":         AutocompleteAnalyzer,
+		"name_broken":  autocompleteEverywhere,
+		"name_soundex": SoundexAnalyzer,
+	}
+
+	err := perField.Validate()
+	if err == nil || !strings.HasPrefix(err.Error(), "name_broken: ") || strings.Contains(err.Error(), "soundex") {
+		t.Fatalf("expected name_broken error, got %v", err)
+	}
+
+	invalid := []string{}
+	NewMemOnlyIndex(perField, WithAnalyzerValidation(func(field string, err error) {
+		invalid = append(invalid, field)
+	}))
+	if len(invalid) != 1 || invalid[0] != "name_broken" {
+		t.Fatalf("unexpected invalid fields %v", invalid)
+	}
+}
+
+func TestCaseSensitiveAnalyzer(t *testing.T) {
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"code": CaseSensitiveAnalyzer})
+	m.Index(
+		MapDocument{"code": {"  ABC-12 Café"}},
+		MapDocument{"code": {"abc-12"}},
+	)
+
+	for query, expected := range map[string]int{"ABC-12": 1, "abc-12": 1, "ABC": 0, "Cafe": 1, "cafe": 0} {
+		top := m.TopN(10, iq.Or(m.Terms("code", query)...), nil)
+		if top.Total != expected {
+			t.Fatalf("%s: expected %d got %d", query, expected, top.Total)
+		}
+	}
+}
+
+func TestExplainAnalysis(t *testing.T) {
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"name": AutocompleteAnalyzer, "soundex": analyzer.NewAnalyzer(DefaultNormalizer, DefaultSearchTokenizer, SoundexTokenizer)})
+	m.Index(MapDocument{"name": {"Amsterdam"}, "soundex": {"Amsterdam"}})
+
+	a := m.ExplainAnalysis("name", "Ams")
+	if len(a.Index) != 3 || len(a.Search) != 1 || a.Search[0] != "ams" || len(a.NotIndexed) != 0 || a.DocFreq["ams"] != 1 {
+		t.Fatalf("unexpected analysis %+v", a)
+	}
+
+	a = m.ExplainAnalysis("soundex", "Amsterdam")
+	if len(a.NotIndexed) != 1 || a.NotIndexed[0] != "amsterdam" || a.DocFreq["amsterdam"] != 0 {
+		t.Fatalf("unexpected analysis %+v", a)
+	}
+}
+
+type streamedDocument struct {
+	name string
+	body string
+}
+
+func (d *streamedDocument) IndexableFields() map[string][]string {
+	return map[string][]string{"name": {d.name}}
+}
+
+func (d *streamedDocument) IndexableReaders() map[string]io.Reader {
+	return map[string]io.Reader{"body": strings.NewReader(d.body)}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("broken")
+}
+
+func TestAnalyzeReader(t *testing.T) {
+	defer func(chunk int) { AnalyzeReaderChunk = chunk }(AnalyzeReaderChunk)
+	AnalyzeReaderChunk = 16
+
+	text := strings.Repeat("Amsterdam Café sofia ", 100)
+	expected := DefaultAnalyzer.AnalyzeIndex(text)
+	tokens := []string{}
+	if err := AnalyzeReader(DefaultAnalyzer, strings.NewReader(text), func(t string) { tokens = append(tokens, t) }); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(tokens, " ") != strings.Join(expected, " ") {
+		t.Fatalf("unexpected tokens %v", tokens)
+	}
+
+	if err := AnalyzeReader(DefaultAnalyzer, io.MultiReader(strings.NewReader(text), failingReader{}), func(string) {}); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	m := NewMemOnlyIndex(nil)
+	m.Index(&streamedDocument{name: "a", body: text}, &streamedDocument{name: "b", body: "sofia"})
+	if m.DocFreq("body", "cafe") != 1 || m.DocFreq("body", "sofia") != 2 || m.FieldLength(0, "body") != 300 {
+		t.Fatalf("unexpected postings %d %d %d", m.DocFreq("body", "cafe"), m.DocFreq("body", "sofia"), m.FieldLength(0, "body"))
+	}
+	m.Delete(0)
+	if m.DocFreq("body", "cafe") != 0 || m.DocFreq("body", "sofia") != 1 {
+		t.Fatalf("expected deleted postings")
+	}
+}
@@ -0,0 +1,132 @@
+package index
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithWriteBatching makes concurrent MemOnlyIndex.Index calls arriving within window of each other share one acquisition
+// of the write lock, up to maxBatch documents. The first caller of a batch waits for the window (or until maxBatch
+// documents are queued) and indexes the documents of all callers in the order they arrived, every caller still gets
+// the document ids of its own documents. It trades up to window of latency per Index call for write throughput
+// under heavy concurrent load, IndexOrUpdate and the other write methods are not batched.
+// If indexing the documents of a caller panics, the panic is raised in that caller's goroutine, the other callers of the batch are not affected
+func WithWriteBatching(window time.Duration, maxBatch int) Option {
+	return func(o *options) {
+		o.batchWindow = window
+		o.batchMax = maxBatch
+	}
+}
+
+type writeRequest struct {
+	docs []Document
+	out  []int32
+	// the panic indexing the documents, raised again by submit in the caller's goroutine
+	err  error
+	done chan struct{}
+}
+
+// fail records the recovered panic v as the error of the request
+func (r *writeRequest) fail(v interface{}) {
+	if err, ok := v.(error); ok {
+		r.err = err
+	} else {
+		r.err = fmt.Errorf("%v", v)
+	}
+}
+
+type writeBatcher struct {
+	window time.Duration
+	max    int
+
+	pending []*writeRequest
+	docs    int
+	// signalled when the pending documents reach max
+	full chan struct{}
+	sync.Mutex
+}
+
+func newWriteBatcher(window time.Duration, max int) *writeBatcher {
+	return &writeBatcher{window: window, max: max, full: make(chan struct{}, 1)}
+}
+
+// submit queues the documents and returns their ids once flush indexed the batch they are part of
+func (b *writeBatcher) submit(docs []Document, flush func([]*writeRequest)) []int32 {
+	r := &writeRequest{docs: docs, done: make(chan struct{})}
+
+	b.Lock()
+	b.pending = append(b.pending, r)
+	b.docs += len(docs)
+	leader := len(b.pending) == 1
+	full := b.max > 0 && b.docs >= b.max
+	if !leader && full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	b.Unlock()
+
+	if leader {
+		if !full {
+			timer := time.NewTimer(b.window)
+			select {
+			case <-timer.C:
+			case <-b.full:
+			}
+			timer.Stop()
+		}
+
+		b.Lock()
+		batch := b.pending
+		b.pending = nil
+		b.docs = 0
+		select {
+		case <-b.full:
+		default:
+		}
+		b.Unlock()
+
+		flushAll(batch, flush)
+	}
+
+	<-r.done
+	if r.err != nil {
+		panic(r.err)
+	}
+	return r.out
+}
+
+// flushAll calls flush and releases the callers of the batch even if it panics, the requests it did not finish get the panic
+func flushAll(batch []*writeRequest, flush func([]*writeRequest)) {
+	defer func() {
+		v := recover()
+		for _, r := range batch {
+			if v != nil && r.out == nil && r.err == nil {
+				r.fail(v)
+			}
+			close(r.done)
+		}
+	}()
+	flush(batch)
+}
+
+func (m *MemOnlyIndex) flushBatch(batch []*writeRequest) {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, r := range batch {
+		m.flushRequestLocked(r)
+	}
+}
+
+// flushRequestLocked indexes the documents of one caller, a panic is recorded in the request so the rest of the batch is still indexed
+func (m *MemOnlyIndex) flushRequestLocked(r *writeRequest) {
+	defer func() {
+		if v := recover(); v != nil {
+			r.fail(v)
+		}
+	}()
+	r.out = m.indexAllLocked(r.docs)
+}
@@ -0,0 +1,92 @@
+package index
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteBatching(t *testing.T) {
+	for _, max := range []int{0, 7, 1000} {
+		m := NewMemOnlyIndex(nil, WithWriteBatching(5*time.Millisecond, max))
+
+		dids := make([][]int32, 100)
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				dids[i] = m.Index(MapDocument{"_id": {fmt.Sprintf("%d-a", i)}}, MapDocument{"_id": {fmt.Sprintf("%d-b", i)}})
+			}(i)
+		}
+		wg.Wait()
+
+		for i := range dids {
+			for j, suffix := range []string{"a", "b"} {
+				if id := m.Get(dids[i][j]).IndexableFields()["_id"][0]; id != fmt.Sprintf("%d-%s", i, suffix) {
+					t.Fatalf("max %d: document %d-%s got the document id of %s", max, i, suffix, id)
+				}
+			}
+		}
+
+		if m.forward.size() != 200 || m.GetByID("99-b") == nil {
+			t.Fatalf("max %d: expected 200 documents, got %d", max, m.forward.size())
+		}
+	}
+}
+
+// panickingDocument fails while it is indexed
+type panickingDocument struct{}
+
+func (panickingDocument) IndexableFields() map[string][]string {
+	panic("broken document")
+}
+
+func TestWriteBatchingPanic(t *testing.T) {
+	m := NewMemOnlyIndex(nil, WithWriteBatching(5*time.Millisecond, 0))
+
+	var wg sync.WaitGroup
+	panics := make([]interface{}, 10)
+	dids := make([][]int32, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() {
+				panics[i] = recover()
+			}()
+			if i == 3 {
+				m.Index(panickingDocument{})
+				return
+			}
+			dids[i] = m.Index(MapDocument{"_id": {fmt.Sprintf("%d", i)}})
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("callers of the batch are still waiting")
+	}
+
+	for i := range panics {
+		if i == 3 {
+			if err, ok := panics[i].(error); !ok || err.Error() != "broken document" {
+				t.Fatalf("expected the panic in the failing caller, got %v", panics[i])
+			}
+			continue
+		}
+		if panics[i] != nil || len(dids[i]) != 1 {
+			t.Fatalf("%d: unexpected panic %v", i, panics[i])
+		}
+		if id := m.Get(dids[i][0]).IndexableFields()["_id"][0]; id != fmt.Sprintf("%d", i) {
+			t.Fatalf("%d: got the document id of %s", i, id)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+type bulkMeta struct {
+	ID string `json:"_id"`
+}
+
+// IndexBulk applies Elasticsearch `_bulk` formatted NDJSON to the index
+//
+// Supported actions are "index" (replaces the document with the same _id), "create" (fails if the _id already exists) and "delete".
+// The _id from the action metadata is used as m.IDField, the document line is flattened with FlattenJSON.
+// Processing stops at the first error, actions before it are already applied.
+//
+// Example:
+//  { "index" : { "_id" : "ams" } }
+//  { "name" : "Amsterdam", "country": "NL" }
+//  { "delete" : { "_id" : "sof" } }
+func (m *MemOnlyIndex) IndexBulk(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	lineNo := 0
+	next := func() ([]byte, bool) {
+		for scanner.Scan() {
+			lineNo++
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) > 0 {
+				return line, true
+			}
+		}
+		return nil, false
+	}
+
+	for {
+		line, ok := next()
+		if !ok {
+			break
+		}
+
+		var action map[string]bulkMeta
+		if err := json.Unmarshal(line, &action); err != nil {
+			return fmt.Errorf("line %d: invalid action: %w", lineNo, err)
+		}
+		if len(action) != 1 {
+			return fmt.Errorf("line %d: expected exactly one action, got %d", lineNo, len(action))
+		}
+
+		for name, meta := range action {
+			switch name {
+			case "delete":
+				if meta.ID == "" {
+					return fmt.Errorf("line %d: delete requires _id", lineNo)
+				}
+				m.DeleteByID(meta.ID)
+			case "index", "create":
+				actionLine := lineNo
+				source, ok := next()
+				if !ok {
+					return fmt.Errorf("line %d: %s action without document", actionLine, name)
+				}
+				obj, err := decodeJSONObject(source)
+				if err != nil {
+					return fmt.Errorf("line %d: %w", lineNo, err)
+				}
+
+				doc := FlattenJSON(obj, "", m.IDField)
+				if meta.ID != "" {
+					doc[m.IDField] = []string{meta.ID}
+					if name == "create" && m.GetByID(meta.ID) != nil {
+						return fmt.Errorf("line %d: document with _id %q already exists", actionLine, meta.ID)
+					}
+					m.DeleteByID(meta.ID)
+				}
+				m.Index(doc)
+			default:
+				return fmt.Errorf("line %d: unsupported bulk action %q, supported actions are index, create and delete", lineNo, name)
+			}
+		}
+	}
+
+	return scanner.Err()
+}
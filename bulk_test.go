@@ -0,0 +1,41 @@
+package index
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIndexBulk(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+
+	input := `{ "index" : { "_id" : "ams" } }
+{ "name" : "Amsterdam", "country": "NL" }
+{ "create" : { "_id" : "sof" } }
+{ "name" : "Sofia", "country": "BG" }
+{ "index" : { "_id" : "ams" } }
+{ "name" : "Amsterdam", "country": "NL", "names": ["Mokum"] }
+{ "delete" : { "_id" : "sof" } }
+`
+	err := m.IndexBulk(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.GetByID("sof") != nil {
+		t.Fatal("expected sof to be deleted")
+	}
+	ams := m.GetByID("ams")
+	if ams == nil || ams.IndexableFields()["names"][0] != "Mokum" {
+		t.Fatalf("expected ams to be replaced, got %v", ams)
+	}
+
+	err = m.IndexBulk(strings.NewReader(`{ "update" : { "_id" : "ams" } }` + "\n" + `{ "doc": {} }`))
+	if err == nil || !strings.Contains(err.Error(), `unsupported bulk action "update"`) {
+		t.Fatalf("expected unsupported action error, got %v", err)
+	}
+
+	err = m.IndexBulk(strings.NewReader(`{ "create" : { "_id" : "ams" } }` + "\n" + `{ "name": "x" }`))
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected already exists error, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// DocumentCodec marshals SearchResult with the registered type name of every document, so it can be unmarshalled back
+// into the concrete document types instead of map[string]interface{}, the document itself is marshalled with encoding/json
+//
+// Example:
+//  codec := index.NewDocumentCodec()
+//  codec.Register("city", &ExampleCity{})
+//  data, err := codec.Marshal(m.TopN(10, query, nil))
+//  ...
+//  result, err := codec.Unmarshal(data)
+//  city := result.Hits[0].Document.(*ExampleCity)
+type DocumentCodec struct {
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+}
+
+// NewDocumentCodec creates codec without registered types
+func NewDocumentCodec() *DocumentCodec {
+	return &DocumentCodec{types: map[string]reflect.Type{}, names: map[reflect.Type]string{}}
+}
+
+// Register registers the type of the example document (usually a pointer to a struct) under the name
+func (c *DocumentCodec) Register(name string, example Document) {
+	t := reflect.TypeOf(example)
+	c.types[name] = t
+	c.names[t] = name
+}
+
+type typedHit struct {
+	Score    float32         `json:"score"`
+	ID       int32           `json:"id"`
+	Type     string          `json:"type"`
+	Document json.RawMessage `json:"doc"`
+}
+
+type typedSearchResult struct {
+	Total int        `json:"total"`
+	Hits  []typedHit `json:"hits"`
+}
+
+// Marshal encodes the result with the type name of every document, it returns error for a document of unregistered type
+func (c *DocumentCodec) Marshal(r *SearchResult) ([]byte, error) {
+	out := typedSearchResult{Total: r.Total, Hits: make([]typedHit, len(r.Hits))}
+	for i, h := range r.Hits {
+		name, ok := c.names[reflect.TypeOf(h.Document)]
+		if !ok {
+			return nil, fmt.Errorf("hit %d: unregistered document type %T", i, h.Document)
+		}
+		data, err := json.Marshal(h.Document)
+		if err != nil {
+			return nil, fmt.Errorf("hit %d: %w", i, err)
+		}
+		out.Hits[i] = typedHit{Score: h.Score, ID: h.ID, Type: name, Document: data}
+	}
+	return json.Marshal(out)
+}
+
+// Unmarshal decodes result encoded with Marshal into the registered document types
+func (c *DocumentCodec) Unmarshal(data []byte) (*SearchResult, error) {
+	in := typedSearchResult{}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, err
+	}
+
+	out := &SearchResult{Total: in.Total, Hits: make([]Hit, len(in.Hits))}
+	for i, h := range in.Hits {
+		t, ok := c.types[h.Type]
+		if !ok {
+			return nil, fmt.Errorf("hit %d: unregistered document type %q", i, h.Type)
+		}
+
+		var v reflect.Value
+		if t.Kind() == reflect.Ptr {
+			v = reflect.New(t.Elem())
+		} else {
+			v = reflect.New(t)
+		}
+		if err := json.Unmarshal(h.Document, v.Interface()); err != nil {
+			return nil, fmt.Errorf("hit %d: %w", i, err)
+		}
+		if t.Kind() != reflect.Ptr {
+			v = v.Elem()
+		}
+		out.Hits[i] = Hit{Score: h.Score, ID: h.ID, Document: v.Interface().(Document)}
+	}
+	return out, nil
+}
@@ -0,0 +1,49 @@
+package index
+
+import (
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestDocumentCodec(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{Name: "Amsterdam", Country: "NL"},
+		MapDocument{"name": {"Amsterdam Noord"}},
+	)
+	top := m.TopN(10, iq.Or(m.Terms("name", "amsterdam")...), nil)
+
+	codec := NewDocumentCodec()
+	codec.Register("city", &ExampleCity{})
+	if _, err := codec.Marshal(top); err == nil {
+		t.Fatalf("expected unregistered type error")
+	}
+	codec.Register("map", MapDocument{})
+
+	data, err := codec.Marshal(top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := codec.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Total != 2 || len(decoded.Hits) != 2 || decoded.Hits[0].Score != top.Hits[0].Score {
+		t.Fatalf("unexpected decoded %+v", decoded)
+	}
+	for i, h := range decoded.Hits {
+		switch d := h.Document.(type) {
+		case *ExampleCity:
+			if d.Name != "Amsterdam" || d.Country != "NL" {
+				t.Fatalf("unexpected city %+v", d)
+			}
+		case MapDocument:
+			if d["name"][0] != "Amsterdam Noord" {
+				t.Fatalf("unexpected map document %v", d)
+			}
+		default:
+			t.Fatalf("hit %d: unexpected type %T", i, h.Document)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package index
+
+// Compact renumbers the live documents with consecutive document ids (keeping their order), dropping the slots of the deleted
+// documents from the forward index and the empty posting lists, and returns the mapping of the old to the new document ids
+// of the live documents, so external references can be updated. Queries created before Compact must not be used after it.
+// Compact does nothing and returns nil with UseDocumentID, as the document ids belong to the documents
+func (m *MemOnlyIndex) Compact() map[int32]int32 {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.compactLocked()
+}
+
+// SetAutoCompact makes Delete and DeleteByID Compact the index when the deleted document slots reach ratio of all slots
+// (e.g. 0.5 for 50% deleted), OnCompact is called with the mapping after the index is compacted. 0 disables it
+func (m *MemOnlyIndex) SetAutoCompact(ratio float64) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.autoCompact = ratio
+}
+
+// autoCompactLocked compacts the index if the deleted ratio reached the SetAutoCompact threshold
+func (m *MemOnlyIndex) autoCompactLocked() map[int32]int32 {
+	size := m.forward.size()
+	if m.autoCompact <= 0 || size == 0 || float64(m.deletedSlots)/float64(size) < m.autoCompact {
+		return nil
+	}
+	return m.compactLocked()
+}
+
+// afterDelete calls OnCompact when the delete triggered auto compaction, outside of the lock, so it can use the index
+func (m *MemOnlyIndex) afterDelete(remap map[int32]int32) {
+	if remap != nil && m.OnCompact != nil {
+		m.OnCompact(remap)
+	}
+}
+
+func (m *MemOnlyIndex) compactLocked() map[int32]int32 {
+	if m.UseDocumentID {
+		return nil
+	}
+
+	remap := map[int32]int32{}
+	var forward forwardStore
+	if _, sparse := m.forward.(*sparseForward); sparse {
+		forward = newSparseForward()
+	} else {
+		forward = &denseForward{docs: make([]Document, 0, m.forward.size()-m.deletedSlots)}
+	}
+	m.forward.foreach(func(did int32, d Document) {
+		n := int32(len(remap))
+		remap[did] = n
+		forward.set(n, d)
+	})
+	m.forward = forward
+
+	for _, field := range m.postings.Fields() {
+		remapped := map[string][]int32{}
+		m.postings.Iterate(field, func(t string, postings []int32) {
+			for i, did := range postings {
+				postings[i] = remap[did]
+			}
+			// empty postings remove the term
+			remapped[t] = postings
+		})
+		for t, ps := range remapped {
+			m.postings.Set(field, t, ps)
+		}
+	}
+
+	for key, did := range m.forwardByID {
+		m.forwardByID[key] = remap[did]
+	}
+
+	boosts := make(map[int32]float32, len(m.boosts))
+	for did, boost := range m.boosts {
+		boosts[remap[did]] = boost
+	}
+	m.boosts = boosts
+
+	for field, lengths := range m.fieldLen {
+		remapped := make(map[int32]int32, len(lengths))
+		for did, n := range lengths {
+			remapped[remap[did]] = n
+		}
+		m.fieldLen[field] = remapped
+	}
+
+	for field, docs := range m.fieldBoosts {
+		remapped := make(map[int32]float32, len(docs))
+		for did, boost := range docs {
+			remapped[remap[did]] = boost
+		}
+		m.fieldBoosts[field] = remapped
+	}
+
+	for _, terms := range m.valueMatches {
+		for t, docs := range terms {
+			remapped := make(map[int32]int32, len(docs))
+			for did, n := range docs {
+				remapped[remap[did]] = n
+			}
+			terms[t] = remapped
+		}
+	}
+	if m.valueMatchTerms != nil {
+		valueMatchTerms := make(map[int32]map[string][]string, len(m.valueMatchTerms))
+		for did, fields := range m.valueMatchTerms {
+			valueMatchTerms[remap[did]] = fields
+		}
+		m.valueMatchTerms = valueMatchTerms
+	}
+
+	if m.updatedFields != nil {
+		updatedFields := make(map[int32]map[string][]string, len(m.updatedFields))
+		for did, updated := range m.updatedFields {
+			updatedFields[remap[did]] = updated
+		}
+		m.updatedFields = updatedFields
+	}
+
+	if m.termVectors != nil {
+		termVectors := make(map[int32]map[string]map[string]int, len(m.termVectors))
+		for did, tv := range m.termVectors {
+			termVectors[remap[did]] = tv
+		}
+		m.termVectors = termVectors
+	}
+
+	m.deletedSlots = 0
+	m.generation++
+	return remap
+}
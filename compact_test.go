@@ -0,0 +1,69 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestCompact(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	for i := 0; i < 6; i++ {
+		m.Index(&boostedCity{ExampleCity: ExampleCity{Name: fmt.Sprintf("Amsterdam %d", i), TestID: fmt.Sprintf("id%d", i)}, boost: float32(i + 1)})
+	}
+	m.Delete(0)
+	m.DeleteByID("id3")
+
+	remap := m.Compact()
+	if len(remap) != 4 || remap[1] != 0 || remap[2] != 1 || remap[4] != 2 || remap[5] != 3 {
+		t.Fatalf("unexpected remap %v", remap)
+	}
+	if m.forward.size() != 4 {
+		t.Fatalf("expected 4 slots, got %d", m.forward.size())
+	}
+
+	scores := map[int32]float32{}
+	m.Foreach(iq.Or(m.Terms("name", "amsterdam")...), func(did int32, score float32, doc Document) {
+		scores[did] = score
+	})
+	if len(scores) != 4 || scores[1]/scores[0] != 1.5 {
+		t.Fatalf("expected boosts to follow the documents %v", scores)
+	}
+	if top := m.TopN(1, iq.Or(m.Terms("name", "4")...), nil); top.Total != 1 || top.Hits[0].ID != 2 {
+		t.Fatalf("unexpected postings after compact %+v", top)
+	}
+	if d := m.GetByID("id5"); d == nil || d.(*boostedCity).Name != "Amsterdam 5" {
+		t.Fatalf("unexpected GetByID after compact %v", d)
+	}
+	if m.FieldLength(3, "name") != 2 {
+		t.Fatalf("expected field lengths to follow the documents")
+	}
+}
+
+func TestAutoCompact(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	for i := 0; i < 4; i++ {
+		m.Index(&ExampleCity{Name: "Amsterdam", TestID: fmt.Sprintf("id%d", i)})
+	}
+
+	var got map[int32]int32
+	m.OnCompact = func(remap map[int32]int32) {
+		got = remap
+		// the index is not locked anymore
+		m.Index(&ExampleCity{Name: "Sofia"})
+	}
+	m.SetAutoCompact(0.5)
+
+	m.Delete(1)
+	if got != nil {
+		t.Fatalf("unexpected compaction at 25%%")
+	}
+	m.DeleteByID("id2")
+	if len(got) != 2 || got[0] != 0 || got[3] != 1 {
+		t.Fatalf("unexpected remap %v", got)
+	}
+	if m.forward.size() != 3 || m.GetByID("id3") == nil {
+		t.Fatalf("unexpected index after auto compact %d", m.forward.size())
+	}
+}
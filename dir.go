@@ -2,7 +2,9 @@ package index
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"os"
 	"path"
@@ -33,6 +35,17 @@ func (x *FDCache) Close() {
 	}
 }
 
+// Forget closes the descriptor of the file, if it is open, so the file can be removed
+func (x *FDCache) Forget(fn string) {
+	x.Lock()
+	defer x.Unlock()
+
+	if fd, ok := x.fdCache[fn]; ok {
+		_ = fd.Close()
+		delete(x.fdCache, fn)
+	}
+}
+
 func (x *FDCache) Use(fn string, createFile func(fn string) (*os.File, error), cb func(*os.File) error) error {
 	var err error
 	var ok bool
@@ -89,11 +102,50 @@ type DirIndex struct {
 	root              string
 	fdCache           FileDescriptorCache
 	TotalNumberOfDocs int
-	Lazy              bool
-	DirHash           func(s string) string
+	// Lazy makes all term queries of the index lazy, see NewLazyTermQuery
+	//
+	// Deprecated: the flag is shared by all queries and racy to change while searching, use LazyTerms and NewLazyTermQuery instead
+	Lazy    bool
+	DirHash func(s string) string
+
+	// Strict mode rejects documents whose DocumentID was already indexed,
+	// the seen ids are persisted in root/documents.ids
+	Strict bool
+	seen   map[int32]bool
+
+	// IDField is analyzed with IDAnalyzer (unless configured in perField) and the ids are kept in root/documents.byid,
+	// so the documents can be found and deleted by id, see GetByID and DeleteByID
+	IDField string
+	byID    map[string]int32
+
+	// deleted documents are kept in root/documents.deleted and skipped by Foreach
+	deleted map[int32]bool
+
+	// from WithSchemaMode
+	schema SchemaMode
+	// from WithDefaultAnalyzer, DefaultAnalyzer if nil
+	defaultAnalyzer *analyzer.Analyzer
+
+	// the field files written by PackField
+	packed *packedFields
+	// from WithReadFDCache, nil if disabled
+	reads *readFDCache
+	// the postings appended while readers are open
+	writes *dirWrites
+
+	// the fields recorded in root/schema.json, see WithAnalyzerMismatch
+	fields     map[string]dirSchemaField
+	schemaErr  error
+	schemaLock sync.Mutex
+
+	ProgressReporter
+	sync.RWMutex
 }
 
-func NewDirIndex(root string, fdCache FileDescriptorCache, perField map[string]*analyzer.Analyzer) *DirIndex {
+// ErrDuplicateDocumentID is returned by DirIndex.Index in Strict mode
+var ErrDuplicateDocumentID = errors.New("duplicate document id")
+
+func NewDirIndex(root string, fdCache FileDescriptorCache, perField map[string]*analyzer.Analyzer, opts ...Option) *DirIndex {
 	if perField == nil {
 		perField = map[string]*analyzer.Analyzer{}
 	}
@@ -101,17 +153,37 @@ func NewDirIndex(root string, fdCache FileDescriptorCache, perField map[string]*
 	dh := func(s string) string {
 		return string(s[len(s)-1])
 	}
-	return &DirIndex{TotalNumberOfDocs: 1, root: root, fdCache: fdCache, perField: perField, DirHash: dh}
+	o := newOptions(opts)
+	d := &DirIndex{TotalNumberOfDocs: 1, root: root, fdCache: fdCache, perField: perField, DirHash: dh, IDField: "_id", schema: o.schema, defaultAnalyzer: o.defaultAnalyzer, packed: newPackedFields(root), reads: newReadFDCache(o.readFDs), writes: newDirWrites()}
+	d.loadSchema(o.onAnalyzerMismatch)
+	return d
 }
 
+// DirIndexMaxTermLen is the maximum length in bytes of a term (and field) file name, way below NAME_MAX of the filesystems,
+// longer terms are stored as their prefix followed by a hash of the whole term, and the whole term is written next to
+// the posting file in a file with ".term" suffix. The indexes written before truncated the long terms, the ones
+// with such a term are refused with ErrDirIndexFormat
 var DirIndexMaxTermLen = 64
 
 func termCleanup(s string) string {
 	x := normalizeTools.ReplaceNonAlphanumericWith(s, '_')
-	if len(x) > DirIndexMaxTermLen {
-		return x[:DirIndexMaxTermLen]
+	if len(x) <= DirIndexMaxTermLen {
+		return x
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(x))
+	suffix := fmt.Sprintf("_%016x", h.Sum64())
+	return truncateTerm(x, DirIndexMaxTermLen-len(suffix)) + suffix
+}
+
+// termCleanupLong is termCleanup, and returns the cleaned up full term if it had to be hashed
+func termCleanupLong(s string) (string, string) {
+	t := termCleanup(s)
+	if full := normalizeTools.ReplaceNonAlphanumericWith(s, '_'); full != t {
+		return t, full
 	}
-	return x
+	return t, ""
 }
 
 func (d *DirIndex) add(fn string, docs []int32) error {
@@ -130,65 +202,224 @@ type DocumentWithID interface {
 	DocumentID() int32
 }
 
+func (d *DirIndex) seenFile() string {
+	return path.Join(d.root, "documents.ids")
+}
+
+// checkUniqueLocked loads the seen document ids (if not loaded yet) and validates that none of docs was already indexed
+func (d *DirIndex) checkUniqueLocked(docs []DocumentWithID) ([]int32, error) {
+	if d.seen == nil {
+		postings, err := readPostings(d.seenFile())
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		d.seen = map[int32]bool{}
+		for _, did := range postings {
+			d.seen[did] = true
+		}
+	}
+
+	batch := map[int32]bool{}
+	ids := make([]int32, len(docs))
+	for i, doc := range docs {
+		did := doc.DocumentID()
+		if d.seen[did] || batch[did] {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicateDocumentID, did)
+		}
+		batch[did] = true
+		ids[i] = did
+	}
+	return ids, nil
+}
+
 func (d *DirIndex) Index(docs ...DocumentWithID) error {
+	if err := d.checkSchema(docs); err != nil {
+		return err
+	}
+	if d.Strict {
+		d.Lock()
+		defer d.Unlock()
+
+		ids, err := d.checkUniqueLocked(docs)
+		if err != nil {
+			return err
+		}
+		err = d.index(docs)
+		if err != nil {
+			return err
+		}
+
+		err = d.add(d.seenFile(), ids)
+		if err != nil {
+			return err
+		}
+		for _, did := range ids {
+			d.seen[did] = true
+		}
+		return d.addIDsLocked(docs)
+	}
+
+	// the writers append concurrently, the read lock only keeps PackField from removing the files being appended to
+	d.RLock()
+	err := d.index(docs)
+	d.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	return d.addIDsLocked(docs)
+}
+
+// IndexFuncBatchSize is the number of documents IndexFunc keeps in memory before writing them
+var IndexFuncBatchSize = 10000
+
+// IndexFunc indexes the documents returned by next until it returns false, the documents are written in batches of IndexFuncBatchSize,
+// so the memory stays bounded no matter how many documents there are. If a batch fails the error is returned and the rest is not indexed
+//
+// Example:
+//  scanner := bufio.NewScanner(f)
+//  did := int32(0)
+//  err := d.IndexFunc(func() (index.DocumentWithID, bool) {
+//  	if !scanner.Scan() {
+//  		return nil, false
+//  	}
+//  	did++
+//  	return &ExampleCity{ID: did, Name: scanner.Text()}, true
+//  })
+func (d *DirIndex) IndexFunc(next func() (DocumentWithID, bool)) error {
+	size := IndexFuncBatchSize
+	if size < 1 {
+		size = 1
+	}
+
+	batch := make([]DocumentWithID, 0, size)
+	for {
+		doc, ok := next()
+		if ok {
+			batch = append(batch, doc)
+		}
+		if len(batch) == size || (!ok && len(batch) > 0) {
+			if err := d.Index(batch...); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		if !ok {
+			return nil
+		}
+	}
+}
+
+func (d *DirIndex) index(docs []DocumentWithID) error {
 	var sb strings.Builder
 
 	todo := map[string][]int32{}
+	// hashed posting files with their full terms
+	long := map[string]string{}
+	indexed := map[string]bool{}
 
 	for _, doc := range docs {
 		did := doc.DocumentID()
 
+		add := func(field string, t string) {
+			t, full := termCleanupLong(t)
+			if len(t) == 0 {
+				return
+			}
+
+			sb.WriteString(d.root)
+			sb.WriteRune('/')
+			sb.WriteString(field)
+			sb.WriteRune('/')
+			sb.WriteString(d.DirHash(t))
+			sb.WriteRune('/')
+			sb.WriteString(t)
+
+			s := sb.String()
+			if full != "" {
+				long[s] = full
+			}
+			// the same token can repeat in the document
+			if current := todo[s]; len(current) == 0 || current[len(current)-1] != did {
+				todo[s] = append(current, did)
+			}
+			sb.Reset()
+		}
+
 		fields := doc.IndexableFields()
 		for field, value := range fields {
+			if d.schema == SchemaIgnore && !d.knownField(field) {
+				continue
+			}
 			field = termCleanup(field)
 			if len(field) == 0 {
 				continue
 			}
 
-			analyzer, ok := d.perField[field]
-			if !ok {
-				analyzer = DefaultAnalyzer
-			}
+			indexed[field] = true
+			analyzer := d.analyzerFor(field)
+			// one by one, as MemOnlyIndex
 			for _, v := range value {
-				tokens := analyzer.AnalyzeIndex(v)
-				for _, t := range tokens {
-					t = termCleanup(t)
-					if len(t) == 0 {
-						continue
-					}
-
-					sb.WriteString(d.root)
-					sb.WriteRune('/')
-					sb.WriteString(field)
-					sb.WriteRune('/')
-					sb.WriteString(d.DirHash(t))
-					sb.WriteRune('/')
-					sb.WriteString(t)
-
-					s := sb.String()
-					todo[s] = append(todo[s], did)
-					sb.Reset()
+				for _, t := range analyzer.AnalyzeIndex(v) {
+					add(field, t)
+				}
+			}
+		}
+
+		if rd, ok := doc.(ReaderDocument); ok {
+			for field, r := range rd.IndexableReaders() {
+				if d.schema == SchemaIgnore && !d.knownField(field) {
+					continue
+				}
+				field = termCleanup(field)
+				if len(field) == 0 {
+					continue
+				}
+
+				indexed[field] = true
+				err := AnalyzeReader(d.analyzerFor(field), r, func(t string) {
+					add(field, t)
+				})
+				if err != nil {
+					return fmt.Errorf("%s: %v", field, err)
 				}
 			}
 		}
 	}
 
+	if err := d.recordFields(indexed); err != nil {
+		return err
+	}
+
+	for fn, full := range long {
+		if _, err := os.Stat(fn + ".term"); err == nil {
+			continue
+		}
+		_ = os.MkdirAll(path.Dir(fn), 0700)
+		if err := ioutil.WriteFile(fn+".term", []byte(full), 0600); err != nil {
+			return err
+		}
+	}
+
+	written := int64(0)
 	for t, docs := range todo {
+		// before the append, so no reader sees the postings before it knows to leave them out
+		d.writes.record(path.Clean(t), docs)
 		err := d.add(t, docs)
 		if err != nil {
 			return err
 		}
+		written += int64(len(docs) * 4)
 	}
+	d.report(len(docs), written)
 
 	return nil
 }
 
 func (d *DirIndex) Terms(field string, term string) []iq.Query {
-	analyzer, ok := d.perField[field]
-	if !ok {
-		analyzer = DefaultAnalyzer
-	}
-	tokens := analyzer.AnalyzeSearch(term)
+	tokens := d.analyzerFor(field).AnalyzeSearch(term)
 	queries := []iq.Query{}
 	for _, t := range tokens {
 		queries = append(queries, d.NewTermQuery(field, t))
@@ -196,38 +427,309 @@ func (d *DirIndex) Terms(field string, term string) []iq.Query {
 	return queries
 }
 
-func (d *DirIndex) NewTermQuery(field string, term string) iq.Query {
+// TermsMulti creates query matching any of the values, see MemOnlyIndex.TermsMulti
+func (d *DirIndex) TermsMulti(field string, values []string) iq.Query {
+	queries := []iq.Query{}
+	for _, v := range values {
+		queries = append(queries, iq.And(d.Terms(field, v)...))
+	}
+	return iq.Or(queries...)
+}
+
+// DocFreq returns the number of postings of this (already analyzed) term in the field, read from the size of the term file
+func (d *DirIndex) DocFreq(field string, term string) int {
+	return dirDocFreq(d.root, d.DirHash, d.packed, field, term)
+}
+
+func dirDocFreq(root string, dirHash func(string) string, packed *packedFields, field, term string) int {
+	fn, ok := termFile(root, dirHash, field, term)
+	if !ok {
+		return 0
+	}
+	n := 0
+	if ff, _ := packed.get(termCleanup(field)); ff != nil {
+		n = ff.DocFreq(termCleanup(term))
+	}
+	s, err := os.Stat(fn)
+	if err != nil {
+		return n
+	}
+	return n + int(s.Size()/4)
+}
+
+// termFile is the posting file of the term, false if the field or term are empty after cleanup
+func termFile(root string, dirHash func(string) string, field, term string) (string, bool) {
 	field = termCleanup(field)
 	term = termCleanup(term)
 	if len(field) == 0 || len(term) == 0 {
-		return iq.Term(d.TotalNumberOfDocs, fmt.Sprintf("broken(%s:%s)", field, term), []int32{})
+		return fmt.Sprintf("broken(%s:%s)", field, term), false
+	}
+	return path.Join(root, field, dirHash(term), term), true
+}
+
+// HasTerm returns true if this (already analyzed) term has postings in the field
+func (d *DirIndex) HasTerm(field string, term string) bool {
+	return d.DocFreq(field, term) > 0
+}
+
+func (d *DirIndex) analyzerFor(field string) *analyzer.Analyzer {
+	return fieldAnalyzer(d.perField, d.IDField, d.defaultAnalyzer, field)
+}
+
+// NewTermQuery creates query of the term as indexed, the term is not analyzed (see RawTermQuery)
+func (d *DirIndex) NewTermQuery(field string, term string) iq.Query {
+	return dirTermQuery(d.root, d.DirHash, d.packed, d.reads, d.TotalNumberOfDocs, d.Lazy, field, term)
+}
+
+// RawTermQuery is MemOnlyIndex.RawTermQuery
+func (d *DirIndex) RawTermQuery(field string, exactTerm string) iq.Query {
+	return d.NewTermQuery(field, exactTerm)
+}
+
+// NewLazyTermQuery is NewTermQuery, but the posting file is not read in memory when the query is created,
+// the query keeps the file open and reads the postings from it while it is iterated. The documents and the scores are the same,
+// it only trades a read per posting for constant memory with huge posting lists. The file is closed when the query is exhausted,
+// so it must be iterated to the end (as Foreach does), otherwise the file descriptor leaks
+func (d *DirIndex) NewLazyTermQuery(field string, term string) iq.Query {
+	return dirTermQuery(d.root, d.DirHash, d.packed, d.reads, d.TotalNumberOfDocs, true, field, term)
+}
+
+// LazyTerms is Terms, but creates lazy term queries, see NewLazyTermQuery
+func (d *DirIndex) LazyTerms(field string, term string) []iq.Query {
+	queries := []iq.Query{}
+	for _, t := range d.analyzerFor(field).AnalyzeSearch(term) {
+		queries = append(queries, d.NewLazyTermQuery(field, t))
+	}
+	return queries
+}
+
+func dirTermQuery(root string, dirHash func(string) string, packed *packedFields, reads *readFDCache, totalNumberOfDocs int, lazy bool, field, term string) iq.Query {
+	q, _ := checkedDirTermQuery(root, dirHash, packed, reads, totalNumberOfDocs, lazy, field, term)
+	return q
+}
+
+// checkedDirTermQuery is dirTermQuery returning the errors reading the posting file, a missing file (or field directory)
+// is not an error, the term has no postings. The query is an empty term on error
+func checkedDirTermQuery(root string, dirHash func(string) string, packed *packedFields, reads *readFDCache, totalNumberOfDocs int, lazy bool, field, term string) (iq.Query, error) {
+	fn, ok := termFile(root, dirHash, field, term)
+	if !ok {
+		return iq.Term(totalNumberOfDocs, fn, []int32{}), nil
+	}
+
+	if lazy {
+		ff, err := packed.get(termCleanup(field))
+		if err != nil {
+			return iq.Term(totalNumberOfDocs, fn, []int32{}), err
+		}
+		if ff == nil {
+			// the file is read later, check that it can be
+			if err := checkPostingsFile(fn); err != nil {
+				return iq.Term(totalNumberOfDocs, fn, []int32{}), err
+			}
+			return iq.FileTerm(totalNumberOfDocs, fn), nil
+		}
+	}
+	postings, err := readDirPostings(packed, reads, fn, field, term)
+	if err != nil {
+		return iq.Term(totalNumberOfDocs, fn, []int32{}), err
+	}
+	return iq.Term(totalNumberOfDocs, fn, postings), nil
+}
+
+// readDirPostings reads the postings of the term from the field file of the field (if packed) and from the posting file fn,
+// a missing file is no postings
+func readDirPostings(packed *packedFields, reads *readFDCache, fn string, field, term string) ([]int32, error) {
+	ff, err := packed.get(termCleanup(field))
+	if err != nil {
+		return nil, err
+	}
+	if ff != nil {
+		return readTermPostings(reads, ff, fn, termCleanup(term))
+	}
+	postings, err := readPostingsCached(reads, fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []int32{}, nil
+		}
+		return nil, err
+	}
+	return postings, nil
+}
+
+// checkPostingsFile returns the error opening the posting file, nil if it does not exist
+func checkPostingsFile(fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	s, err := f.Stat()
+	if err != nil {
+		return err
 	}
-	fn := path.Join(d.root, field, d.DirHash(term), term)
+	if s.IsDir() {
+		return fmt.Errorf("%s: is a directory", fn)
+	}
+	return nil
+}
 
-	if d.Lazy {
-		return iq.FileTerm(d.TotalNumberOfDocs, fn)
+// checkedDirTerms analyzes the text with a and creates the term queries, stopping at the first error
+func checkedDirTerms(a *analyzer.Analyzer, text string, newTermQuery func(term string) (iq.Query, error)) ([]iq.Query, error) {
+	queries := []iq.Query{}
+	for _, t := range a.AnalyzeSearch(text) {
+		q, err := newTermQuery(t)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
 	}
+	return queries, nil
+}
+
+// readTermPostings reads the postings of the term from the field file and from its posting file, ff and reads can be nil
+func readTermPostings(reads *readFDCache, ff *FieldFile, fn string, term string) ([]int32, error) {
+	loose, err := readPostingsCached(reads, fn)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if ff == nil {
+		return loose, nil
+	}
+	packed, err := ff.Postings(term)
+	if err != nil {
+		return nil, err
+	}
+	return mergePostings(packed, loose), nil
+}
+
+func readPostings(fn string) ([]int32, error) {
 	data, err := ioutil.ReadFile(fn)
 	if err != nil {
-		return iq.Term(d.TotalNumberOfDocs, fn, []int32{})
+		return nil, err
 	}
 	postings := make([]int32, len(data)/4)
 	for i := 0; i < len(postings); i++ {
 		from := i * 4
 		postings[i] = int32(binary.LittleEndian.Uint32(data[from : from+4]))
 	}
-	return iq.Term(d.TotalNumberOfDocs, fn, postings)
+	return postings, nil
+}
+
+// CheckedTermQuery is NewTermQuery, but returns the error if the posting file can not be read (e.g. permission denied or I/O error)
+// instead of matching nothing. A missing posting file is not an error, the term is just not indexed
+//
+// Example:
+//  q, err := d.CheckedTermQuery("name", "amsterdam")
+//  if err != nil {
+//  	return err // the disk is broken, do not answer with empty results
+//  }
+func (d *DirIndex) CheckedTermQuery(field string, term string) (iq.Query, error) {
+	return checkedDirTermQuery(d.root, d.DirHash, d.packed, d.reads, d.TotalNumberOfDocs, d.Lazy, field, term)
+}
+
+// CheckedTerms is Terms, but returns the first error reading the posting files, see CheckedTermQuery
+func (d *DirIndex) CheckedTerms(field string, term string) ([]iq.Query, error) {
+	return checkedDirTerms(d.analyzerFor(field), term, func(t string) (iq.Query, error) {
+		return d.CheckedTermQuery(field, t)
+	})
+}
+
+// CheckedLazyTermQuery is NewLazyTermQuery, but returns the error if the posting file can not be opened, see CheckedTermQuery
+func (d *DirIndex) CheckedLazyTermQuery(field string, term string) (iq.Query, error) {
+	return checkedDirTermQuery(d.root, d.DirHash, d.packed, d.reads, d.TotalNumberOfDocs, true, field, term)
+}
+
+// CheckedLazyTerms is LazyTerms, but returns the first error opening the posting files, see CheckedTermQuery
+func (d *DirIndex) CheckedLazyTerms(field string, term string) ([]iq.Query, error) {
+	return checkedDirTerms(d.analyzerFor(field), term, func(t string) (iq.Query, error) {
+		return d.CheckedLazyTermQuery(field, t)
+	})
 }
 
 func (d *DirIndex) Close() {
 	d.fdCache.Close()
+	d.packed.close()
+	d.reads.Close()
 }
 
+// Foreach matching document in ascending document id order, deleted documents are skipped
+// The DirIndex does not store the documents, the callback gets the DocumentID() that was passed to Index(),
+// which might be out of range of the caller's own forward list, use ForeachDocument to resolve it safely
 func (d *DirIndex) Foreach(query iq.Query, cb func(int32, float32)) {
+	d.Lock()
+	// if the tombstones can not be read no document is skipped, Delete and DeleteByID return the error
+	_ = d.loadDeletedLocked()
+	deleted := d.deleted
+	d.Unlock()
+
+	foreachLive(query, func(did int32) bool {
+		if len(deleted) == 0 {
+			return false
+		}
+		d.RLock()
+		defer d.RUnlock()
+		return deleted[did]
+	}, cb)
+}
+
+// Scan is Foreach, but guarantees that cb is called in strictly ascending document id order, each document at most once,
+// see MemOnlyIndex.Scan
+func (d *DirIndex) Scan(query iq.Query, cb func(int32, float32)) {
+	last := int32(-1)
+	d.Foreach(query, func(did int32, score float32) {
+		if did <= last {
+			return
+		}
+		last = did
+		cb(did, score)
+	})
+}
+
+func foreachLive(query iq.Query, isDeleted func(int32) bool, cb func(int32, float32)) {
 	for query.Next() != iq.NO_MORE {
 		did := query.GetDocId()
+		if isDeleted(did) {
+			continue
+		}
 		score := query.Score()
 
 		cb(did, score)
 	}
 }
+
+// Forward is a caller owned list of documents, where the position in the list is the DocumentID()
+type Forward []DocumentWithID
+
+// Get returns the document with this id, or nil if the id is out of range
+func (f Forward) Get(did int32) DocumentWithID {
+	if did < 0 || int(did) >= len(f) {
+		return nil
+	}
+	return f[did]
+}
+
+// ForeachDocument resolves every matching document id with get (e.g. Forward.Get) and skips the ones it returns nil for
+//
+// Example:
+//  forward := index.Forward(docs)
+//  d.ForeachDocument(query, forward.Get, func(did int32, score float32, doc index.DocumentWithID) {
+//  	city := doc.(*ExampleCity)
+//  	log.Printf("%v matching with score %f", city, score)
+//  })
+func (d *DirIndex) ForeachDocument(query iq.Query, get func(int32) DocumentWithID, cb func(int32, float32, DocumentWithID)) {
+	d.Foreach(query, resolveDocument(get, cb))
+}
+
+func resolveDocument(get func(int32) DocumentWithID, cb func(int32, float32, DocumentWithID)) func(int32, float32) {
+	return func(did int32, score float32) {
+		doc := get(did)
+		if doc == nil {
+			return
+		}
+		cb(did, score, doc)
+	}
+}
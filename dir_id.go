@@ -0,0 +1,222 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	iq "github.com/rekki/go-query"
+)
+
+func (d *DirIndex) byIDFile() string {
+	return path.Join(d.root, "documents.byid")
+}
+
+func (d *DirIndex) deletedFile() string {
+	return path.Join(d.root, "documents.deleted")
+}
+
+type dirIDRecord struct {
+	ID  string `json:"id"`
+	DID int32  `json:"did"`
+}
+
+// idKey is the key of an id in the byid map, analyzed with the IDField analyzer as in MemOnlyIndex
+func (d *DirIndex) idKey(uuid string) string {
+	return strings.Join(d.analyzerFor(d.IDField).AnalyzeIndex(uuid), " ")
+}
+
+func (d *DirIndex) loadIDsLocked() error {
+	if d.byID != nil {
+		return nil
+	}
+
+	byID := map[string]int32{}
+	f, err := os.Open(d.byIDFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			d.byID = byID
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		var r dirIDRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return fmt.Errorf("%s line %d: %w", d.byIDFile(), lineNo, err)
+		}
+		// the last record of an id wins, as in MemOnlyIndex the last indexed document is found by id
+		byID[r.ID] = r.DID
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	d.byID = byID
+	return nil
+}
+
+func (d *DirIndex) loadDeletedLocked() error {
+	if d.deleted != nil {
+		return nil
+	}
+
+	postings, err := readPostings(d.deletedFile())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	deleted := map[int32]bool{}
+	for _, did := range postings {
+		deleted[did] = true
+	}
+	d.deleted = deleted
+	return nil
+}
+
+func (d *DirIndex) addIDsLocked(docs []DocumentWithID) error {
+	buf := []byte{}
+	records := []dirIDRecord{}
+	for _, doc := range docs {
+		for _, v := range doc.IndexableFields()[d.IDField] {
+			r := dirIDRecord{ID: d.idKey(v), DID: doc.DocumentID()}
+			data, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			buf = append(buf, data...)
+			buf = append(buf, '\n')
+			records = append(records, r)
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := d.loadIDsLocked(); err != nil {
+		return err
+	}
+	fn := d.byIDFile()
+	err := d.fdCache.Use(
+		fn,
+		func(_s string) (*os.File, error) {
+			return os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		}, func(f *os.File) error {
+			_, err := f.Write(buf)
+			return err
+		})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		d.byID[r.ID] = r.DID
+	}
+	return nil
+}
+
+// GetByID returns the document id of the last indexed document with this id in IDField, false if there is none or it was deleted
+func (d *DirIndex) GetByID(uuid string) (int32, bool, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if err := d.loadIDsLocked(); err != nil {
+		return 0, false, err
+	}
+	if err := d.loadDeletedLocked(); err != nil {
+		return 0, false, err
+	}
+	did, ok := d.byID[d.idKey(uuid)]
+	if !ok || d.deleted[did] {
+		return 0, false, nil
+	}
+	return did, true, nil
+}
+
+// Delete marks the document as deleted (a tombstone is appended to root/documents.deleted), Foreach skips it
+// the postings are not changed and the document id stays deleted, index the replacement with a new document id
+func (d *DirIndex) Delete(did int32) error {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.deleteLocked(did)
+}
+
+func (d *DirIndex) deleteLocked(did int32) error {
+	if err := d.loadDeletedLocked(); err != nil {
+		return err
+	}
+	if d.deleted[did] {
+		return nil
+	}
+	if err := d.add(d.deletedFile(), []int32{did}); err != nil {
+		return err
+	}
+	d.deleted[did] = true
+	return nil
+}
+
+// DeleteByID deletes the last indexed document with this id in IDField, if any
+func (d *DirIndex) DeleteByID(uuid string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if err := d.loadIDsLocked(); err != nil {
+		return err
+	}
+	did, ok := d.byID[d.idKey(uuid)]
+	if !ok {
+		return nil
+	}
+	return d.deleteLocked(did)
+}
+
+// DeleteByQuery deletes every document matching the query and returns how many were deleted (the already deleted ones are not counted),
+// the tombstones are appended to root/documents.deleted at once and fsynced before returning
+func (d *DirIndex) DeleteByQuery(query iq.Query) (int, error) {
+	matching := []int32{}
+	d.Foreach(query, func(did int32, score float32) {
+		matching = append(matching, did)
+	})
+
+	d.Lock()
+	defer d.Unlock()
+
+	if err := d.loadDeletedLocked(); err != nil {
+		return 0, err
+	}
+	todo := []int32{}
+	for _, did := range matching {
+		if !d.deleted[did] {
+			todo = append(todo, did)
+		}
+	}
+	if len(todo) == 0 {
+		return 0, nil
+	}
+
+	fn := d.deletedFile()
+	if err := d.add(fn, todo); err != nil {
+		return 0, err
+	}
+	err := d.fdCache.Use(
+		fn,
+		func(_s string) (*os.File, error) {
+			return os.OpenFile(fn, os.O_CREATE|os.O_WRONLY, 0600)
+		}, func(f *os.File) error {
+			return f.Sync()
+		})
+	if err != nil {
+		return 0, err
+	}
+	for _, did := range todo {
+		d.deleted[did] = true
+	}
+	return len(todo), nil
+}
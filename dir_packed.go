@@ -0,0 +1,417 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The field file layout, all numbers little endian:
+//  magic "GQIF", version uint32, number of terms uint32
+//  one entry per term in ascending term order: end of the term in the term blob uint32, offset of the postings in the file uint64, number of postings uint32
+//  the term blob, the terms concatenated
+//  the postings of the terms concatenated, int32 each
+const (
+	fieldFileMagic     = "GQIF"
+	fieldFileVersion   = 1
+	fieldFileEntrySize = 4 + 8 + 4
+)
+
+// ErrInvalidFieldFile is returned by OpenFieldFile for files not written by WriteFieldFile
+var ErrInvalidFieldFile = errors.New("invalid field file")
+
+type fieldFileEntry struct {
+	termEnd uint32
+	offset  uint64
+	count   uint32
+}
+
+// FieldFile is a field file opened for reading, the term dictionary is kept in memory and binary searched,
+// the postings are read from the file on lookup. It is safe for concurrent use
+type FieldFile struct {
+	f       *os.File
+	entries []fieldFileEntry
+	terms   string
+}
+
+// WriteFieldFile writes the postings of a field in the field file format, a sorted term dictionary followed by the posting lists,
+// every posting list must be ascending
+func WriteFieldFile(w io.Writer, postings map[string][]int32) error {
+	terms := make([]string, 0, len(postings))
+	for t := range postings {
+		terms = append(terms, t)
+	}
+	sort.Strings(terms)
+
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 12)
+	copy(header, fieldFileMagic)
+	binary.LittleEndian.PutUint32(header[4:], fieldFileVersion)
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(terms)))
+	bw.Write(header)
+
+	blob := 0
+	for _, t := range terms {
+		blob += len(t)
+	}
+	offset := uint64(len(header) + len(terms)*fieldFileEntrySize + blob)
+	termEnd := uint32(0)
+	entry := make([]byte, fieldFileEntrySize)
+	for _, t := range terms {
+		termEnd += uint32(len(t))
+		binary.LittleEndian.PutUint32(entry, termEnd)
+		binary.LittleEndian.PutUint64(entry[4:], offset)
+		binary.LittleEndian.PutUint32(entry[12:], uint32(len(postings[t])))
+		bw.Write(entry)
+		offset += uint64(len(postings[t]) * 4)
+	}
+	for _, t := range terms {
+		bw.WriteString(t)
+	}
+	did := make([]byte, 4)
+	for _, t := range terms {
+		for _, p := range postings[t] {
+			binary.LittleEndian.PutUint32(did, uint32(p))
+			bw.Write(did)
+		}
+	}
+	return bw.Flush()
+}
+
+// OpenFieldFile opens a file written by WriteFieldFile and reads its term dictionary
+func OpenFieldFile(fn string) (*FieldFile, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	ff, err := readFieldFile(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return ff, nil
+}
+
+func readFieldFile(f *os.File) (*FieldFile, error) {
+	br := bufio.NewReader(f)
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, ErrInvalidFieldFile
+	}
+	if string(header[:4]) != fieldFileMagic || binary.LittleEndian.Uint32(header[4:]) != fieldFileVersion {
+		return nil, ErrInvalidFieldFile
+	}
+
+	n := int(binary.LittleEndian.Uint32(header[8:]))
+	entries := make([]fieldFileEntry, n)
+	entry := make([]byte, fieldFileEntrySize)
+	for i := range entries {
+		if _, err := io.ReadFull(br, entry); err != nil {
+			return nil, ErrInvalidFieldFile
+		}
+		entries[i] = fieldFileEntry{
+			termEnd: binary.LittleEndian.Uint32(entry),
+			offset:  binary.LittleEndian.Uint64(entry[4:]),
+			count:   binary.LittleEndian.Uint32(entry[12:]),
+		}
+	}
+	blob := 0
+	if n > 0 {
+		blob = int(entries[n-1].termEnd)
+	}
+	terms := make([]byte, blob)
+	if _, err := io.ReadFull(br, terms); err != nil {
+		return nil, ErrInvalidFieldFile
+	}
+	return &FieldFile{f: f, entries: entries, terms: string(terms)}, nil
+}
+
+func (ff *FieldFile) term(i int) string {
+	from := uint32(0)
+	if i > 0 {
+		from = ff.entries[i-1].termEnd
+	}
+	return ff.terms[from:ff.entries[i].termEnd]
+}
+
+// find returns the entry of the term, false if it is not in the file
+func (ff *FieldFile) find(term string) (fieldFileEntry, bool) {
+	i := sort.Search(len(ff.entries), func(i int) bool {
+		return ff.term(i) >= term
+	})
+	if i == len(ff.entries) || ff.term(i) != term {
+		return fieldFileEntry{}, false
+	}
+	return ff.entries[i], true
+}
+
+// Len returns the number of terms in the file
+func (ff *FieldFile) Len() int {
+	return len(ff.entries)
+}
+
+// DocFreq returns the number of postings of the term
+func (ff *FieldFile) DocFreq(term string) int {
+	e, _ := ff.find(term)
+	return int(e.count)
+}
+
+// Postings reads the postings of the term, nil if it is not in the file
+func (ff *FieldFile) Postings(term string) ([]int32, error) {
+	e, ok := ff.find(term)
+	if !ok {
+		return nil, nil
+	}
+	data := make([]byte, e.count*4)
+	if _, err := ff.f.ReadAt(data, int64(e.offset)); err != nil {
+		return nil, err
+	}
+	postings := make([]int32, e.count)
+	for i := range postings {
+		postings[i] = int32(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return postings, nil
+}
+
+// Foreach calls cb with every term and its postings in ascending term order
+func (ff *FieldFile) Foreach(cb func(term string, postings []int32)) error {
+	for i := range ff.entries {
+		postings, err := ff.Postings(ff.term(i))
+		if err != nil {
+			return err
+		}
+		cb(ff.term(i), postings)
+	}
+	return nil
+}
+
+// Close closes the file
+func (ff *FieldFile) Close() error {
+	return ff.f.Close()
+}
+
+// packedFields are the field files of a DirIndex, shared with its readers
+type packedFields struct {
+	root  string
+	files map[string]*FieldFile
+	// replaced by PackField, still used by running queries, closed by DirIndex.Close
+	retired []*FieldFile
+	sync.RWMutex
+}
+
+func newPackedFields(root string) *packedFields {
+	return &packedFields{root: root, files: map[string]*FieldFile{}}
+}
+
+// fieldFile is the name of the field file of the (cleaned up) field
+func fieldFile(root string, field string) string {
+	return path.Join(root, field+".field")
+}
+
+// get returns the field file of the (cleaned up) field, nil if the field is not packed
+func (p *packedFields) get(field string) (*FieldFile, error) {
+	p.RLock()
+	ff, ok := p.files[field]
+	p.RUnlock()
+	if ok {
+		return ff, nil
+	}
+
+	ff, err := OpenFieldFile(fieldFile(p.root, field))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if current, ok := p.files[field]; ok {
+		ff.Close()
+		return current, nil
+	}
+	p.files[field] = ff
+	return ff, nil
+}
+
+func (p *packedFields) set(field string, ff *FieldFile) {
+	p.Lock()
+	defer p.Unlock()
+	if current, ok := p.files[field]; ok {
+		p.retired = append(p.retired, current)
+	}
+	p.files[field] = ff
+}
+
+func (p *packedFields) close() {
+	p.Lock()
+	defer p.Unlock()
+	for _, ff := range p.files {
+		ff.Close()
+	}
+	for _, ff := range p.retired {
+		ff.Close()
+	}
+	p.files = map[string]*FieldFile{}
+	p.retired = nil
+}
+
+// mergePostings is the ascending union of two ascending posting lists
+func mergePostings(a, b []int32) []int32 {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	out := make([]int32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var next int32
+		if j == len(b) || (i < len(a) && a[i] <= b[j]) {
+			next = a[i]
+			i++
+		} else {
+			next = b[j]
+			j++
+		}
+		if len(out) == 0 || out[len(out)-1] != next {
+			out = append(out, next)
+		}
+	}
+	return out
+}
+
+// fileForgetter is implemented by FDCache, to close and forget the descriptors of removed files
+type fileForgetter interface {
+	Forget(fn string)
+}
+
+// PackField moves the postings of the field from the per term files into one field file root/<field>.field
+// (a sorted term dictionary followed by the posting lists, see WriteFieldFile), to save the inodes and make backups easy.
+// The term queries read the field file (binary searching its dictionary) and the per term files of the documents indexed later,
+// run PackField again to pack those too. The per term files are removed if the file descriptor cache is FDCache,
+// otherwise they are truncated. The .term files of the hashed long terms are kept, the field file only has their hashed names.
+// The term queries of a packed field read their postings in memory even when lazy. PackField waits for the running Index calls
+//
+// Example:
+//  if err := d.PackField("name"); err != nil {
+//  	panic(err)
+//  }
+func (d *DirIndex) PackField(field string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	field = termCleanup(field)
+	if field == "" {
+		return fmt.Errorf("invalid field %q", field)
+	}
+
+	postings := map[string][]int32{}
+	current, err := d.packed.get(field)
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		if err := current.Foreach(func(t string, p []int32) {
+			postings[t] = p
+		}); err != nil {
+			return err
+		}
+	}
+
+	// the posting files, the .term files of the hashed terms stay
+	loose := []string{}
+	stray := []string{}
+	dir := path.Join(d.root, field)
+	buckets, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, bucket := range buckets {
+		if !bucket.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(path.Join(dir, bucket.Name()))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			fn := path.Join(dir, bucket.Name(), f.Name())
+			if strings.HasSuffix(f.Name(), ".term") {
+				continue
+			}
+			if f.IsDir() {
+				stray = append(stray, fn)
+				continue
+			}
+			loose = append(loose, fn)
+			p, err := readPostings(fn)
+			if err != nil {
+				return err
+			}
+			if len(p) > 0 {
+				postings[f.Name()] = mergePostings(postings[f.Name()], p)
+			}
+		}
+	}
+
+	fn := fieldFile(d.root, field)
+	tmp, err := os.OpenFile(fn+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	err = WriteFieldFile(tmp, postings)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(fn+".tmp", fn); err != nil {
+		return err
+	}
+
+	ff, err := OpenFieldFile(fn)
+	if err != nil {
+		return err
+	}
+	d.packed.set(field, ff)
+
+	forgetter, canRemove := d.fdCache.(fileForgetter)
+	for _, fn := range loose {
+		if !canRemove {
+			if err := os.Truncate(fn, 0); err != nil {
+				return err
+			}
+			continue
+		}
+		forgetter.Forget(fn)
+		if err := d.reads.Remove(fn); err != nil {
+			return err
+		}
+	}
+	if canRemove {
+		for _, fn := range stray {
+			_ = os.RemoveAll(fn)
+		}
+		// only the empty ones, without .term files
+		for _, bucket := range buckets {
+			_ = os.Remove(path.Join(dir, bucket.Name()))
+		}
+		_ = os.Remove(dir)
+	}
+	return nil
+}
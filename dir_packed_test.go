@@ -0,0 +1,207 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestFieldFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fieldfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := path.Join(dir, "name.field")
+	var b bytes.Buffer
+	if err := WriteFieldFile(&b, map[string][]int32{"sofia": {3}, "amsterdam": {1, 2, 9}, "": {4}, "zurich": {}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fn, b.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ff, err := OpenFieldFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ff.Close()
+	if ff.Len() != 4 || ff.DocFreq("amsterdam") != 3 || ff.DocFreq("paris") != 0 {
+		t.Fatalf("unexpected dictionary %d %d", ff.Len(), ff.DocFreq("amsterdam"))
+	}
+	for term, expected := range map[string]string{"amsterdam": "[1 2 9]", "sofia": "[3]", "": "[4]", "zurich": "[]", "paris": "[]"} {
+		postings, err := ff.Postings(term)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%v", postings) != expected {
+			t.Fatalf("%s: expected %s got %v", term, expected, postings)
+		}
+	}
+
+	terms := []string{}
+	if err := ff.Foreach(func(term string, postings []int32) { terms = append(terms, term) }); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(terms, ",") != ",amsterdam,sofia,zurich" {
+		t.Fatalf("unexpected terms %v", terms)
+	}
+
+	if err := ioutil.WriteFile(fn, []byte("GQIF"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFieldFile(fn); !errors.Is(err, ErrInvalidFieldFile) {
+		t.Fatalf("expected invalid field file, got %v", err)
+	}
+}
+
+func TestPackField(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	long := strings.Repeat("x", 2*DirIndexMaxTermLen)
+	d := NewDirIndex(dir, NewFDCache(10), nil)
+	defer d.Close()
+	if err := d.Index(toDocumentsID([]*ExampleCity{
+		{ID: 1, Name: "Amsterdam", Country: "NL"},
+		{ID: 2, Name: "Amsterdam " + long, Country: "US"},
+		{ID: 3, Name: "Sofia", Country: "BG"},
+	})...); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(text string) string {
+		dids := []int32{}
+		d.Foreach(iq.Or(d.Terms("name", text)...), func(did int32, score float32) {
+			dids = append(dids, did)
+		})
+		return fmt.Sprintf("%v", dids)
+	}
+
+	if err := d.PackField("name"); err != nil {
+		t.Fatal(err)
+	}
+	left := []string{}
+	_ = filepath.Walk(path.Join(dir, "name"), func(fn string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			left = append(left, path.Base(fn))
+		}
+		return nil
+	})
+	longFile, _ := termFile(dir, d.DirHash, "name", long)
+	if len(left) != 1 || left[0] != path.Base(longFile)+".term" {
+		t.Fatalf("expected the term files to be removed and the full long term kept, got %v", left)
+	}
+	if full, err := ioutil.ReadFile(longFile + ".term"); err != nil || string(full) != long {
+		t.Fatalf("expected the full long term, got %q %v", full, err)
+	}
+	if _, err := os.Stat(path.Join(dir, "country")); err != nil {
+		t.Fatalf("expected the other fields untouched, got %v", err)
+	}
+	for text, expected := range map[string]string{"amsterdam": "[1 2]", "sofia": "[3]", long: "[2]", "paris": "[]"} {
+		if got := search(text); got != expected {
+			t.Fatalf("%s: expected %s got %s", text, expected, got)
+		}
+	}
+	if d.DocFreq("name", "amsterdam") != 2 {
+		t.Fatalf("unexpected doc freq %d", d.DocFreq("name", "amsterdam"))
+	}
+
+	// indexed after packing, read from the term files until packed again
+	if err := d.Index(toDocumentsID([]*ExampleCity{{ID: 4, Name: "Amsterdam", Country: "NL"}})...); err != nil {
+		t.Fatal(err)
+	}
+	if search("amsterdam") != "[1 2 4]" || d.DocFreq("name", "amsterdam") != 3 {
+		t.Fatalf("unexpected %s", search("amsterdam"))
+	}
+	if err := d.PackField("name"); err != nil {
+		t.Fatal(err)
+	}
+	if search("amsterdam") != "[1 2 4]" {
+		t.Fatalf("unexpected %s", search("amsterdam"))
+	}
+
+	var b bytes.Buffer
+	if err := d.ExportPostings("name", "amsterdam", &b); err != nil || b.String() != "1\n2\n4\n" {
+		t.Fatalf("unexpected export %q %v", b.String(), err)
+	}
+	if err := d.ImportPostings("name", "amsterdam", strings.NewReader("1\n")); err == nil {
+		t.Fatalf("expected packed field error")
+	}
+
+	// a new index on the same root reads the field file
+	other := NewDirIndex(dir, NewFDCache(10), nil)
+	defer other.Close()
+	r, err := other.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	r.Foreach(iq.Or(r.LazyTerms("name", "amsterdam sofia")...), func(did int32, score float32) {
+		n++
+	})
+	if n != 4 {
+		t.Fatalf("expected 4 matches, got %d", n)
+	}
+}
+
+func TestPackFieldWhileIndexing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packed_concurrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDirIndex(dir, NewFDCache(10), nil)
+	defer d.Close()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 750; i += 10 {
+				batch := []*ExampleCity{}
+				for j := i; j < i+10; j++ {
+					batch = append(batch, &ExampleCity{ID: int32(w*750 + j), Name: "Amsterdam"})
+				}
+				if err := d.Index(toDocumentsID(batch)...); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for packing := true; packing; {
+		select {
+		case <-done:
+			packing = false
+		default:
+		}
+		if err := d.PackField("name"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := d.DocFreq("name", "amsterdam"); n != 3000 {
+		t.Fatalf("expected 3000 postings, got %d", n)
+	}
+}
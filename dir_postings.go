@@ -0,0 +1,99 @@
+package index
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	iq "github.com/rekki/go-query"
+)
+
+// ExportPostings writes the document ids of the (already analyzed) term, one per line, so a posting list can be inspected,
+// compared, or transplanted into another index with ImportPostings. This is an advanced API for tooling and debugging
+func (d *DirIndex) ExportPostings(field string, term string, w io.Writer) error {
+	fn, ok := termFile(d.root, d.DirHash, field, term)
+	if !ok {
+		return fmt.Errorf("invalid term %s:%s", field, term)
+	}
+	ff, err := d.packed.get(termCleanup(field))
+	if err != nil {
+		return err
+	}
+	postings, err := readTermPostings(d.reads, ff, fn, termCleanup(term))
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, did := range postings {
+		bw.WriteString(strconv.FormatInt(int64(did), 10))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// ImportPostings replaces the postings of the (already analyzed) term with the document ids read from r, in the ExportPostings format,
+// the ids must be ascending. This is an advanced API for tooling and debugging: the documents are not indexed,
+// only the posting list of this term is overwritten, nothing else (ids, tombstones, other terms) is updated.
+// The field is recorded in root/schema.json as Index does
+func (d *DirIndex) ImportPostings(field string, term string, r io.Reader) error {
+	fn, ok := termFile(d.root, d.DirHash, field, term)
+	if !ok {
+		return fmt.Errorf("invalid term %s:%s", field, term)
+	}
+
+	if ff, err := d.packed.get(termCleanup(field)); err != nil || ff != nil {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("field %s is packed, the postings can not be imported", field)
+	}
+
+	postings := []int32{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		did, err := strconv.ParseInt(line, 10, 32)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if len(postings) > 0 && int32(did) <= postings[len(postings)-1] {
+			return fmt.Errorf("line %d: document id %d is not ascending", lineNo, did)
+		}
+		postings = append(postings, int32(did))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if err := d.recordFields(map[string]bool{termCleanup(field): true}); err != nil {
+		return err
+	}
+	if _, full := termCleanupLong(term); full != "" {
+		if err := ioutil.WriteFile(fn+".term", []byte(full), 0600); err != nil {
+			return err
+		}
+	}
+	return d.fdCache.Use(
+		fn,
+		func(_s string) (*os.File, error) {
+			return os.OpenFile(fn, os.O_CREATE|os.O_WRONLY, 0600)
+		}, func(f *os.File) error {
+			if err := f.Truncate(0); err != nil {
+				return err
+			}
+			return iq.AppendFileTerm(f, postings)
+		})
+}
@@ -0,0 +1,55 @@
+package index
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestExportImportPostings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "postings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := NewDirIndex(dir, NewFDCache(10), nil)
+	list := []*ExampleCity{
+		{ID: 0, Name: "Amsterdam"},
+		{ID: 5, Name: "Amsterdam"},
+		{ID: 7, Name: "Sofia"},
+	}
+	if err := m.Index(toDocumentsID(list)...); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := m.ExportPostings("name", "amsterdam", &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "0\n5\n" {
+		t.Fatalf("unexpected export %q", b.String())
+	}
+
+	if err := m.ImportPostings("name", "sofia", strings.NewReader("3\n9\n")); err != nil {
+		t.Fatal(err)
+	}
+	dids := []int32{}
+	m.Foreach(iq.Or(m.Terms("name", "sofia")...), func(did int32, score float32) {
+		dids = append(dids, did)
+	})
+	if len(dids) != 2 || dids[0] != 3 || dids[1] != 9 {
+		t.Fatalf("unexpected imported postings %v", dids)
+	}
+
+	if err := m.ImportPostings("name", "sofia", strings.NewReader("3\n1\n")); err == nil {
+		t.Fatalf("expected not ascending error")
+	}
+	if err := m.ImportPostings("name", "sofia", strings.NewReader("x\n")); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
@@ -0,0 +1,124 @@
+package index
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+)
+
+// WithReadFDCache makes the DirIndex (and its readers) keep up to n posting files open for reading, so the term queries of hot terms
+// read the postings with one pread instead of open, read and close. The files are read up to their size at the time of the query,
+// AppendFileTerm writes whole postings so a term being indexed is read with the postings appended so far.
+// When the cache is full one descriptor is closed to make room. PackField closes the descriptors of the files it removes,
+// an index sharing the root with another process must not use it, the other process can remove a file while it is open here
+//
+// Example:
+//  d := index.NewDirIndex(root, index.NewFDCache(1000), perField, index.WithReadFDCache(1000))
+func WithReadFDCache(n int) Option {
+	return func(o *options) {
+		o.readFDs = n
+	}
+}
+
+// readFDCache keeps posting files open for reading, the counterpart of FDCache
+type readFDCache struct {
+	files   map[string]*os.File
+	maxOpen int
+	sync.RWMutex
+}
+
+// newReadFDCache returns nil if n is not positive, readPostingsCached reads the files then
+func newReadFDCache(n int) *readFDCache {
+	if n <= 0 {
+		return nil
+	}
+	return &readFDCache{files: map[string]*os.File{}, maxOpen: n}
+}
+
+// readPostingsCached is readPostings, using the open file from the cache if c is not nil
+func readPostingsCached(c *readFDCache, fn string) ([]int32, error) {
+	if c == nil {
+		return readPostings(fn)
+	}
+
+	c.RLock()
+	f, ok := c.files[fn]
+	if ok {
+		defer c.RUnlock()
+		return readPostingsAt(f)
+	}
+	c.RUnlock()
+
+	// opened under the lock, so the file can not be removed (see Remove) between the open and the caching of the descriptor
+	c.Lock()
+	defer c.Unlock()
+	f, ok = c.files[fn]
+	if !ok {
+		var err error
+		f, err = os.Open(fn)
+		if err != nil {
+			return nil, err
+		}
+		if len(c.files) >= c.maxOpen {
+			// evict one, the others stay hot
+			for evicted, fd := range c.files {
+				_ = fd.Close()
+				delete(c.files, evicted)
+				break
+			}
+		}
+		c.files[fn] = f
+	}
+	return readPostingsAt(f)
+}
+
+// readPostingsAt reads the whole postings in the file, ignoring a partially written last one
+func readPostingsAt(f *os.File) ([]int32, error) {
+	s, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, s.Size()/4*4)
+	n, err := f.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// truncated since the stat
+	data = data[:n/4*4]
+
+	postings := make([]int32, len(data)/4)
+	for i := range postings {
+		postings[i] = int32(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return postings, nil
+}
+
+// Remove closes the descriptor of the file, if it is open, and removes the file, holding the lock so no query
+// opens and caches the file being removed
+func (c *readFDCache) Remove(fn string) error {
+	if c == nil {
+		return os.RemoveAll(fn)
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	if fd, ok := c.files[fn]; ok {
+		_ = fd.Close()
+		delete(c.files, fn)
+	}
+	return os.RemoveAll(fn)
+}
+
+func (c *readFDCache) Close() {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	for _, fd := range c.files {
+		_ = fd.Close()
+	}
+	c.files = map[string]*os.File{}
+}
@@ -0,0 +1,123 @@
+package index
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestReadFDCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readfd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDirIndex(dir, NewFDCache(10), nil, WithReadFDCache(2))
+	defer d.Close()
+	index := func(cities ...*ExampleCity) {
+		if err := d.Index(toDocumentsID(cities)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	search := func(text string) string {
+		dids := []int32{}
+		d.Foreach(iq.Or(d.Terms("name", text)...), func(did int32, score float32) {
+			dids = append(dids, did)
+		})
+		return fmt.Sprintf("%v", dids)
+	}
+
+	index(&ExampleCity{ID: 1, Name: "Amsterdam"}, &ExampleCity{ID: 2, Name: "Sofia"})
+	if got := search("amsterdam"); got != "[1]" {
+		t.Fatalf("unexpected %s", got)
+	}
+
+	// appended while its read descriptor is open
+	index(&ExampleCity{ID: 3, Name: "Amsterdam"})
+	if got := search("amsterdam"); got != "[1 3]" {
+		t.Fatalf("expected the appended posting, got %s", got)
+	}
+	if got := search("sofia zurich"); got != "[2]" {
+		t.Fatalf("unexpected %s", got)
+	}
+	if n := len(d.reads.files); n != 2 {
+		t.Fatalf("expected 2 open files, got %d", n)
+	}
+
+	if err := d.PackField("name"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(d.reads.files); n != 0 {
+		t.Fatalf("expected the removed files forgotten, %d open", n)
+	}
+	index(&ExampleCity{ID: 4, Name: "Amsterdam"})
+	if got := search("amsterdam"); got != "[1 3 4]" {
+		t.Fatalf("unexpected %s", got)
+	}
+
+	r, err := d.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	r.Foreach(iq.Or(r.Terms("name", "amsterdam")...), func(did int32, score float32) {
+		n++
+	})
+	if n != 3 {
+		t.Fatalf("expected 3 matches from the reader, got %d", n)
+	}
+}
+
+func TestReadFDCachePackConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readfd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDirIndex(dir, NewFDCache(10), nil, WithReadFDCache(10))
+	defer d.Close()
+	search := func() int {
+		n := 0
+		d.Foreach(iq.Or(d.Terms("name", "amsterdam")...), func(did int32, score float32) {
+			n++
+		})
+		return n
+	}
+
+	for round := int32(0); round < 20; round++ {
+		if err := d.Index(toDocumentsID([]*ExampleCity{{ID: 2 * round, Name: "Amsterdam"}})...); err != nil {
+			t.Fatal(err)
+		}
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					search()
+				}
+			}
+		}()
+		if err := d.PackField("name"); err != nil {
+			t.Fatal(err)
+		}
+		close(stop)
+		<-done
+
+		// written to a new posting file, which must not be hidden by a descriptor of the removed one
+		if err := d.Index(toDocumentsID([]*ExampleCity{{ID: 2*round + 1, Name: "Amsterdam"}})...); err != nil {
+			t.Fatal(err)
+		}
+		if n := search(); n != int(2*round+2) {
+			t.Fatalf("round %d: expected %d matches, got %d", round, 2*round+2, n)
+		}
+	}
+}
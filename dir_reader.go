@@ -0,0 +1,330 @@
+package index
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	iq "github.com/rekki/go-query"
+	analyzer "github.com/rekki/go-query-analyze"
+)
+
+// DirReader is a read only view of a DirIndex (the writer), safe to use from many goroutines while the DirIndex keeps writing.
+// It does not use the file descriptor cache of the writer, the posting files are opened when a term query is created.
+//
+// The reader sees the index as it was when it was created: the ids and the tombstones are copied, and the writer records
+// the postings it appends while readers are open, the term queries and DocFreq of a reader leave out the ones appended after its snapshot
+// (a lazy term query of such a term reads its postings in memory). ImportPostings is not recorded, the readers see the imported postings.
+// Close the reader when done, the writer keeps the appended postings in memory until the readers older than them are closed
+//
+// Example:
+//  r, err := d.Reader()
+//  if err != nil {
+//  	panic(err)
+//  }
+//  defer r.Close()
+//  r.Foreach(iq.Or(r.Terms("name", "amsterdam")...), func(did int32, score float32) {
+//  	log.Printf("%d matching with score %f", did, score)
+//  })
+type DirReader struct {
+	root              string
+	perField          map[string]*analyzer.Analyzer
+	dirHash           func(s string) string
+	packed            *packedFields
+	reads             *readFDCache
+	totalNumberOfDocs int
+	lazy              bool
+	idField           string
+	defaultAnalyzer   *analyzer.Analyzer
+	byID              map[string]int32
+	deleted           map[int32]bool
+	writes            *dirWrites
+	generation        uint64
+	closeOnce         sync.Once
+}
+
+// dirWrites records the postings appended while readers are open, per posting file, so the readers can leave out
+// the ones appended after their snapshot
+type dirWrites struct {
+	generation uint64
+	// open readers per snapshot generation
+	readers  map[uint64]int
+	appended map[string][]dirAppend
+	sync.Mutex
+}
+
+type dirAppend struct {
+	generation uint64
+	docs       []int32
+}
+
+func newDirWrites() *dirWrites {
+	return &dirWrites{readers: map[uint64]int{}, appended: map[string][]dirAppend{}}
+}
+
+// snapshot opens a reader, the postings appended from now on are recorded with a newer generation
+func (w *dirWrites) snapshot() uint64 {
+	w.Lock()
+	defer w.Unlock()
+
+	g := w.generation
+	w.generation++
+	w.readers[g]++
+	return g
+}
+
+func (w *dirWrites) record(fn string, docs []int32) {
+	w.Lock()
+	defer w.Unlock()
+
+	if len(w.readers) == 0 {
+		return
+	}
+	w.appended[fn] = append(w.appended[fn], dirAppend{generation: w.generation, docs: docs})
+}
+
+// release closes the reader of the snapshot and forgets the postings no open reader leaves out
+func (w *dirWrites) release(g uint64) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.readers[g]--
+	if w.readers[g] <= 0 {
+		delete(w.readers, g)
+	}
+	if len(w.readers) == 0 {
+		w.appended = map[string][]dirAppend{}
+		return
+	}
+	oldest, first := uint64(0), true
+	for open := range w.readers {
+		if first || open < oldest {
+			oldest, first = open, false
+		}
+	}
+	for fn, appends := range w.appended {
+		kept := appends[:0]
+		for _, a := range appends {
+			if a.generation > oldest {
+				kept = append(kept, a)
+			}
+		}
+		if len(kept) == 0 {
+			delete(w.appended, fn)
+		} else {
+			w.appended[fn] = kept
+		}
+	}
+}
+
+// after returns how many times each document was appended to fn after the snapshot, nil if none was
+func (w *dirWrites) after(fn string, g uint64) map[int32]int {
+	w.Lock()
+	defer w.Unlock()
+
+	var out map[int32]int
+	for _, a := range w.appended[fn] {
+		if a.generation <= g {
+			continue
+		}
+		if out == nil {
+			out = map[int32]int{}
+		}
+		for _, did := range a.docs {
+			out[did]++
+		}
+	}
+	return out
+}
+
+// withoutPostings removes the appended documents from the end of postings, the Index calls before the snapshot were done
+// when it was taken, so the postings appended after it are the tail of the file
+func withoutPostings(postings []int32, appended map[int32]int) []int32 {
+	end := len(postings)
+	for end > 0 && appended[postings[end-1]] > 0 {
+		appended[postings[end-1]]--
+		end--
+	}
+	return postings[:end]
+}
+
+// Reader snapshots the index in a DirReader, it waits for the running Index calls and copies the ids and the tombstones
+// under the index lock, O(number of documents), the writes wait meanwhile, so reuse a reader instead of creating one per query
+func (d *DirIndex) Reader() (*DirReader, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if errors.Is(d.schemaErr, ErrDirIndexFormat) {
+		return nil, d.schemaErr
+	}
+	if err := d.loadIDsLocked(); err != nil {
+		return nil, err
+	}
+	if err := d.loadDeletedLocked(); err != nil {
+		return nil, err
+	}
+
+	r := &DirReader{
+		root:              d.root,
+		perField:          map[string]*analyzer.Analyzer{},
+		dirHash:           d.DirHash,
+		packed:            d.packed,
+		reads:             d.reads,
+		totalNumberOfDocs: d.TotalNumberOfDocs,
+		lazy:              d.Lazy,
+		idField:           d.IDField,
+		defaultAnalyzer:   d.defaultAnalyzer,
+		byID:              make(map[string]int32, len(d.byID)),
+		deleted:           make(map[int32]bool, len(d.deleted)),
+		writes:            d.writes,
+		generation:        d.writes.snapshot(),
+	}
+	for k, v := range d.perField {
+		r.perField[k] = v
+	}
+	for k, v := range d.byID {
+		r.byID[k] = v
+	}
+	for k, v := range d.deleted {
+		r.deleted[k] = v
+	}
+	return r, nil
+}
+
+func (r *DirReader) analyzerFor(field string) *analyzer.Analyzer {
+	return fieldAnalyzer(r.perField, r.idField, r.defaultAnalyzer, field)
+}
+
+// Terms is DirIndex.Terms
+func (r *DirReader) Terms(field string, term string) []iq.Query {
+	tokens := r.analyzerFor(field).AnalyzeSearch(term)
+	queries := []iq.Query{}
+	for _, t := range tokens {
+		queries = append(queries, r.NewTermQuery(field, t))
+	}
+	return queries
+}
+
+// NewTermQuery is DirIndex.NewTermQuery
+func (r *DirReader) NewTermQuery(field string, term string) iq.Query {
+	q, _ := r.CheckedTermQuery(field, term)
+	return q
+}
+
+// CheckedTermQuery is DirIndex.CheckedTermQuery
+func (r *DirReader) CheckedTermQuery(field string, term string) (iq.Query, error) {
+	return r.checkedTermQuery(field, term, r.lazy)
+}
+
+// checkedTermQuery is checkedDirTermQuery without the postings appended after the snapshot
+func (r *DirReader) checkedTermQuery(field string, term string, lazy bool) (iq.Query, error) {
+	fn, ok := termFile(r.root, r.dirHash, field, term)
+	if !ok {
+		return iq.Term(r.totalNumberOfDocs, fn, []int32{}), nil
+	}
+	// the writers record before they append, so checking after the query has read (or sized) the file
+	// catches every posting it has seen
+	if len(r.writes.after(fn, r.generation)) == 0 {
+		q, err := checkedDirTermQuery(r.root, r.dirHash, r.packed, r.reads, r.totalNumberOfDocs, lazy, field, term)
+		if err != nil || len(r.writes.after(fn, r.generation)) == 0 {
+			return q, err
+		}
+		// closes the file of a lazy query
+		q.Advance(iq.NO_MORE)
+	}
+	postings, err := r.readPostings(fn, field, term)
+	if err != nil {
+		return iq.Term(r.totalNumberOfDocs, fn, []int32{}), err
+	}
+	return iq.Term(r.totalNumberOfDocs, fn, postings), nil
+}
+
+// readPostings reads the postings of the term without the ones appended after the snapshot
+func (r *DirReader) readPostings(fn string, field, term string) ([]int32, error) {
+	postings, err := readDirPostings(r.packed, r.reads, fn, field, term)
+	if err != nil {
+		return nil, err
+	}
+	return withoutPostings(postings, r.writes.after(fn, r.generation)), nil
+}
+
+// CheckedTerms is DirIndex.CheckedTerms
+func (r *DirReader) CheckedTerms(field string, term string) ([]iq.Query, error) {
+	return checkedDirTerms(r.analyzerFor(field), term, func(t string) (iq.Query, error) {
+		return r.CheckedTermQuery(field, t)
+	})
+}
+
+// CheckedLazyTermQuery is DirIndex.CheckedLazyTermQuery
+func (r *DirReader) CheckedLazyTermQuery(field string, term string) (iq.Query, error) {
+	return r.checkedTermQuery(field, term, true)
+}
+
+// CheckedLazyTerms is DirIndex.CheckedLazyTerms
+func (r *DirReader) CheckedLazyTerms(field string, term string) ([]iq.Query, error) {
+	return checkedDirTerms(r.analyzerFor(field), term, func(t string) (iq.Query, error) {
+		return r.CheckedLazyTermQuery(field, t)
+	})
+}
+
+// LazyTerms is DirIndex.LazyTerms
+func (r *DirReader) LazyTerms(field string, term string) []iq.Query {
+	queries := []iq.Query{}
+	for _, t := range r.analyzerFor(field).AnalyzeSearch(term) {
+		q, _ := r.checkedTermQuery(field, t, true)
+		queries = append(queries, q)
+	}
+	return queries
+}
+
+// DocFreq is DirIndex.DocFreq
+func (r *DirReader) DocFreq(field string, term string) int {
+	fn, ok := termFile(r.root, r.dirHash, field, term)
+	if !ok {
+		return 0
+	}
+	if len(r.writes.after(fn, r.generation)) == 0 {
+		n := dirDocFreq(r.root, r.dirHash, r.packed, field, term)
+		if len(r.writes.after(fn, r.generation)) == 0 {
+			return n
+		}
+	}
+	postings, err := r.readPostings(fn, field, term)
+	if err != nil {
+		return 0
+	}
+	return len(postings)
+}
+
+// Close releases the snapshot, the reader can not be used after it
+func (r *DirReader) Close() {
+	r.closeOnce.Do(func() {
+		r.writes.release(r.generation)
+	})
+}
+
+// HasTerm is DirIndex.HasTerm
+func (r *DirReader) HasTerm(field string, term string) bool {
+	return r.DocFreq(field, term) > 0
+}
+
+// GetByID is DirIndex.GetByID as of the snapshot
+func (r *DirReader) GetByID(uuid string) (int32, bool) {
+	did, ok := r.byID[strings.Join(r.analyzerFor(r.idField).AnalyzeIndex(uuid), " ")]
+	if !ok || r.deleted[did] {
+		return 0, false
+	}
+	return did, true
+}
+
+// Foreach matching document, the documents deleted before the snapshot are skipped
+func (r *DirReader) Foreach(query iq.Query, cb func(int32, float32)) {
+	foreachLive(query, func(did int32) bool {
+		return r.deleted[did]
+	}, cb)
+}
+
+// ForeachDocument is DirIndex.ForeachDocument
+func (r *DirReader) ForeachDocument(query iq.Query, get func(int32) DocumentWithID, cb func(int32, float32, DocumentWithID)) {
+	r.Foreach(query, resolveDocument(get, cb))
+}
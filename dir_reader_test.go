@@ -0,0 +1,145 @@
+package index
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestDirReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := NewDirIndex(dir, NewFDCache(10), nil)
+	defer w.Close()
+	err = w.Index(
+		&ExampleCity{ID: 0, TestID: "ams", Name: "Amsterdam", Country: "NL"},
+		&ExampleCity{ID: 1, TestID: "rot", Name: "Rotterdam", Country: "NL"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := w.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.DeleteByID("rot"); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(r *DirReader) int {
+		n := 0
+		r.Foreach(iq.Or(r.Terms("country", "nl")...), func(did int32, score float32) {
+			n++
+		})
+		return n
+	}
+
+	// the snapshot does not see the delete
+	if count(r) != 2 {
+		t.Fatalf("expected 2 got %d", count(r))
+	}
+	if did, ok := r.GetByID("rot"); !ok || did != 1 {
+		t.Fatalf("expected rot in the snapshot")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if i == 0 {
+					if err := w.Index(&ExampleCity{ID: int32(100 + j), Name: "Eindhoven", Country: "NL"}); err != nil {
+						t.Error(err)
+					}
+					continue
+				}
+				if n := count(r); n != 2 {
+					t.Errorf("expected the snapshot, got %d", n)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	r.Close()
+
+	r, err = w.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if count(r) != 51 {
+		t.Fatalf("expected 51 got %d", count(r))
+	}
+	if _, ok := r.GetByID("rot"); ok {
+		t.Fatalf("expected rot to be deleted")
+	}
+}
+
+func TestDirReaderSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reader_snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := NewDirIndex(dir, NewFDCache(10), nil)
+	defer w.Close()
+	if err := w.Index(&ExampleCity{ID: 1, Name: "Amsterdam"}, &ExampleCity{ID: 2, Name: "Amsterdam"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := w.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Index(&ExampleCity{ID: 3, Name: "Amsterdam"}, &ExampleCity{ID: 4, Name: "Sofia"}); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(queries []iq.Query) string {
+		dids := []int32{}
+		r.Foreach(iq.Or(queries...), func(did int32, score float32) {
+			dids = append(dids, did)
+		})
+		return fmt.Sprintf("%v", dids)
+	}
+	check := func(when string) {
+		if got := search(r.Terms("name", "amsterdam sofia")); got != "[1 2]" {
+			t.Fatalf("%s: expected the snapshot, got %s", when, got)
+		}
+		if got := search(r.LazyTerms("name", "amsterdam sofia")); got != "[1 2]" {
+			t.Fatalf("%s: expected the lazy snapshot, got %s", when, got)
+		}
+		if r.DocFreq("name", "amsterdam") != 2 || r.HasTerm("name", "sofia") {
+			t.Fatalf("%s: unexpected doc freq %d", when, r.DocFreq("name", "amsterdam"))
+		}
+	}
+	check("indexed")
+	if err := w.PackField("name"); err != nil {
+		t.Fatal(err)
+	}
+	check("packed")
+
+	r.Close()
+	if len(w.writes.appended) != 0 {
+		t.Fatalf("expected the appended postings forgotten, got %v", w.writes.appended)
+	}
+	r, err = w.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got := search(r.Terms("name", "amsterdam sofia")); got != "[1 2 3 4]" {
+		t.Fatalf("expected everything in a new reader, got %s", got)
+	}
+}
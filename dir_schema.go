@@ -0,0 +1,223 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	analyzer "github.com/rekki/go-query-analyze"
+)
+
+// ErrAnalyzerMismatch is returned (or reported to WithAnalyzerMismatch) when a field of a DirIndex
+// is configured with a different analyzer than the one recorded in root/schema.json when it was indexed
+var ErrAnalyzerMismatch = errors.New("analyzer mismatch")
+
+// ErrDirIndexFormat is returned (or reported to WithAnalyzerMismatch) when root was written in another on-disk layout
+// than this version of DirIndex reads, e.g. before the long terms were hashed (see DirIndexMaxTermLen), rebuild the index
+var ErrDirIndexFormat = errors.New("unsupported dir index format")
+
+// dirIndexFormat is the on-disk layout recorded in root/schema.json:
+//  1 terms longer than DirIndexMaxTermLen truncated, no schema.json, refused only if it has a truncated term
+//  2 terms longer than DirIndexMaxTermLen hashed, the full term in the .term file next to the postings
+const dirIndexFormat = 2
+
+// WithAnalyzerMismatch calls fn for every field recorded in root/schema.json of a DirIndex whose configured analyzer
+// (perField, IDAnalyzer for the IDField or the default analyzer) differs from the one that indexed it, and with field "" if the file can not be read
+// or root is in another format (ErrDirIndexFormat).
+// Without it the mismatches are not reported when the index is opened, fn can panic to refuse the configuration.
+// DirIndex.Index always returns ErrAnalyzerMismatch instead of writing postings of a field with another analyzer,
+// and the error reading root/schema.json instead of overwriting it, Reader returns ErrDirIndexFormat
+//
+// Example:
+//  d := index.NewDirIndex(root, fdCache, perField, index.WithAnalyzerMismatch(func(field string, err error) {
+//  	panic(err)
+//  }))
+func WithAnalyzerMismatch(fn func(field string, err error)) Option {
+	return func(o *options) {
+		o.onAnalyzerMismatch = fn
+	}
+}
+
+// schemaProbe is analyzed to fingerprint an analyzer, it exercises case, accents, punctuation, digits and word boundaries
+const schemaProbe = "  Amsterdam Café, AB-12 sofia_42 ÉCOLE rotterdam. "
+
+type dirSchemaField struct {
+	// Analyzer is the name of the preset, "custom" otherwise, it is informational only
+	Analyzer    string `json:"analyzer"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+type dirSchema struct {
+	// Format is dirIndexFormat, 0 in the files written before it was recorded, when the layout was already 2
+	Format int                       `json:"format,omitempty"`
+	Fields map[string]dirSchemaField `json:"fields"`
+}
+
+var analyzerPresets = map[*analyzer.Analyzer]string{
+	DefaultAnalyzer:           "default",
+	IDAnalyzer:                "id",
+	CaseInsensitiveIDAnalyzer: "caseinsensitiveid",
+	CaseSensitiveAnalyzer:     "casesensitive",
+	IdentifierAnalyzer:        "identifier",
+	UnicodeAnalyzer:           "unicode",
+	SoundexAnalyzer:           "soundex",
+	FuzzyAnalyzer:             "fuzzy",
+	AutocompleteAnalyzer:      "autocomplete",
+}
+
+// schemaField identifies the analyzer by the tokens it makes of schemaProbe, so equivalent analyzers
+// created in different processes have the same fingerprint
+func schemaField(a *analyzer.Analyzer) dirSchemaField {
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(a.AnalyzeIndex(schemaProbe), "\x00")))
+	h.Write([]byte{1})
+	h.Write([]byte(strings.Join(a.AnalyzeSearch(schemaProbe), "\x00")))
+
+	name, ok := analyzerPresets[a]
+	if !ok {
+		name = "custom"
+	}
+	return dirSchemaField{Analyzer: name, Fingerprint: fmt.Sprintf("%016x", h.Sum64())}
+}
+
+func (d *DirIndex) schemaFile() string {
+	return path.Join(d.root, "schema.json")
+}
+
+// loadSchema reads root/schema.json and reports the recorded fields whose configured analyzer changed
+func (d *DirIndex) loadSchema(onMismatch func(field string, err error)) {
+	if onMismatch == nil {
+		onMismatch = func(field string, err error) {}
+	}
+
+	d.fields = map[string]dirSchemaField{}
+	data, err := ioutil.ReadFile(d.schemaFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			d.schemaErr = err
+		} else if fn := d.truncatedTermFile(); fn != "" {
+			// format 1 only differs in the long terms, the next Index records format 2
+			d.schemaErr = fmt.Errorf("%w: %s has no schema.json and the truncated long term %s, written with format 1", ErrDirIndexFormat, d.root, fn)
+		}
+		if d.schemaErr != nil {
+			onMismatch("", d.schemaErr)
+		}
+		return
+	}
+	s := dirSchema{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		d.schemaErr = fmt.Errorf("%s: %w", d.schemaFile(), err)
+		onMismatch("", d.schemaErr)
+		return
+	}
+	if s.Format > dirIndexFormat {
+		d.schemaErr = fmt.Errorf("%w: %s was written with format %d, this version reads %d", ErrDirIndexFormat, d.schemaFile(), s.Format, dirIndexFormat)
+		onMismatch("", d.schemaErr)
+		return
+	}
+
+	fields := []string{}
+	for field, recorded := range s.Fields {
+		d.fields[field] = recorded
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if err := d.checkFieldAnalyzerLocked(field); err != nil {
+			onMismatch(field, err)
+		}
+	}
+}
+
+// truncatedTermFile returns the first posting file named by a term truncated to DirIndexMaxTermLen, "" if there is none.
+// The hashed terms have the same length, but also their .term file
+func (d *DirIndex) truncatedTermFile() string {
+	fields, err := ioutil.ReadDir(d.root)
+	if err != nil {
+		return ""
+	}
+	for _, field := range fields {
+		if !field.IsDir() {
+			continue
+		}
+		buckets, err := ioutil.ReadDir(path.Join(d.root, field.Name()))
+		if err != nil {
+			continue
+		}
+		for _, bucket := range buckets {
+			if !bucket.IsDir() {
+				continue
+			}
+			dir := path.Join(d.root, field.Name(), bucket.Name())
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, f := range files {
+				if f.IsDir() || len(f.Name()) != DirIndexMaxTermLen {
+					continue
+				}
+				fn := path.Join(dir, f.Name())
+				if _, err := os.Stat(fn + ".term"); os.IsNotExist(err) {
+					return fn
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func (d *DirIndex) checkFieldAnalyzerLocked(field string) error {
+	recorded, ok := d.fields[field]
+	if !ok {
+		return nil
+	}
+	current := schemaField(d.analyzerFor(field))
+	if current.Fingerprint != recorded.Fingerprint {
+		return fmt.Errorf("%w: field %q was indexed with %s analyzer (%s), configured %s (%s)", ErrAnalyzerMismatch, field, recorded.Analyzer, recorded.Fingerprint, current.Analyzer, current.Fingerprint)
+	}
+	return nil
+}
+
+// recordFields checks the fields about to be written against root/schema.json and adds the new ones to it
+func (d *DirIndex) recordFields(fields map[string]bool) error {
+	d.schemaLock.Lock()
+	defer d.schemaLock.Unlock()
+
+	if d.schemaErr != nil {
+		return d.schemaErr
+	}
+	for field := range fields {
+		if err := d.checkFieldAnalyzerLocked(field); err != nil {
+			return err
+		}
+	}
+
+	added := false
+	for field := range fields {
+		if _, ok := d.fields[field]; !ok {
+			d.fields[field] = schemaField(d.analyzerFor(field))
+			added = true
+		}
+	}
+	if !added {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(dirSchema{Format: dirIndexFormat, Fields: d.fields}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(d.root, 0700)
+	tmp := d.schemaFile() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.schemaFile())
+}
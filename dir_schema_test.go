@@ -0,0 +1,164 @@
+package index
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	analyzer "github.com/rekki/go-query-analyze"
+)
+
+func TestDirSchemaFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mismatches := map[string]error{}
+	onMismatch := WithAnalyzerMismatch(func(field string, err error) {
+		mismatches[field] = err
+	})
+
+	d := NewDirIndex(dir, NewFDCache(10), map[string]*analyzer.Analyzer{"name": FuzzyAnalyzer}, onMismatch)
+	if err := d.Index(toDocumentsID([]*ExampleCity{{ID: 1, Name: "Amsterdam", Country: "NL"}})...); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+	if _, err := os.Stat(path.Join(dir, "schema.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same analyzers, one of them rebuilt from the same parts
+	fuzzy := analyzer.NewAnalyzer(DefaultNormalizer, FuzzyTokenizer, FuzzyTokenizer)
+	d = NewDirIndex(dir, NewFDCache(10), map[string]*analyzer.Analyzer{"name": fuzzy}, onMismatch)
+	if len(mismatches) != 0 {
+		t.Fatalf("unexpected mismatches %v", mismatches)
+	}
+	if err := d.Index(toDocumentsID([]*ExampleCity{{ID: 2, Name: "Sofia", Country: "BG"}})...); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	d = NewDirIndex(dir, NewFDCache(10), nil, onMismatch)
+	defer d.Close()
+	if len(mismatches) != 1 || !errors.Is(mismatches["name"], ErrAnalyzerMismatch) {
+		t.Fatalf("expected name mismatch, got %v", mismatches)
+	}
+	err = d.Index(toDocumentsID([]*ExampleCity{{ID: 3, Name: "Paris", Country: "FR"}})...)
+	if !errors.Is(err, ErrAnalyzerMismatch) {
+		t.Fatalf("expected mismatch error, got %v", err)
+	}
+	if d.DocFreq("country", "fr") != 0 {
+		t.Fatalf("expected nothing written")
+	}
+
+	// without WithAnalyzerMismatch nothing is reported, Index returns the errors
+	if err := ioutil.WriteFile(path.Join(dir, "schema.json"), []byte("{broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	broken := NewDirIndex(dir, NewFDCache(10), nil)
+	defer broken.Close()
+	if err := broken.Index(toDocumentsID([]*ExampleCity{{ID: 4, Name: "Paris"}})...); err == nil {
+		t.Fatalf("expected the schema error")
+	}
+	if data, _ := ioutil.ReadFile(path.Join(dir, "schema.json")); string(data) != "{broken" {
+		t.Fatalf("expected the schema file untouched, got %s", data)
+	}
+}
+
+func TestDirIndexFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "format")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDirIndex(dir, NewFDCache(10), nil)
+	if err := d.Index(toDocumentsID([]*ExampleCity{{ID: 1, Name: "Amsterdam"}})...); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+	if data, _ := ioutil.ReadFile(path.Join(dir, "schema.json")); !strings.Contains(string(data), `"format": 2`) {
+		t.Fatalf("expected the format recorded, got %s", data)
+	}
+
+	// without schema.json and without long terms the layout is the same
+	if err := os.Remove(path.Join(dir, "schema.json")); err != nil {
+		t.Fatal(err)
+	}
+	var reported error
+	onMismatch := WithAnalyzerMismatch(func(field string, err error) {
+		reported = err
+	})
+	same := NewDirIndex(dir, NewFDCache(10), nil, onMismatch)
+	if err := same.Index(toDocumentsID([]*ExampleCity{{ID: 2, Name: "Sofia"}})...); err != nil || reported != nil {
+		t.Fatalf("unexpected %v %v", err, reported)
+	}
+	same.Close()
+	if data, _ := ioutil.ReadFile(path.Join(dir, "schema.json")); !strings.Contains(string(data), `"format": 2`) {
+		t.Fatalf("expected the format recorded, got %s", data)
+	}
+
+	// a truncated long term without its .term file was written with format 1
+	if err := os.Remove(path.Join(dir, "schema.json")); err != nil {
+		t.Fatal(err)
+	}
+	truncated, _ := termFile(dir, func(s string) string { return "x" }, "name", strings.Repeat("x", DirIndexMaxTermLen))
+	if err := os.MkdirAll(path.Dir(truncated), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(truncated, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := NewDirIndex(dir, NewFDCache(10), nil, onMismatch)
+	defer old.Close()
+	if !errors.Is(reported, ErrDirIndexFormat) {
+		t.Fatalf("expected the format reported, got %v", reported)
+	}
+	if err := old.Index(toDocumentsID([]*ExampleCity{{ID: 3, Name: "Paris"}})...); !errors.Is(err, ErrDirIndexFormat) {
+		t.Fatalf("expected format error, got %v", err)
+	}
+	if _, err := old.Reader(); !errors.Is(err, ErrDirIndexFormat) {
+		t.Fatalf("expected format error, got %v", err)
+	}
+
+	// written by a newer version
+	if err := ioutil.WriteFile(path.Join(dir, "schema.json"), []byte(`{"format": 3, "fields": {}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	newer := NewDirIndex(dir, NewFDCache(10), nil)
+	defer newer.Close()
+	if _, err := newer.Reader(); !errors.Is(err, ErrDirIndexFormat) {
+		t.Fatalf("expected format error, got %v", err)
+	}
+}
+
+func TestDirImportRecordsField(t *testing.T) {
+	dir, err := ioutil.TempDir("", "import_schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDirIndex(dir, NewFDCache(10), nil)
+	if err := d.ImportPostings("name", "amsterdam", strings.NewReader("1\n2\n")); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+	if data, _ := ioutil.ReadFile(path.Join(dir, "schema.json")); !strings.Contains(string(data), `"name"`) {
+		t.Fatalf("expected the field recorded, got %s", data)
+	}
+
+	reopened := NewDirIndex(dir, NewFDCache(10), nil)
+	defer reopened.Close()
+	if err := reopened.Index(toDocumentsID([]*ExampleCity{{ID: 3, Name: "Amsterdam"}})...); err != nil {
+		t.Fatal(err)
+	}
+	if reopened.DocFreq("name", "amsterdam") != 3 {
+		t.Fatalf("unexpected doc freq %d", reopened.DocFreq("name", "amsterdam"))
+	}
+}
@@ -0,0 +1,77 @@
+package index
+
+import (
+	iq "github.com/rekki/go-query"
+)
+
+// FieldBoostedDocument can be implemented by documents whose fields differ in importance, e.g. {"name": 3} makes a name match
+// count 3 times more than a match in the other fields. The boosts are stored at index time (only the ones different than 1) and
+// multiply the score of every term query of the field matching the document, so a field boost scales the idf contribution (and
+// the query boost) of the term for this document only, the document boost (see BoostedDocument) multiplies the total score after that
+type FieldBoostedDocument interface {
+	Document
+	FieldBoosts() map[string]float32
+}
+
+func (m *MemOnlyIndex) addFieldBoosts(d Document, did int32) {
+	fb, ok := d.(FieldBoostedDocument)
+	if !ok {
+		return
+	}
+	for field, boost := range fb.FieldBoosts() {
+		if boost == 1 {
+			continue
+		}
+		docs, ok := m.fieldBoosts[field]
+		if !ok {
+			docs = map[int32]float32{}
+			m.fieldBoosts[field] = docs
+		}
+		docs[did] = boost
+	}
+}
+
+func (m *MemOnlyIndex) deleteFieldBoosts(did int32) {
+	for field, docs := range m.fieldBoosts {
+		delete(docs, did)
+		if len(docs) == 0 {
+			delete(m.fieldBoosts, field)
+		}
+	}
+}
+
+// copyFieldBoosts copies the boosts of the postings, the query iterates them without the index lock
+func copyFieldBoosts(boosts map[int32]float32, postings []int32) map[int32]float32 {
+	out := map[int32]float32{}
+	if len(boosts) <= len(postings) {
+		for did, boost := range boosts {
+			out[did] = boost
+		}
+		return out
+	}
+	for _, did := range postings {
+		if boost, ok := boosts[did]; ok {
+			out[did] = boost
+		}
+	}
+	return out
+}
+
+// fieldBoostQuery multiplies the score of the term by the boost of its field in the current document
+type fieldBoostQuery struct {
+	iq.Query
+	boosts map[int32]float32
+}
+
+func (q *fieldBoostQuery) Score() float32 {
+	score := q.Query.Score()
+	if boost, ok := q.boosts[q.Query.GetDocId()]; ok {
+		score *= boost
+	}
+	return score
+}
+
+func (q *fieldBoostQuery) SetBoost(b float32) iq.Query {
+	q.Query.SetBoost(b)
+	return q
+}
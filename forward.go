@@ -0,0 +1,84 @@
+package index
+
+import "sort"
+
+// forwardStore keeps the indexed documents by document id, deleted documents are nil
+type forwardStore interface {
+	get(did int32) Document
+	set(did int32, d Document)
+	// size is the biggest document id + 1, it is used as total number of documents for the idf
+	size() int
+	// foreach non deleted document in document id order
+	foreach(cb func(int32, Document))
+}
+
+// denseForward is a slice indexed by document id, the default
+type denseForward struct {
+	docs []Document
+}
+
+func (f *denseForward) get(did int32) Document {
+	if did < 0 || int(did) >= len(f.docs) {
+		return nil
+	}
+	return f.docs[did]
+}
+
+func (f *denseForward) set(did int32, d Document) {
+	if int(did) >= len(f.docs) {
+		f.docs = append(f.docs, make([]Document, int(did)-len(f.docs)+1)...)
+	}
+	f.docs[did] = d
+}
+
+func (f *denseForward) size() int {
+	return len(f.docs)
+}
+
+func (f *denseForward) foreach(cb func(int32, Document)) {
+	for did, d := range f.docs {
+		if d != nil {
+			cb(int32(did), d)
+		}
+	}
+}
+
+// sparseForward is a map by document id, see WithSparseForward
+type sparseForward struct {
+	docs map[int32]Document
+	max  int32
+}
+
+func newSparseForward() *sparseForward {
+	return &sparseForward{docs: map[int32]Document{}, max: -1}
+}
+
+func (f *sparseForward) get(did int32) Document {
+	return f.docs[did]
+}
+
+func (f *sparseForward) set(did int32, d Document) {
+	if d == nil {
+		delete(f.docs, did)
+	} else {
+		f.docs[did] = d
+	}
+	if did > f.max {
+		f.max = did
+	}
+}
+
+func (f *sparseForward) size() int {
+	return int(f.max) + 1
+}
+
+func (f *sparseForward) foreach(cb func(int32, Document)) {
+	dids := make([]int32, 0, len(f.docs))
+	for did := range f.docs {
+		dids = append(dids, did)
+	}
+	sort.Slice(dids, func(i, j int) bool { return dids[i] < dids[j] })
+	for _, did := range dids {
+		cb(did, f.docs[did])
+	}
+}
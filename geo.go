@@ -0,0 +1,104 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	iq "github.com/rekki/go-query"
+)
+
+// LatLon is a point in degrees
+type LatLon struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+const earthRadiusKm = 6371.0
+
+// DistanceKm is the haversine (great circle) distance between a and b
+func DistanceKm(a, b LatLon) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// documentLatLon reads the point from the first values of the fields
+func documentLatLon(d Document, latField, lonField string) (LatLon, bool) {
+	fields := d.IndexableFields()
+	lats, lons := fields[latField], fields[lonField]
+	if len(lats) == 0 || len(lons) == 0 {
+		return LatLon{}, false
+	}
+	lat, err := strconv.ParseFloat(lats[0], 64)
+	if err != nil {
+		return LatLon{}, false
+	}
+	lon, err := strconv.ParseFloat(lons[0], 64)
+	if err != nil {
+		return LatLon{}, false
+	}
+	return LatLon{Lat: lat, Lon: lon}, true
+}
+
+// GeoWithin creates query matching the documents within radiusKm of center with constant score of 1, to be used as a filter
+// the point of a document is the first value of latField and lonField (in degrees), documents without valid point do not match.
+// The values are not indexed as numbers, so every document is checked: first against the bounding box of the circle and then by DistanceKm
+//
+// Example:
+//  amsterdam := index.LatLon{Lat: 52.37, Lon: 4.89}
+//  query := iq.And(
+//  	iq.Or(m.Terms("name", "university")...),
+//  	m.GeoWithin("lat", "lon", amsterdam, 50),
+//  )
+//  top := m.TopN(10, query, index.GeoDecay("lat", "lon", amsterdam, 10))
+func (m *MemOnlyIndex) GeoWithin(latField, lonField string, center LatLon, radiusKm float64) iq.Query {
+	// the bounding box, the longitude one is open near the poles
+	dLat := radiusKm / earthRadiusKm * 180 / math.Pi
+	dLon := 360.0
+	if cos := math.Cos(center.Lat * math.Pi / 180); cos > 0.0001 {
+		dLon = dLat / cos
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+
+	matching := []int32{}
+	m.forward.foreach(func(did int32, d Document) {
+		p, ok := documentLatLon(m.updatedDocumentLocked(did, d), latField, lonField)
+		if !ok || math.Abs(p.Lat-center.Lat) > dLat {
+			return
+		}
+		// the difference can wrap around the antimeridian
+		lonDiff := math.Abs(p.Lon - center.Lon)
+		if lonDiff > 180 {
+			lonDiff = 360 - lonDiff
+		}
+		if lonDiff > dLon {
+			return
+		}
+		if DistanceKm(center, p) <= radiusKm {
+			matching = append(matching, did)
+		}
+	})
+	s := fmt.Sprintf("geo(%s,%s:%f,%f<%fkm)", latField, lonField, center.Lat, center.Lon, radiusKm)
+	return iq.Constant(1, iq.Term(m.forward.size(), s, matching))
+}
+
+// GeoDecay returns TopN callback multiplying the score by exponential decay of the distance from center,
+// factor 1 at the center, 0.5 at halfDistanceKm, 0.25 at 2*halfDistanceKm and so on, documents without valid point get 0
+func GeoDecay(latField, lonField string, center LatLon, halfDistanceKm float64) func(int32, float32, Document) float32 {
+	return func(did int32, score float32, d Document) float32 {
+		p, ok := documentLatLon(d, latField, lonField)
+		if !ok {
+			return 0
+		}
+		if halfDistanceKm <= 0 {
+			return score
+		}
+		return score * float32(math.Exp2(-DistanceKm(center, p)/halfDistanceKm))
+	}
+}
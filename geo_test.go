@@ -0,0 +1,50 @@
+package index
+
+import (
+	"math"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestDistanceKm(t *testing.T) {
+	amsterdam := LatLon{Lat: 52.3676, Lon: 4.9041}
+	sofia := LatLon{Lat: 42.6977, Lon: 23.3219}
+	if d := DistanceKm(amsterdam, sofia); math.Abs(d-1745) > 10 {
+		t.Fatalf("unexpected distance %f", d)
+	}
+	if d := DistanceKm(LatLon{Lat: 0, Lon: 179.9}, LatLon{Lat: 0, Lon: -179.9}); math.Abs(d-22.2) > 0.5 {
+		t.Fatalf("unexpected distance over the antimeridian %f", d)
+	}
+}
+
+func TestGeoWithin(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		MapDocument{"name": {"Amsterdam"}, "lat": {"52.3676"}, "lon": {"4.9041"}},
+		MapDocument{"name": {"Haarlem"}, "lat": {"52.3874"}, "lon": {"4.6462"}},
+		MapDocument{"name": {"Rotterdam"}, "lat": {"51.9244"}, "lon": {"4.4777"}},
+		MapDocument{"name": {"Sofia"}, "lat": {"42.6977"}, "lon": {"23.3219"}},
+		MapDocument{"name": {"Nowhere"}},
+		MapDocument{"name": {"Fiji"}, "lat": {"-17.7134"}, "lon": {"179.9"}},
+	)
+
+	matching := func(q iq.Query, cb func(int32, float32, Document) float32) []Hit {
+		return m.TopN(10, q, cb).Hits
+	}
+
+	amsterdam := LatLon{Lat: 52.37, Lon: 4.89}
+	hits := matching(m.GeoWithin("lat", "lon", amsterdam, 30), nil)
+	if len(hits) != 2 || hits[0].ID != 0 || hits[1].ID != 1 {
+		t.Fatalf("unexpected hits %v", hits)
+	}
+	hits = matching(m.GeoWithin("lat", "lon", amsterdam, 100), GeoDecay("lat", "lon", amsterdam, 10))
+	if len(hits) != 3 || hits[0].ID != 0 || hits[1].ID != 1 || hits[2].ID != 2 || hits[0].Score <= hits[1].Score {
+		t.Fatalf("unexpected hits %v", hits)
+	}
+
+	hits = matching(m.GeoWithin("lat", "lon", LatLon{Lat: -17.7, Lon: -179.9}, 50), nil)
+	if len(hits) != 1 || hits[0].ID != 5 {
+		t.Fatalf("expected match over the antimeridian %v", hits)
+	}
+}
@@ -5,4 +5,5 @@ go 1.14
 require (
 	github.com/rekki/go-query v0.0.0-20200414071444-e4f29d4ef475
 	github.com/rekki/go-query-analyze v0.0.0-20200414083555-504db5f2c022
+	golang.org/x/text v0.3.2
 )
@@ -2,9 +2,16 @@
 package index
 
 import (
+	"hash/fnv"
+	"io"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
 	analyzer "github.com/rekki/go-query-analyze"
 	norm "github.com/rekki/go-query-analyze/normalize"
 	tokenize "github.com/rekki/go-query-analyze/tokenize"
+	unorm "golang.org/x/text/unicode/norm"
 )
 
 // Document provides an interface on the documents you want indexed
@@ -23,10 +30,105 @@ import (
 //
 //  	return out
 //  }
+//
+// Every value of a field is analyzed on its own, so the tokenizers combining tokens (shingles, Surround..) never bridge two values,
+// e.g. the values "Amsterdam" and "Mokum" are not shingled into "amsterdammokum"
 type Document interface {
 	IndexableFields() map[string][]string
 }
 
+// BoostedDocument can be implemented by documents that are intrinsically more important (featured listings, popular cities..)
+// the boost is stored at index time and multiplies the score in Foreach and TopN, documents that do not implement it have boost of 1
+type BoostedDocument interface {
+	Document
+	Boost() float32
+}
+
+// DocumentWithAnalyzers can be implemented by documents that declare the analysis of their own fields
+//
+// The analyzer for a field is picked in the following order:
+//  1. the perField analyzer the index was created with
+//  2. the analyzer declared by the document
+//  3. IDAnalyzer for the id field, the default analyzer of the index otherwise (see WithDefaultAnalyzer)
+// The first document declaring an analyzer for a field that is not configured on the index registers it for that field,
+// so Terms() and Delete() use the same analyzer, analyzers declared by subsequent documents for the same field are ignored.
+// A declaration is also ignored if the field already has postings of documents indexed with another analyzer,
+// all the documents of a field are analyzed the same way.
+type DocumentWithAnalyzers interface {
+	Document
+	FieldAnalyzers() map[string]*analyzer.Analyzer
+}
+
+// ReaderDocument can be implemented by documents with big text fields (e.g. bodies of many megabytes),
+// the text of IndexableReaders is read and analyzed in chunks of AnalyzeReaderChunk bytes (see AnalyzeReader) instead of as a whole string.
+// The readers are read once when the document is indexed, so deleting the document from MemOnlyIndex scans all postings
+type ReaderDocument interface {
+	Document
+	IndexableReaders() map[string]io.Reader
+}
+
+// VersionedDocument can be implemented by documents that already have a version (or etag), used by IndexOrUpdate instead of hashing the content
+type VersionedDocument interface {
+	Document
+	Version() string
+}
+
+// DefaultDocumentVersion returns the Version() of VersionedDocument or a hash of the indexable fields otherwise
+func DefaultDocumentVersion(d Document) string {
+	if vd, ok := d.(VersionedDocument); ok {
+		return vd.Version()
+	}
+
+	fields := d.IndexableFields()
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	for _, k := range keys {
+		_, _ = h.Write([]byte(k))
+		_, _ = h.Write([]byte{0})
+		for _, v := range fields[k] {
+			_, _ = h.Write([]byte(v))
+			_, _ = h.Write([]byte{0})
+		}
+		_, _ = h.Write([]byte{1})
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// MapDocument is a Document backed directly by its indexable fields,
+// handy when there is no struct to index (e.g. documents loaded from JSON)
+type MapDocument map[string][]string
+
+// IndexableFields returns the map itself
+func (d MapDocument) IndexableFields() map[string][]string {
+	return d
+}
+
+// DefaultMaxTermLength is the default maximum length of a term in bytes, longer tokens (e.g. a 100KB "word" without whitespace) are truncated
+var DefaultMaxTermLength = 256
+
+// truncateTerm cuts s to at most max bytes without splitting a rune, max <= 0 disables it
+func truncateTerm(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+func truncateTerms(tokens []string, max int) []string {
+	for i, t := range tokens {
+		tokens[i] = truncateTerm(t, max)
+	}
+	return tokens
+}
+
 // --- Normalizers ---
 
 // DefaultNormalizer is an default normalizer
@@ -38,6 +140,10 @@ var DefaultNormalizer = []norm.Normalizer{
 	norm.NewTrim(" "),
 }
 
+// UnicodeNormalizer is DefaultNormalizer converting the text to NFKC first (see UnicodeNormalize),
+// so composed and decomposed accents, full width letters and ligatures are normalized the same way
+var UnicodeNormalizer = append([]norm.Normalizer{NewUnicodeNormalize(unorm.NFKC)}, DefaultNormalizer...)
+
 // --- Tokenizers ---
 
 // DefaultSearchTokenizer is an default search tokenizer
@@ -56,10 +162,10 @@ var SoundexTokenizer = []tokenize.Tokenizer{
 	tokenize.NewSoundex(),
 }
 
-// FuzzyTokenizer is an fuzzy tokenizer
+// FuzzyTokenizer is an fuzzy tokenizer, the bigrams are rune bigrams (see RuneNgram)
 var FuzzyTokenizer = []tokenize.Tokenizer{
 	tokenize.NewWhitespace(),
-	tokenize.NewCharNgram(2),
+	NewRuneNgram(2),
 	tokenize.NewUnique(),
 	tokenize.NewSurround("$"),
 }
@@ -86,6 +192,55 @@ var IDAnalyzer = analyzer.NewAnalyzer(
 	[]tokenize.Tokenizer{tokenize.NewNoop()},
 )
 
+// fieldAnalyzer returns the perField analyzer of the field, if it is not configured IDAnalyzer for the idField and the default analyzer
+// of the index otherwise (DefaultAnalyzer if nil), it is the only place deciding the analyzer of the id field,
+// so indexing, Terms and GetByID all agree on a custom IDField
+func fieldAnalyzer(perField map[string]*analyzer.Analyzer, idField string, defaultAnalyzer *analyzer.Analyzer, field string) *analyzer.Analyzer {
+	if a, ok := perField[field]; ok {
+		return a
+	}
+	if field == idField {
+		return IDAnalyzer
+	}
+	if defaultAnalyzer != nil {
+		return defaultAnalyzer
+	}
+	return DefaultAnalyzer
+}
+
+// CaseInsensitiveIDAnalyzer is an id analyzer that trims and lowercases the id
+// configure it for the id field to make GetByID and DeleteByID case insensitive:
+//  index.NewMemOnlyIndex(map[string]*analyzer.Analyzer{"_id": index.CaseInsensitiveIDAnalyzer})
+var CaseInsensitiveIDAnalyzer = analyzer.NewAnalyzer(
+	[]norm.Normalizer{norm.NewTrim(" "), norm.NewLowerCase()},
+	[]tokenize.Tokenizer{tokenize.NewNoop()},
+	[]tokenize.Tokenizer{tokenize.NewNoop()},
+)
+
+// CaseSensitiveAnalyzer unaccents, trims and splits on whitespace, but keeps the case (and the punctuation),
+// e.g. for code or identifier like fields. The search text is analyzed the same way, so "ABC-12" matches only "ABC-12", not "abc-12"
+var CaseSensitiveAnalyzer = analyzer.NewAnalyzer(
+	[]norm.Normalizer{norm.NewUnaccent(), norm.NewTrim(" ")},
+	DefaultSearchTokenizer,
+	DefaultIndexTokenizer,
+)
+
+// UnicodeAnalyzer is DefaultAnalyzer with UnicodeNormalizer, e.g. for text pasted from different sources.
+// It is a separate preset, as changing the normalizer of an existing index changes the terms its documents were indexed with
+var UnicodeAnalyzer = analyzer.NewAnalyzer(
+	UnicodeNormalizer,
+	DefaultSearchTokenizer,
+	DefaultIndexTokenizer,
+)
+
+// IdentifierAnalyzer is an analyzer for code identifiers and API names, the identifiers are split with IdentifierSplit,
+// so "getUserName" and "get_user_name" both match "user", the whole identifier is indexed too and matches "getusername"
+var IdentifierAnalyzer = analyzer.NewAnalyzer(
+	[]norm.Normalizer{NewUnicodeNormalize(unorm.NFKC), norm.NewUnaccent(), norm.NewTrim(" ")},
+	[]tokenize.Tokenizer{tokenize.NewWhitespace(), NewIdentifierSplit()},
+	[]tokenize.Tokenizer{tokenize.NewWhitespace(), &IdentifierSplit{KeepWhole: true}},
+)
+
 // SoundexAnalyzer provides an analyzer for soundex
 // https://en.wikipedia.org/wiki/Soundex
 var SoundexAnalyzer = analyzer.NewAnalyzer(
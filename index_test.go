@@ -1,15 +1,22 @@
 package index
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
+	"path"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	iq "github.com/rekki/go-query"
+	analyzer "github.com/rekki/go-query-analyze"
+	tokenize "github.com/rekki/go-query-analyze/tokenize"
 )
 
 // get full list from https://raw.githubusercontent.com/lutangar/cities.json/master/cities.json
@@ -314,14 +321,19 @@ func TestExampleDir(t *testing.T) {
 		t.Fatalf("expected 3 got %d", n)
 	}
 
-	m.Lazy = true
-
 	n = 0
-	qqq := iq.Or(m.Terms("name", "aMSterdam sofia")...)
+	scores := map[int32]float32{}
+	m.Foreach(iq.Or(m.Terms("name", "aMSterdam sofia")...), func(did int32, score float32) {
+		scores[did] = score
+	})
+	qqq := iq.Or(m.LazyTerms("name", "aMSterdam sofia")...)
 
 	m.Foreach(qqq, func(did int32, score float32) {
 		city := list[did]
 		log.Printf("lazy %v matching with score %f", city, score)
+		if scores[did] != score {
+			t.Fatalf("lazy score %f of %d differs from %f", score, did, scores[did])
+		}
 		n++
 	})
 	if n != 3 {
@@ -358,16 +370,31 @@ func BenchmarkMemIndexBuild(b *testing.B) {
 
 }
 
+func BenchmarkMemIndexBuildWithHint(b *testing.B) {
+	m := NewMemOnlyIndex(nil, WithIndexHint(IndexHint{ExpectedDocs: b.N}))
+	for i := 0; i < b.N; i++ {
+		m.Index(DocumentWithID(&ExampleCity{Name: "Amsterdam", Country: "NL", ID: int32(i)}))
+	}
+}
+
 var dont = 0
 
 func BenchmarkDirIndexSearch10000(b *testing.B) {
+	benchmarkDirIndexSearch10000(b)
+}
+
+func BenchmarkDirIndexSearch10000ReadFDCache(b *testing.B) {
+	benchmarkDirIndexSearch10000(b, WithReadFDCache(10))
+}
+
+func benchmarkDirIndexSearch10000(b *testing.B, opts ...Option) {
 	b.StopTimer()
 	dir, err := ioutil.TempDir("", "forward")
 	if err != nil {
 		panic(err)
 	}
 	defer os.RemoveAll(dir)
-	m := NewDirIndex(dir, NewFDCache(10), nil)
+	m := NewDirIndex(dir, NewFDCache(10), nil, opts...)
 	for i := 0; i < 10000; i++ {
 		err = m.Index(DocumentWithID(&ExampleCity{Name: "Amsterdam", Country: "NL", ID: int32(i)}))
 		if err != nil {
@@ -395,6 +422,7 @@ func BenchmarkMemIndexSearch10000(b *testing.B) {
 		m.Index(Document(&ExampleCity{Name: "Amsterdam", Country: "NL", ID: int32(i)}))
 	}
 
+	b.ReportAllocs()
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		n := 0
@@ -407,3 +435,1375 @@ func BenchmarkMemIndexSearch10000(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+func BenchmarkMemIndexSearch10000Reset(b *testing.B) {
+	b.StopTimer()
+	m := NewMemOnlyIndex(nil)
+	for i := 0; i < 10000; i++ {
+		m.Index(Document(&ExampleCity{Name: "Amsterdam", Country: "NL", ID: int32(i)}))
+	}
+	q := NewResettableQuery(iq.Or(m.Terms("name", "aMSterdam sofia")...))
+
+	b.ReportAllocs()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		q.Reset()
+		m.Foreach(q, func(did int32, score float32, _d Document) {
+			n++
+			dont++
+		})
+	}
+	b.StopTimer()
+}
+
+func TestMatchAll(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	list := []*ExampleCity{
+		{Name: "Amsterdam", Country: "NL"},
+		{Name: "Rotterdam", Country: "NL"},
+		{Name: "Sofia", Country: "BG"},
+		{Name: "Utrecht", Country: "NL"},
+	}
+	m.Index(toDocuments(list)...)
+	m.Delete(1)
+
+	ids := []int32{}
+	m.Foreach(m.MatchAll(), func(did int32, score float32, doc Document) {
+		if score != 1 {
+			t.Fatalf("expected constant score, got %f", score)
+		}
+		ids = append(ids, did)
+	})
+	if fmt.Sprintf("%v", ids) != "[0 2 3]" {
+		t.Fatalf("unexpected match all %v", ids)
+	}
+
+	ids = []int32{}
+	q := iq.And(m.MatchAll(), iq.Or(m.Terms("country", "NL")...))
+	m.Foreach(q, func(did int32, score float32, doc Document) {
+		ids = append(ids, did)
+	})
+	if fmt.Sprintf("%v", ids) != "[0 3]" {
+		t.Fatalf("unexpected match all and filter %v", ids)
+	}
+}
+
+type boostedCity struct {
+	ExampleCity
+	boost float32
+}
+
+func (b *boostedCity) Boost() float32 {
+	return b.boost
+}
+
+func TestDocumentBoost(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{Name: "Amsterdam"},
+		&boostedCity{ExampleCity: ExampleCity{Name: "Amsterdam"}, boost: 3},
+		&boostedCity{ExampleCity: ExampleCity{Name: "Amsterdam"}, boost: 1},
+	)
+
+	scores := []float32{}
+	m.Foreach(iq.Or(m.Terms("name", "amsterdam")...), func(did int32, score float32, doc Document) {
+		scores = append(scores, score)
+	})
+	if len(scores) != 3 || scores[0] != scores[2] || scores[1] != scores[0]*3 {
+		t.Fatalf("unexpected scores %v", scores)
+	}
+
+	top := m.TopN(1, iq.Or(m.Terms("name", "amsterdam")...), nil)
+	if top.Hits[0].ID != 1 {
+		t.Fatalf("expected boosted document first, got %d", top.Hits[0].ID)
+	}
+}
+
+func TestFieldLength(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	list := []*ExampleCity{
+		{Name: "Amsterdam", Names: []string{"Amsterdam", "Mokum"}},
+		{Name: "Amsterdam University College", Names: []string{"AUC"}},
+	}
+	m.Index(toDocuments(list)...)
+
+	if m.FieldLength(0, "name") != 1 || m.FieldLength(1, "name") != 3 {
+		t.Fatalf("unexpected name length %d %d", m.FieldLength(0, "name"), m.FieldLength(1, "name"))
+	}
+	if m.FieldLength(0, "names") != 2 {
+		t.Fatalf("expected 2 got %d", m.FieldLength(0, "names"))
+	}
+	if m.AverageFieldLength("name") != 2 {
+		t.Fatalf("expected 2 got %f", m.AverageFieldLength("name"))
+	}
+
+	m.Delete(1)
+	if m.FieldLength(1, "name") != 0 {
+		t.Fatal("expected 0 after delete")
+	}
+	if m.AverageFieldLength("name") != 1 {
+		t.Fatalf("expected 1 got %f", m.AverageFieldLength("name"))
+	}
+}
+
+type soundexCity struct {
+	ExampleCity
+}
+
+func (s *soundexCity) FieldAnalyzers() map[string]*analyzer.Analyzer {
+	return map[string]*analyzer.Analyzer{
+		"name":    SoundexAnalyzer,
+		"country": IDAnalyzer,
+	}
+}
+
+func TestDocumentFieldAnalyzers(t *testing.T) {
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"country": DefaultAnalyzer})
+	m.Index(&soundexCity{ExampleCity{Name: "Amsterdam", Country: "NL"}})
+
+	n := 0
+	m.Foreach(iq.Or(m.Terms("name", "amstrdm")...), func(did int32, score float32, doc Document) {
+		n++
+	})
+	if n != 1 {
+		t.Fatalf("expected soundex match, got %d", n)
+	}
+
+	// the index configured analyzer takes precedence
+	n = 0
+	m.Foreach(iq.Or(m.Terms("country", "nl")...), func(did int32, score float32, doc Document) {
+		n++
+	})
+	if n != 1 {
+		t.Fatalf("expected default analyzer match, got %d", n)
+	}
+
+	m.Delete(0)
+	if terms := postingTerms(m, "name"); len(terms) != 1 || len(terms[SoundexAnalyzer.AnalyzeIndex("amsterdam")[0]]) != 0 {
+		t.Fatalf("expected postings to be deleted with the declared analyzer %v", terms)
+	}
+}
+
+func TestDocumentFieldAnalyzersAfterDefault(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(&ExampleCity{Name: "Amsterdam"})
+	// name already has postings of the default analyzer, the declared soundex is ignored
+	m.Index(&soundexCity{ExampleCity{Name: "Amsterdam", Country: "NL"}})
+
+	if top := m.TopN(10, iq.Or(m.Terms("name", "amsterdam")...), nil); top.Total != 2 {
+		t.Fatalf("expected both documents to match, got %d", top.Total)
+	}
+	if top := m.TopN(10, iq.Or(m.Terms("country", "NL")...), nil); top.Total != 1 {
+		t.Fatalf("expected the declared analyzer of the new field, got %d", top.Total)
+	}
+
+	m.Delete(0)
+	m.Delete(1)
+	if dangling := m.DanglingPostings(); len(dangling) != 0 {
+		t.Fatalf("expected no dangling postings, got %v", dangling)
+	}
+	if m.perField["name"] != nil || m.perField["country"] != nil {
+		t.Fatalf("expected the configured analyzers untouched")
+	}
+}
+
+func TestDirForeachDocument(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := NewDirIndex(dir, NewFDCache(10), nil)
+	list := []*ExampleCity{
+		{Name: "Amsterdam", Country: "NL", ID: 0},
+		{Name: "Amsterdam, USA", Country: "USA", ID: 1},
+		{Name: "Amsterdam", Country: "NL", ID: 100},
+	}
+	err = m.Index(toDocumentsID(list)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the caller only knows about the first two documents
+	forward := Forward(toDocumentsID(list[:2]))
+	n := 0
+	m.ForeachDocument(iq.Or(m.Terms("name", "amsterdam")...), forward.Get, func(did int32, score float32, doc DocumentWithID) {
+		if doc.DocumentID() != did {
+			t.Fatalf("expected %d got %d", did, doc.DocumentID())
+		}
+		n++
+	})
+	if n != 2 {
+		t.Fatalf("expected 2 got %d", n)
+	}
+	if forward.Get(-1) != nil || forward.Get(2) != nil {
+		t.Fatal("expected nil")
+	}
+}
+
+func TestMaxTermLength(t *testing.T) {
+	long := strings.Repeat("a", 5000)
+
+	m := NewMemOnlyIndex(nil)
+	m.Index(&ExampleCity{Name: long}, &ExampleCity{Name: "a" + strings.Repeat("ж", 3000)})
+	for term := range postingTerms(m, "name") {
+		if len(term) > DefaultMaxTermLength || !utf8.ValidString(term) {
+			t.Fatalf("unexpected term of length %d", len(term))
+		}
+	}
+	n := 0
+	m.Foreach(iq.Or(m.Terms("name", long)...), func(did int32, score float32, doc Document) {
+		n++
+	})
+	if n != 1 {
+		t.Fatalf("expected 1 got %d", n)
+	}
+
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDirIndex(dir, NewFDCache(10), nil)
+	err = d.Index(&ExampleCity{Name: long, ID: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n = 0
+	d.Foreach(iq.Or(d.Terms("name", long)...), func(did int32, score float32) {
+		n++
+	})
+	if n != 1 {
+		t.Fatalf("expected 1 got %d", n)
+	}
+}
+
+func TestCaseInsensitiveID(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(&ExampleCity{Name: "Amsterdam", TestID: "AMS"})
+	if m.GetByID("ams") != nil {
+		t.Fatal("expected exact id match by default")
+	}
+	if m.GetByID("AMS") == nil {
+		t.Fatal("expected document")
+	}
+
+	m = NewMemOnlyIndex(map[string]*analyzer.Analyzer{"_id": CaseInsensitiveIDAnalyzer})
+	m.Index(&ExampleCity{Name: "Amsterdam", TestID: " AMS"})
+	if m.GetByID("ams") == nil {
+		t.Fatal("expected case insensitive match")
+	}
+
+	n := 0
+	m.Foreach(iq.Or(m.Terms("_id", "Ams")...), func(did int32, score float32, doc Document) {
+		n++
+	})
+	if n != 1 {
+		t.Fatalf("expected 1 got %d", n)
+	}
+
+	m.DeleteByID("aMs ")
+	if m.GetByID("AMS") != nil || m.Get(0) != nil {
+		t.Fatal("expected deleted")
+	}
+}
+
+func TestIndexReturnsDocumentIDs(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	ids := m.Index(&ExampleCity{Name: "Amsterdam", TestID: "a"}, &ExampleCity{Name: "Sofia", TestID: "b"})
+	if fmt.Sprintf("%v", ids) != "[0 1]" {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+	m.Delete(0)
+	ids = m.Index(&ExampleCity{Name: "Paris", TestID: "c"})
+	if len(ids) != 1 || m.Get(ids[0]) != m.GetByID("c") {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+}
+
+func TestDirStrictDocumentID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := NewDirIndex(dir, NewFDCache(10), nil)
+	m.Strict = true
+	err = m.Index(&ExampleCity{Name: "Amsterdam", ID: 0}, &ExampleCity{Name: "Sofia", ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Index(&ExampleCity{Name: "Paris", ID: 2}, &ExampleCity{Name: "Paris", ID: 2})
+	if !errors.Is(err, ErrDuplicateDocumentID) {
+		t.Fatalf("expected duplicate in batch, got %v", err)
+	}
+	m.Close()
+
+	// reopen, the seen ids are persisted
+	m = NewDirIndex(dir, NewFDCache(10), nil)
+	m.Strict = true
+	err = m.Index(&ExampleCity{Name: "London", ID: 1})
+	if !errors.Is(err, ErrDuplicateDocumentID) {
+		t.Fatalf("expected duplicate, got %v", err)
+	}
+	err = m.Index(&ExampleCity{Name: "Paris", ID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	m.Foreach(iq.Or(m.Terms("name", "paris london")...), func(did int32, score float32) {
+		n++
+	})
+	if n != 1 {
+		t.Fatalf("expected 1 got %d", n)
+	}
+}
+
+func TestWeightedTerms(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	list := []*ExampleCity{
+		{Name: "New York City"},
+		{Name: "Mexico City"},
+		{Name: "Kansas City"},
+		{Name: "Quebec City"},
+		{Name: "York"},
+		{Name: "City"},
+	}
+	m.Index(toDocuments(list)...)
+
+	scores := map[int32]float32{}
+	m.Foreach(m.WeightedTerms("name", "york city"), func(did int32, score float32, doc Document) {
+		scores[did] = score
+	})
+	if len(scores) != 6 {
+		t.Fatalf("expected 6 got %d", len(scores))
+	}
+	if scores[4] <= scores[5] {
+		t.Fatalf("expected rare term to dominate: york %f city %f", scores[4], scores[5])
+	}
+
+	york := iq.Or(m.Terms("name", "york")...)
+	york.Next()
+	if scores[4] != york.Score()*york.Score() {
+		t.Fatalf("expected idf^2 %f got %f", york.Score()*york.Score(), scores[4])
+	}
+}
+
+func TestStoredFields(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.StoredFields = []string{"name"}
+	list := []*ExampleCity{
+		{Name: "Amsterdam", Country: "NL", TestID: "a", Names: []string{"Mokum"}},
+		{Name: "Sofia", Country: "BG", TestID: "b"},
+	}
+	m.Index(toDocuments(list)...)
+
+	n := 0
+	m.Foreach(iq.Or(m.Terms("names", "mokum")...), func(did int32, score float32, doc Document) {
+		stored := doc.(MapDocument)
+		if fmt.Sprintf("%v", stored) != "map[_id:[a] name:[Amsterdam]]" {
+			t.Fatalf("unexpected stored document %v", stored)
+		}
+		n++
+	})
+	if n != 1 {
+		t.Fatalf("expected 1 got %d", n)
+	}
+
+	m.DeleteByID("a")
+	if m.GetByID("a") != nil {
+		t.Fatal("expected deleted")
+	}
+	for _, field := range m.postings.Fields() {
+		for term, postings := range postingTerms(m, field) {
+			for _, did := range postings {
+				if did == 0 {
+					t.Fatalf("dangling posting %s:%s", field, term)
+				}
+			}
+		}
+	}
+	// deleting twice is a no-op
+	m.Delete(0)
+}
+
+func TestIndexOrUpdate(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	ids := m.IndexOrUpdate(&ExampleCity{Name: "Amsterdam", TestID: "a"}, &ExampleCity{Name: "Sofia", TestID: "b"})
+	if fmt.Sprintf("%v", ids) != "[0 1]" {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+
+	// a is unchanged, b changed, c is new
+	ids = m.IndexOrUpdate(&ExampleCity{Name: "Amsterdam", TestID: "a"}, &ExampleCity{Name: "Sofia", Country: "BG", TestID: "b"}, &ExampleCity{Name: "Paris", TestID: "c"})
+	if fmt.Sprintf("%v", ids) != "[0 2 3]" {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+	if m.Get(1) != nil {
+		t.Fatal("expected the old version to be deleted")
+	}
+
+	n := 0
+	m.Foreach(iq.Or(m.Terms("name", "sofia amsterdam")...), func(did int32, score float32, doc Document) {
+		n++
+	})
+	if n != 2 {
+		t.Fatalf("expected 2 got %d", n)
+	}
+
+	m.DocumentVersion = func(d Document) string {
+		return "static"
+	}
+	m.DeleteByID("c")
+	ids = m.IndexOrUpdate(&ExampleCity{Name: "Paris, France", TestID: "c"})
+	if ids[0] != 4 {
+		t.Fatalf("expected deleted document to be reindexed, got %v", ids)
+	}
+	ids = m.IndexOrUpdate(&ExampleCity{Name: "Paris, Texas", TestID: "c"})
+	if ids[0] != 4 {
+		t.Fatalf("expected custom version to skip, got %v", ids)
+	}
+}
+
+func benchmarkAndOrder(b *testing.B, rareFirst bool) {
+	b.StopTimer()
+	m := NewMemOnlyIndex(nil)
+	for i := 0; i < 100000; i++ {
+		country := "NL"
+		if i%1000 == 0 {
+			country = "BG"
+		}
+		m.Index(&ExampleCity{Name: "Amsterdam", Country: country})
+	}
+
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		common := iq.Or(m.Terms("name", "amsterdam")...)
+		rare := iq.Or(m.Terms("country", "bg")...)
+		var q iq.Query
+		if rareFirst {
+			q = iq.And(rare, common)
+		} else {
+			q = iq.And(common, rare)
+		}
+		m.Foreach(q, func(did int32, score float32, _d Document) {
+			dont++
+		})
+	}
+	b.StopTimer()
+}
+
+// iq.And sorts its clauses by Cost() and advances on the rarest one, so the order of the clauses does not matter
+func BenchmarkMemIndexAndCommonFirst(b *testing.B) {
+	benchmarkAndOrder(b, false)
+}
+
+func BenchmarkMemIndexAndRareFirst(b *testing.B) {
+	benchmarkAndOrder(b, true)
+}
+
+func TestUseDocumentID(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.UseDocumentID = true
+
+	dids := m.Index(
+		&ExampleCity{ID: 10, TestID: "ams", Name: "Amsterdam", Country: "NL"},
+		&ExampleCity{ID: 3, TestID: "sof", Name: "Sofia", Country: "BG"},
+		&ExampleCity{ID: 5, TestID: "rot", Name: "Rotterdam", Country: "NL"},
+	)
+	if dids[0] != 10 || dids[1] != 3 || dids[2] != 5 {
+		t.Fatalf("unexpected document ids %v", dids)
+	}
+	if m.Get(4) != nil || m.GetByID("sof").(*ExampleCity).ID != 3 {
+		t.Fatalf("unexpected forward index")
+	}
+
+	matching := []int32{}
+	m.Foreach(iq.Or(m.Terms("country", "NL")...), func(did int32, score float32, doc Document) {
+		if doc.(*ExampleCity).ID != did {
+			t.Fatalf("expected %d got %d", doc.(*ExampleCity).ID, did)
+		}
+		matching = append(matching, did)
+	})
+	if len(matching) != 2 || matching[0] != 5 || matching[1] != 10 {
+		t.Fatalf("unexpected matching %v", matching)
+	}
+
+	m.Index(&ExampleCity{ID: 5, TestID: "rot", Name: "Rotterdam", Country: "BG"})
+	if m.DocFreq("country", "nl") != 1 || m.DocFreq("country", "bg") != 2 {
+		t.Fatalf("expected document 5 to be replaced")
+	}
+}
+
+func TestSparseForward(t *testing.T) {
+	check := func(m *MemOnlyIndex, big int32) {
+		m.UseDocumentID = true
+		m.Index(
+			&ExampleCity{ID: big, TestID: "ams", Name: "Amsterdam", Country: "NL"},
+			&ExampleCity{ID: 7, TestID: "sof", Name: "Sofia", Country: "BG"},
+			&ExampleCity{ID: 1000, TestID: "rot", Name: "Rotterdam", Country: "NL"},
+		)
+		if m.Get(7).(*ExampleCity).Name != "Sofia" || m.Get(8) != nil {
+			t.Fatalf("unexpected forward index")
+		}
+		m.DeleteByID("rot")
+		m.Index(&ExampleCity{ID: 5, TestID: "ein", Name: "Eindhoven", Country: "NL"})
+
+		matching := []int32{}
+		m.Foreach(m.MatchAll(), func(did int32, score float32, doc Document) {
+			matching = append(matching, did)
+		})
+		if len(matching) != 3 || matching[0] != 5 || matching[1] != 7 || matching[2] != big {
+			t.Fatalf("unexpected matching %v", matching)
+		}
+
+		matching = []int32{}
+		m.Foreach(iq.Or(m.Terms("country", "NL")...), func(did int32, score float32, doc Document) {
+			matching = append(matching, did)
+		})
+		if len(matching) != 2 || matching[0] != 5 || matching[1] != big {
+			t.Fatalf("unexpected matching %v", matching)
+		}
+	}
+
+	check(NewMemOnlyIndex(nil), 2000)
+	check(NewMemOnlyIndex(nil, WithSparseForward()), 2000)
+	// the slice would allocate 2 billion documents
+	check(NewMemOnlyIndex(nil, WithSparseForward()), 2000000000)
+}
+
+func TestHasTerm(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{TestID: "ams", Name: "Amsterdam", Country: "NL"},
+		&ExampleCity{TestID: "sof", Name: "Sofia", Country: "BG"},
+	)
+	if !m.HasTerm("name", "amsterdam") || m.HasTerm("name", "rotterdam") || m.HasTerm("missing", "amsterdam") {
+		t.Fatalf("unexpected HasTerm")
+	}
+	m.DeleteByID("ams")
+	if m.HasTerm("name", "amsterdam") {
+		t.Fatalf("expected no amsterdam after delete")
+	}
+
+	dir, err := ioutil.TempDir("", "has_term")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDirIndex(dir, NewFDCache(10), nil)
+	defer d.Close()
+	err = d.Index(&ExampleCity{ID: 1, Name: "Amsterdam", Country: "NL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.HasTerm("name", "amsterdam") || d.HasTerm("name", "rotterdam") {
+		t.Fatalf("unexpected HasTerm")
+	}
+}
+
+func TestRebuildByID(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{TestID: "ams", Name: "Amsterdam", Country: "NL"},
+		&ExampleCity{TestID: "sof", Name: "Sofia", Country: "BG"},
+	)
+
+	m.forwardByID = map[string]int32{"sof": 0, "gone": 5}
+	m.RebuildByID()
+
+	if len(m.forwardByID) != 2 || m.GetByID("ams").(*ExampleCity).Name != "Amsterdam" || m.GetByID("sof").(*ExampleCity).Name != "Sofia" {
+		t.Fatalf("unexpected ids %v", m.forwardByID)
+	}
+	if m.GetByID("gone") != nil {
+		t.Fatalf("expected gone to be removed")
+	}
+}
+
+func TestTopNTieBreak(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	for i := 0; i < 10; i++ {
+		m.Index(&ExampleCity{Name: "Amsterdam", Country: "NL"})
+	}
+
+	constant := func(did int32, score float32, doc Document) float32 {
+		if did == 7 {
+			return 2
+		}
+		return 1
+	}
+	top := m.TopN(4, iq.Or(m.Terms("name", "amsterdam")...), constant)
+	expected := []int32{7, 0, 1, 2}
+	if len(top.Hits) != 4 {
+		t.Fatalf("unexpected result %v", top)
+	}
+	for i, hit := range top.Hits {
+		if hit.ID != expected[i] {
+			t.Fatalf("expected %v got %v", expected, top.Hits)
+		}
+	}
+
+	top = m.TopNBy(3, iq.Or(m.Terms("name", "amsterdam")...), constant, func(a, b Hit) bool {
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.ID > b.ID
+	})
+	expected = []int32{7, 9, 8}
+	if top.Total != 10 || len(top.Hits) != 3 {
+		t.Fatalf("unexpected result %v", top)
+	}
+	for i, hit := range top.Hits {
+		if hit.ID != expected[i] {
+			t.Fatalf("expected %v got %v", expected, top.Hits)
+		}
+	}
+}
+
+func TestTopNWith(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	for i := 0; i < 10; i++ {
+		m.Index(&ExampleCity{Name: "Amsterdam", Country: "NL"})
+	}
+
+	byID := func(did int32, score float32, doc Document) float32 {
+		return float32(did)
+	}
+	q := func() iq.Query {
+		return iq.Or(m.Terms("name", "amsterdam")...)
+	}
+
+	top := m.TopNWith(3, q(), byID, TopNOptions{MinScore: 8})
+	if top.Total != 10 || len(top.Hits) != 2 || top.Hits[0].ID != 9 || top.Hits[1].ID != 8 {
+		t.Fatalf("unexpected result %v", top)
+	}
+
+	top = m.TopNWith(0, q(), byID, TopNOptions{MinScore: 5, TotalAboveMinScore: true})
+	if top.Total != 5 || len(top.Hits) != 0 {
+		t.Fatalf("unexpected result %v", top)
+	}
+
+	capped := func(score float32) float32 {
+		if score > 7 {
+			return 7
+		}
+		return score
+	}
+	top = m.TopNWith(4, q(), byID, TopNOptions{MinScore: 6, TotalAboveMinScore: true, Transform: capped})
+	expected := []int32{7, 8, 9, 6}
+	if top.Total != 4 || len(top.Hits) != 4 {
+		t.Fatalf("unexpected result %v", top)
+	}
+	for i, hit := range top.Hits {
+		if hit.ID != expected[i] || hit.Score > 7 {
+			t.Fatalf("expected %v got %v", expected, top.Hits)
+		}
+	}
+}
+
+func TestNoTokens(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{Name: "Amsterdam", Country: "NL"},
+		&ExampleCity{Name: "Sofia", Country: "BG"},
+	)
+
+	count := func(q iq.Query) int {
+		n := 0
+		m.Foreach(q, func(did int32, score float32, doc Document) {
+			n++
+		})
+		return n
+	}
+
+	if len(m.Terms("name", " ,. ")) != 0 || count(iq.Or(m.Terms("name", " ,. ")...)) != 0 || count(iq.And(m.Terms("name", " ,. ")...)) != 0 {
+		t.Fatalf("expected match none")
+	}
+
+	m.NoTokens = NoTokensMatchAll
+	if count(iq.Or(m.Terms("name", " ,. ")...)) != 2 || count(iq.And(m.Terms("name", " ,. ")...)) != 2 {
+		t.Fatalf("expected match all")
+	}
+	if count(iq.And(iq.Or(m.Terms("name", "")...), iq.Or(m.Terms("country", "bg")...))) != 1 {
+		t.Fatalf("expected only the filter to apply")
+	}
+
+	m.NoTokens = NoTokensError
+	queries, err := m.CheckedTerms("name", " ,. ")
+	if !errors.Is(err, ErrNoTokens) || len(queries) != 0 {
+		t.Fatalf("expected ErrNoTokens, got %v", err)
+	}
+	if count(iq.Or(m.Terms("name", " ,. ")...)) != 0 {
+		t.Fatalf("expected match none")
+	}
+	if _, err := m.CheckedTerms("name", "sofia"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirDeleteByID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delete_by_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := NewDirIndex(dir, NewFDCache(10), nil)
+	list := []*ExampleCity{
+		{ID: 0, Names: []string{"Amsterdam", "Amsterdam"}, Country: "NL", TestID: "a"},
+		{ID: 1, Names: []string{"Sofia", "Sofia"}, Country: "NL", TestID: "b"},
+		{ID: 2, Names: []string{"Paris", "Paris"}, Country: "FR", TestID: "c"},
+	}
+	err = m.Index(toDocumentsID(list)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(m *DirIndex, term string, id int32, expected int) {
+		q := iq.And(m.Terms("names", term)...)
+		n := 0
+		m.Foreach(q, func(did int32, score float32) {
+			n++
+			if did != id {
+				t.Fatalf("%s unexpected match %d got %d", term, id, did)
+			}
+		})
+		if n != expected {
+			t.Fatalf("%s expected %d got %d", term, expected, n)
+		}
+	}
+	expectID := func(m *DirIndex, uuid string, id int32, found bool) {
+		did, ok, err := m.GetByID(uuid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != found || (found && did != id) {
+			t.Fatalf("%s expected %d %v got %d %v", uuid, id, found, did, ok)
+		}
+	}
+
+	expect(m, "amsterdam", 0, 1)
+	expect(m, "sofia", 1, 1)
+	expect(m, "paris", 2, 1)
+	expectID(m, "b", 1, true)
+
+	if err := m.DeleteByID("b"); err != nil {
+		t.Fatal(err)
+	}
+	expectID(m, "b", 0, false)
+	expect(m, "amsterdam", 0, 1)
+	expect(m, "sofia", 1, 0)
+	expect(m, "paris", 2, 1)
+
+	if err := m.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	expectID(m, "c", 0, false)
+	expect(m, "paris", 2, 0)
+
+	err = m.Index(toDocumentsID([]*ExampleCity{{ID: 3, Names: []string{"Sofia", "Sofia"}, Country: "NL", TestID: "b"}})...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectID(m, "b", 3, true)
+	expect(m, "sofia", 3, 1)
+	m.Close()
+
+	// ids and tombstones are persisted
+	reopened := NewDirIndex(dir, NewFDCache(10), nil)
+	defer reopened.Close()
+	expectID(reopened, "a", 0, true)
+	expectID(reopened, "b", 3, true)
+	expectID(reopened, "c", 0, false)
+	expect(reopened, "sofia", 3, 1)
+	expect(reopened, "paris", 2, 0)
+}
+
+func TestIDF(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{Name: "Amsterdam", Country: "NL"},
+		&ExampleCity{Name: "Rotterdam", Country: "NL"},
+		&ExampleCity{Name: "Sofia", Country: "BG"},
+	)
+
+	score := func(q iq.Query) float32 {
+		q.Next()
+		return q.Score()
+	}
+	if score(iq.Or(m.Terms("country", "nl")...)) != DefaultIDF(2, 3) {
+		t.Fatalf("expected default idf")
+	}
+
+	m.IDF = func(df, numDocs int) float32 {
+		return float32(numDocs*10 + df)
+	}
+	if s := score(iq.Or(m.Terms("country", "nl")...)); s != 32 {
+		t.Fatalf("expected 32 got %f", s)
+	}
+	if s := score(m.NewTermQuery("country", "bg").SetBoost(2)); s != 62 {
+		t.Fatalf("expected 62 got %f", s)
+	}
+	if s := score(m.WeightedTerms("country", "bg")); s != 31*31 {
+		t.Fatalf("expected %d got %f", 31*31, s)
+	}
+}
+
+func TestRepeatedTermDoesNotDominate(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		MapDocument{"text": {strings.Repeat("cheap watches ", 1000)}},
+		MapDocument{"text": {"cheap flights and cheap hotels"}},
+		MapDocument{"text": {"expensive watches"}},
+	)
+
+	// the term frequency is not stored, a term scores the same no matter how many times the document repeats it
+	top := m.TopN(10, iq.Or(m.Terms("text", "cheap")...), nil)
+	if len(top.Hits) != 2 || top.Hits[0].Score != top.Hits[1].Score {
+		t.Fatalf("unexpected hits %v", top.Hits)
+	}
+	if len(m.postings.Get("text", "cheap")) != 2 {
+		t.Fatalf("expected the document once per posting list")
+	}
+}
+
+func TestExistsQuery(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{TestID: "ams", Name: "Amsterdam", Country: "NL", Names: []string{"Mokum"}},
+		&ExampleCity{TestID: "rot", Name: "Rotterdam", Country: "NL"},
+		&ExampleCity{TestID: "sof", Name: "Sofia", Country: "BG", Names: []string{" , "}},
+		&ExampleCity{TestID: "ein", Name: "Eindhoven", Country: "NL", Names: []string{"Lichtstad"}},
+	)
+	m.DeleteByID("ein")
+
+	ids := func(q iq.Query) []int32 {
+		out := []int32{}
+		m.Foreach(q, func(did int32, score float32, doc Document) {
+			if score != 1 {
+				t.Fatalf("expected constant score, got %f", score)
+			}
+			out = append(out, did)
+		})
+		return out
+	}
+
+	exists := ids(m.ExistsQuery("names"))
+	if len(exists) != 1 || exists[0] != 0 {
+		t.Fatalf("unexpected exists %v", exists)
+	}
+	missing := ids(m.MissingQuery("names"))
+	if len(missing) != 2 || missing[0] != 1 || missing[1] != 2 {
+		t.Fatalf("unexpected missing %v", missing)
+	}
+	if len(ids(m.MissingQuery("unknown"))) != 3 || len(ids(m.ExistsQuery("unknown"))) != 0 {
+		t.Fatalf("unexpected unknown field")
+	}
+}
+
+func TestDirIndexFunc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index_func")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(size int) { IndexFuncBatchSize = size }(IndexFuncBatchSize)
+	IndexFuncBatchSize = 100
+
+	m := NewDirIndex(dir, NewFDCache(10), nil)
+	m.Strict = true
+	defer m.Close()
+
+	i := int32(0)
+	err = m.IndexFunc(func() (DocumentWithID, bool) {
+		if i == 250 {
+			return nil, false
+		}
+		i++
+		return &ExampleCity{ID: i, Name: "Amsterdam"}, true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.DocFreq("name", "amsterdam") != 250 {
+		t.Fatalf("expected 250 got %d", m.DocFreq("name", "amsterdam"))
+	}
+
+	i = 0
+	err = m.IndexFunc(func() (DocumentWithID, bool) {
+		i++
+		return &ExampleCity{ID: i, Name: "Amsterdam"}, true
+	})
+	if !errors.Is(err, ErrDuplicateDocumentID) {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	reported := []Progress{}
+	m.ProgressEvery = 10
+	m.OnProgress = func(p Progress) {
+		reported = append(reported, p)
+	}
+	for i := 0; i < 25; i++ {
+		m.Index(&ExampleCity{Name: "Amsterdam"})
+	}
+	if len(reported) != 2 || reported[0].Documents != 10 || reported[1].Documents != 20 {
+		t.Fatalf("unexpected progress %v", reported)
+	}
+
+	dir, err := ioutil.TempDir("", "progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDirIndex(dir, NewFDCache(10), nil)
+	defer d.Close()
+	reported = []Progress{}
+	d.ProgressEvery = 10
+	d.OnProgress = func(p Progress) {
+		reported = append(reported, p)
+	}
+	for i := 0; i < 25; i++ {
+		err := d.Index(&ExampleCity{ID: int32(i), Name: "Amsterdam", Country: "NL"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 2 postings of 4 bytes per document
+	if len(reported) != 2 || reported[1].Documents != 20 || reported[1].BytesWritten != 20*2*4 {
+		t.Fatalf("unexpected progress %v", reported)
+	}
+}
+
+func TestDirLongTerm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "long_term")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	prefix := strings.Repeat("a", 299)
+	d := NewDirIndex(dir, NewFDCache(10), nil)
+	defer d.Close()
+	err = d.Index(&ExampleCity{ID: 1, Name: prefix + "b"}, &ExampleCity{ID: 2, Name: prefix + "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fn, _ := termFile(dir, d.DirHash, "name", prefix+"b")
+	if len(path.Base(fn)) > DirIndexMaxTermLen {
+		t.Fatalf("unexpected file name length %d", len(path.Base(fn)))
+	}
+	full, err := ioutil.ReadFile(fn + ".term")
+	if err != nil || string(full) != prefix+"b" {
+		t.Fatalf("expected the full term next to the postings, got %v", err)
+	}
+
+	for did, term := range map[int32]string{1: prefix + "b", 2: prefix + "c"} {
+		matching := []int32{}
+		d.Foreach(iq.Or(d.Terms("name", term)...), func(did int32, score float32) {
+			matching = append(matching, did)
+		})
+		if len(matching) != 1 || matching[0] != did {
+			t.Fatalf("expected only %d got %v", did, matching)
+		}
+	}
+}
+
+func TestTermsMulti(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{Name: "Amsterdam", Names: []string{"Mokum", "Venice of the North"}},
+		&ExampleCity{Name: "Rotterdam", Names: []string{"Roffa"}},
+		&ExampleCity{Name: "Sofia", Names: []string{"Serdica"}},
+		&ExampleCity{Name: "Bruges", Names: []string{"Venice"}},
+	)
+
+	matching := func(q iq.Query) []int32 {
+		out := []int32{}
+		m.Foreach(q, func(did int32, score float32, doc Document) {
+			out = append(out, did)
+		})
+		return out
+	}
+
+	got := matching(m.TermsMulti("names", strings.Split("mokum|Serdica", "|")))
+	if len(got) != 2 || got[0] != 0 || got[1] != 2 {
+		t.Fatalf("unexpected matching %v", got)
+	}
+	got = matching(m.TermsMulti("names", []string{"venice north", "roffa"}))
+	if len(got) != 2 || got[0] != 0 || got[1] != 1 {
+		t.Fatalf("unexpected matching %v", got)
+	}
+	if len(matching(m.TermsMulti("names", nil))) != 0 {
+		t.Fatalf("expected no matches")
+	}
+}
+
+type idDocument struct {
+	did    int32
+	fields map[string][]string
+}
+
+func (d idDocument) IndexableFields() map[string][]string {
+	return d.fields
+}
+
+func (d idDocument) DocumentID() int32 {
+	return d.did
+}
+
+func TestCustomIDField(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.IDField = "sku"
+	m.Index(
+		MapDocument{"sku": {"AB-12 x"}, "id": {"Amsterdam"}},
+		MapDocument{"sku": {"ab-12"}, "id": {"AMSTERDAM"}},
+	)
+	if d := m.GetByID("AB-12 x"); d == nil || d.IndexableFields()["id"][0] != "Amsterdam" {
+		t.Fatalf("unexpected document %v", d)
+	}
+	if top := m.TopN(10, iq.Or(m.Terms("sku", "AB-12 x")...), nil); top.Total != 1 || top.Hits[0].ID != 0 {
+		t.Fatalf("expected exact id match, got %+v", top)
+	}
+	// id is not special anymore, it is analyzed with DefaultAnalyzer
+	if top := m.TopN(10, iq.Or(m.Terms("id", "amsterdam")...), nil); top.Total != 2 {
+		t.Fatalf("expected id to be analyzed as text, got %+v", top)
+	}
+	m.DeleteByID("ab-12")
+	if m.GetByID("ab-12") != nil || m.GetByID("AB-12 x") == nil {
+		t.Fatalf("unexpected delete")
+	}
+
+	dir, err := ioutil.TempDir("", "sku")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDirIndex(dir, NewFDCache(10), nil)
+	d.IDField = "sku"
+	if err := d.Index(&ExampleCity{ID: 0, Name: "Amsterdam"}, idDocument{did: 1, fields: map[string][]string{"sku": {"AB-12 x"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if did, ok, err := d.GetByID("AB-12 x"); err != nil || !ok || did != 1 {
+		t.Fatalf("unexpected GetByID %d %v %v", did, ok, err)
+	}
+	if d.DocFreq("sku", "AB-12 x") != 1 || len(d.Terms("sku", "AB-12 x")) != 1 {
+		t.Fatalf("expected exact id term")
+	}
+}
+
+func TestForeachID(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{Name: "Amsterdam"},
+		&boostedCity{ExampleCity: ExampleCity{Name: "Amsterdam"}, boost: 2},
+		&ExampleCity{Name: "Amsterdam"},
+	)
+	m.Delete(2)
+
+	scores := map[int32]float32{}
+	m.ForeachID(iq.Or(m.Terms("name", "amsterdam")...), func(did int32, score float32) {
+		scores[did] = score
+	})
+	if len(scores) != 2 || scores[1] != 2*scores[0] {
+		t.Fatalf("unexpected scores %v", scores)
+	}
+
+	// deleted after the query was created
+	query := iq.Or(m.Terms("name", "amsterdam")...)
+	m.Delete(0)
+	dids := []int32{}
+	m.ForeachID(query, func(did int32, score float32) {
+		dids = append(dids, did)
+	})
+	if len(dids) != 1 || dids[0] != 1 {
+		t.Fatalf("expected the deleted document skipped, got %v", dids)
+	}
+}
+
+func TestDirDeleteByQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delete_by_query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := NewDirIndex(dir, NewFDCache(10), nil)
+	list := []*ExampleCity{
+		{ID: 0, Name: "Amsterdam", Country: "NL"},
+		{ID: 1, Name: "Rotterdam", Country: "NL"},
+		{ID: 2, Name: "Paris", Country: "FR"},
+	}
+	if err := m.Index(toDocumentsID(list)...); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := m.DeleteByQuery(iq.Or(m.Terms("country", "nl")...))
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 deleted, got %d %v", n, err)
+	}
+	n, err = m.DeleteByQuery(iq.Or(m.Terms("country", "nl fr")...))
+	if err != nil || n != 1 {
+		t.Fatalf("expected only paris to be deleted again, got %d %v", n, err)
+	}
+
+	reopened := NewDirIndex(dir, NewFDCache(10), nil)
+	found := 0
+	reopened.Foreach(iq.Or(m.Terms("country", "nl fr")...), func(did int32, score float32) {
+		found++
+	})
+	if found != 0 {
+		t.Fatalf("expected persisted tombstones, found %d", found)
+	}
+}
+
+func TestForeachUntil(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	for i := 0; i < 100; i++ {
+		m.Index(&ExampleCity{Name: "Amsterdam"})
+	}
+
+	dids := []int32{}
+	m.ForeachUntil(iq.Or(m.Terms("name", "amsterdam")...), func(did int32, score float32, doc Document) bool {
+		dids = append(dids, did)
+		return len(dids) < 3
+	})
+	if len(dids) != 3 || dids[2] != 2 {
+		t.Fatalf("expected to stop after 3, got %v", dids)
+	}
+}
+
+type fieldBoostedCity struct {
+	ExampleCity
+	boosts map[string]float32
+}
+
+func (c *fieldBoostedCity) FieldBoosts() map[string]float32 {
+	return c.boosts
+}
+
+func TestFieldBoosts(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{Name: "Amsterdam", Country: "Amsterdam"},
+		&fieldBoostedCity{ExampleCity: ExampleCity{Name: "Amsterdam", Country: "Amsterdam"}, boosts: map[string]float32{"name": 3}},
+	)
+
+	score := func(field string, did int32) float32 {
+		s := float32(0)
+		m.Foreach(iq.Or(m.Terms(field, "amsterdam")...), func(d int32, score float32, doc Document) {
+			if d == did {
+				s = score
+			}
+		})
+		return s
+	}
+	if score("name", 1) != 3*score("name", 0) || score("country", 1) != score("country", 0) {
+		t.Fatalf("unexpected field boost %f %f %f %f", score("name", 1), score("name", 0), score("country", 1), score("country", 0))
+	}
+
+	m.Delete(1)
+	if len(m.fieldBoosts) != 0 {
+		t.Fatalf("expected field boosts of deleted document to be removed %v", m.fieldBoosts)
+	}
+}
+
+func TestFieldBoostsWhileIndexing(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(&fieldBoostedCity{ExampleCity: ExampleCity{Name: "Amsterdam"}, boosts: map[string]float32{"name": 3}})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			m.Index(&fieldBoostedCity{ExampleCity: ExampleCity{Name: "Rotterdam"}, boosts: map[string]float32{"name": 2}})
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		q := NewResettableQuery(iq.Or(m.Terms("name", "amsterdam")...))
+		if q.Cost() != 1 {
+			t.Fatalf("expected one match, got %d", q.Cost())
+		}
+	}
+	wg.Wait()
+}
+
+func TestMultiValueShingles(t *testing.T) {
+	shingles := analyzer.NewAnalyzer(DefaultNormalizer, DefaultSearchTokenizer, []tokenize.Tokenizer{tokenize.NewWhitespace(), tokenize.NewShingles(2)})
+	perField := map[string]*analyzer.Analyzer{"names": shingles}
+	city := &ExampleCity{ID: 1, Name: "Amsterdam", Names: []string{"Amsterdam", "Mokum", "New York", "Big Apple"}}
+
+	dir, err := ioutil.TempDir("", "shingles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d := NewDirIndex(dir, NewFDCache(10), perField)
+	defer d.Close()
+	if err := d.Index(city); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMemOnlyIndex(perField)
+	m.Index(city)
+
+	for term, expected := range map[string]int{"amsterdam": 1, "mokum": 1, "newyork": 1, "bigapple": 1, "amsterdammokum": 0, "mokumnew": 0, "yorkbig": 0} {
+		if m.DocFreq("names", term) != expected || d.DocFreq("names", term) != expected {
+			t.Fatalf("%s: expected %d got %d %d", term, expected, m.DocFreq("names", term), d.DocFreq("names", term))
+		}
+	}
+}
+
+func TestWithDefaultAnalyzer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	list := []*ExampleCity{{ID: 1, Name: "Amsterdam", Country: "NL", TestID: "AMS"}, {ID: 2, Name: "Sofia", Country: "BG", TestID: "SOF"}}
+	fuzzy := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"country": DefaultAnalyzer}, WithDefaultAnalyzer(FuzzyAnalyzer))
+	fuzzy.Index(toDocuments(list)...)
+	d := NewDirIndex(dir, NewFDCache(10), nil, WithDefaultAnalyzer(FuzzyAnalyzer))
+	defer d.Close()
+	if err := d.Index(toDocumentsID(list)...); err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := NewMemOnlyIndex(nil)
+	plain.Index(toDocuments(list)...)
+
+	if n := fuzzy.TopN(10, iq.Or(fuzzy.Terms("name", "amsterdm")...), nil).Total; n != 1 {
+		t.Fatalf("expected fuzzy match, got %d", n)
+	}
+	if n := plain.TopN(10, iq.Or(plain.Terms("name", "amsterdm")...), nil).Total; n != 0 {
+		t.Fatalf("expected the global default to be unchanged, got %d", n)
+	}
+	if fuzzy.DocFreq("country", "nl") != 1 || fuzzy.GetByID("AMS") == nil {
+		t.Fatalf("expected perField and the id field to keep their analyzers")
+	}
+
+	for _, q := range [][]iq.Query{d.Terms("name", "amsterdm"), r.Terms("name", "amsterdm")} {
+		n := 0
+		d.Foreach(iq.Or(q...), func(did int32, score float32) {
+			n++
+		})
+		if n != 1 {
+			t.Fatalf("expected fuzzy match in DirIndex, got %d", n)
+		}
+	}
+}
+
+func TestDirCheckedTerms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDirIndex(dir, NewFDCache(10), nil)
+	defer d.Close()
+	if err := d.Index(toDocumentsID([]*ExampleCity{{ID: 1, Name: "Amsterdam", Country: "NL"}})...); err != nil {
+		t.Fatal(err)
+	}
+
+	// missing term and missing field directory are no postings
+	for _, field := range []string{"name", "missing"} {
+		queries, err := d.CheckedTerms(field, "amsterdam sofia")
+		if err != nil || len(queries) != 2 {
+			t.Fatalf("%s: unexpected %v %v", field, queries, err)
+		}
+	}
+
+	// a posting file that can not be read
+	fn, _ := termFile(dir, d.DirHash, "name", "sofia")
+	if err := os.MkdirAll(fn, 0700); err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, checked := range []func(string, string) ([]iq.Query, error){d.CheckedTerms, r.CheckedTerms, d.CheckedLazyTerms, r.CheckedLazyTerms} {
+		if _, err := checked("name", "amsterdam sofia"); err == nil {
+			t.Fatalf("expected error")
+		}
+	}
+	for _, checked := range []func(string, string) (iq.Query, error){d.CheckedLazyTermQuery, r.CheckedLazyTermQuery} {
+		if _, err := checked("name", "sofia"); err == nil {
+			t.Fatalf("expected lazy error")
+		}
+		q, err := checked("name", "amsterdam")
+		if err != nil {
+			t.Fatalf("unexpected lazy error %v", err)
+		}
+		n := 0
+		d.Foreach(q, func(did int32, score float32) {
+			n++
+		})
+		if n != 1 {
+			t.Fatalf("expected the lazy query to match, got %d", n)
+		}
+		if _, err := checked("name", "paris"); err != nil {
+			t.Fatalf("unexpected lazy error %v", err)
+		}
+	}
+
+	// the unchecked queries still match nothing
+	n := 0
+	d.Foreach(iq.Or(d.Terms("name", "sofia")...), func(did int32, score float32) {
+		n++
+	})
+	if n != 0 {
+		t.Fatalf("expected no matches, got %d", n)
+	}
+}
+
+func TestConcurrentGet(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(&ExampleCity{Name: "Amsterdam", TestID: "0"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// grows and reallocates the forward slice
+		for i := 1; i < 2000; i++ {
+			m.Index(&ExampleCity{Name: "Amsterdam", TestID: fmt.Sprintf("%d", i)})
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			if m.Get(1999) == nil || m.GetByID("1999") == nil {
+				t.Fatalf("expected the last document")
+			}
+			return
+		default:
+		}
+		if d, ok := m.Get(0).(*ExampleCity); !ok || d.Name != "Amsterdam" {
+			t.Fatalf("unexpected document %v", m.Get(0))
+		}
+		if m.GetByID("0") == nil {
+			t.Fatalf("expected document 0")
+		}
+		_ = m.Get(int32(rand.Intn(2000)))
+	}
+}
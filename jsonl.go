@@ -0,0 +1,97 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// FlattenJSON converts decoded JSON object into indexable fields
+//
+// The mapping is:
+//  string          -> the value itself
+//  number          -> its textual representation (as it appears in the input if decoded with UseNumber)
+//  bool            -> "true" or "false"
+//  null            -> skipped
+//  array           -> every element is added as a separate value of the same field
+//  nested object   -> keys are joined with a dot, {"a":{"b":"x"}} becomes "a.b": ["x"]
+//
+// If idKey is not empty and differs from idField, the values of idKey are moved to idField
+func FlattenJSON(obj map[string]interface{}, idKey, idField string) MapDocument {
+	out := MapDocument{}
+	for k, v := range obj {
+		flattenJSON(out, k, v)
+	}
+
+	if idKey != "" && idKey != idField {
+		if v, ok := out[idKey]; ok {
+			out[idField] = v
+			delete(out, idKey)
+		}
+	}
+	return out
+}
+
+func flattenJSON(out MapDocument, key string, v interface{}) {
+	switch x := v.(type) {
+	case nil:
+	case string:
+		out[key] = append(out[key], x)
+	case json.Number:
+		out[key] = append(out[key], x.String())
+	case float64:
+		out[key] = append(out[key], strconv.FormatFloat(x, 'f', -1, 64))
+	case bool:
+		out[key] = append(out[key], strconv.FormatBool(x))
+	case []interface{}:
+		for _, e := range x {
+			flattenJSON(out, key, e)
+		}
+	case map[string]interface{}:
+		for k, e := range x {
+			flattenJSON(out, key+"."+k, e)
+		}
+	}
+}
+
+// IndexJSONL indexes newline delimited JSON objects, one document per line, and empty lines are skipped.
+// Every object is flattened with FlattenJSON and the value of m.JSONIDKey is used as m.IDField.
+// Documents are indexed as MapDocument
+func (m *MemOnlyIndex) IndexJSONL(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		obj, err := decodeJSONObject(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		m.Index(FlattenJSON(obj, m.JSONIDKey, m.IDField))
+	}
+	return scanner.Err()
+}
+
+func decodeJSONObject(line []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("expected json object")
+	}
+	return obj, nil
+}
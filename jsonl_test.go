@@ -0,0 +1,54 @@
+package index
+
+import (
+	"strings"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestIndexJSONL(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.JSONIDKey = "meta.key"
+
+	input := `{"name":"Amsterdam","country":"NL","meta":{"key":"ams","population":821752},"names":["Mokum","Amsterdam"]}
+
+{"name":"Sofia","country":"BG","meta":{"key":"sof","capital":true},"names":null}
+`
+	err := m.IndexJSONL(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := m.GetByID("ams")
+	if doc == nil {
+		t.Fatal("expected document")
+	}
+	fields := doc.IndexableFields()
+	if fields["meta.population"][0] != "821752" {
+		t.Fatalf("unexpected population %v", fields["meta.population"])
+	}
+	if len(fields["names"]) != 2 {
+		t.Fatalf("expected 2 names got %v", fields["names"])
+	}
+	if _, ok := fields["meta.key"]; ok {
+		t.Fatal("expected meta.key to be moved to _id")
+	}
+
+	if m.GetByID("sof").IndexableFields()["meta.capital"][0] != "true" {
+		t.Fatal("expected capital")
+	}
+
+	n := 0
+	m.Foreach(iq.Or(m.Terms("names", "mokum")...), func(did int32, score float32, doc Document) {
+		n++
+	})
+	if n != 1 {
+		t.Fatalf("expected 1 got %d", n)
+	}
+
+	err = m.IndexJSONL(strings.NewReader("{\"name\":\"x\"}\n[1,2]\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected error on line 2, got %v", err)
+	}
+}
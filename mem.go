@@ -1,9 +1,13 @@
 package index
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"sort"
+	"strings"
 	"sync"
+	"unicode/utf8"
 
 	iq "github.com/rekki/go-query"
 	analyzer "github.com/rekki/go-query-analyze"
@@ -12,21 +16,142 @@ import (
 // MemOnlyIndex is representation of an index stored in the memory
 type MemOnlyIndex struct {
 	perField map[string]*analyzer.Analyzer
-	postings map[string]map[string][]int32
-	forward  []Document
+	// the analyzers registered by DocumentWithAnalyzers for the fields no indexed document had
+	declared map[string]*analyzer.Analyzer
+	postings PostingStore
+	forward  forwardStore
+
+	// only boosts different than 1 are stored
+	boosts map[int32]float32
+
+	// number of tokens per field per document
+	fieldLen map[string]map[int32]int32
 
 	// stored twice, but just for convinience
 	forwardByID map[string]int32
-	IDField     string
+	// IDField is the field with the unique id of the documents ("_id" by default), used by GetByID, DeleteByID and IndexOrUpdate,
+	// it is analyzed with IDAnalyzer unless configured in perField. Set it before indexing
+	IDField string
+
+	// versions of the documents indexed with IndexOrUpdate
+	versionByID map[string]string
+
+	// DocumentVersion is used by IndexOrUpdate to detect unchanged documents, DefaultDocumentVersion if nil
+	DocumentVersion func(Document) string
+
+	// MaxTermLength in bytes, longer tokens are truncated both at index and search time
+	MaxTermLength int
+
+	// StoredFields, if set, makes the index keep only those fields (and the IDField) of the indexed documents
+	// as MapDocument instead of the documents themselves, which can save a lot of memory for big documents.
+	// Set it before indexing. Deleting documents is slower, as their indexed fields are unknown and all postings are scanned
+	StoredFields []string
+
+	// JSONIDKey is the (flattened) json key used as IDField by IndexJSONL
+	JSONIDKey string
+
+	// UseDocumentID makes Index use DocumentID() of documents implementing DocumentWithID as their document id
+	// (same as DirIndex) instead of the next sequential one, the forward index grows with gaps as needed.
+	// A document indexed with an already used id replaces the previous one.
+	// Set it before indexing, for sparse or very big ids see WithSparseForward
+	UseDocumentID bool
+
+	// IDF is the score of the term queries, DefaultIDF if nil
+	IDF IDFFunc
+
+	ProgressReporter
+
+	// KeepSurfaceForms makes the index remember the original text of the indexed tokens, see SurfaceForm
+	// Set it before indexing
+	KeepSurfaceForms bool
+	surface          map[string]map[string]string
+
+	// NoTokens is what Terms returns when the searched text produces no tokens (e.g. only stop words or punctuation)
+	NoTokens NoTokensPolicy
+
+	// TermLengthBoost multiplies the score of the term queries of a field by a function of the term length in runes,
+	// e.g. with AutocompleteAnalyzer every prefix is a term, so LinearLengthBoost(4) makes "a" and "am" contribute less than "amst"
+	TermLengthBoost map[string]func(length int) float32
+
+	// from WithSchemaMode
+	schema SchemaMode
+	// from WithDefaultAnalyzer, DefaultAnalyzer if nil
+	defaultAnalyzer *analyzer.Analyzer
+
+	// from WithTermVectors, nil if disabled
+	termVectors map[int32]map[string]map[string]int
+
+	// from WithMultiValueScoring, number of values of the document field the term is in (only above 1), nil if disabled
+	valueMatches map[string]map[string]map[int32]int32
+	// the terms of valueMatches per document and field, so deleting a document touches only its own terms
+	valueMatchTerms map[int32]map[string][]string
+
+	// the values of the fields changed by UpdateField per document, they override the fields of the forward document
+	updatedFields map[int32]map[string][]string
+
+	// the biggest document id, set by ShardedIndex so the global ids fit in int32, the documents that would get
+	// a bigger one are not indexed and get -1. 0 if unlimited
+	maxDocumentID int32
+
+	// boosts of the fields per document from FieldBoostedDocument, only boosts different than 1 are stored
+	fieldBoosts map[string]map[int32]float32
+
+	// number of deleted documents in the forward index, and the SetAutoCompact ratio
+	deletedSlots int
+	autoCompact  float64
+
+	// OnCompact is called with the old to new document id mapping when SetAutoCompact compacts the index
+	OnCompact func(remap map[int32]int32)
+
+	// from WithWriteBatching
+	batcher *writeBatcher
+
+	// incremented on every change of the postings, see PreparedQuery.Stale
+	generation uint64
 	sync.RWMutex
 }
 
-// NewMemOnlyIndex creates new in-memory index with the specified perField analyzer by default DefaultAnalyzer is used
-func NewMemOnlyIndex(perField map[string]*analyzer.Analyzer) *MemOnlyIndex {
-	if perField == nil {
-		perField = map[string]*analyzer.Analyzer{}
+// NewMemOnlyIndex creates new in-memory index with the specified perField analyzer by default DefaultAnalyzer is used (see WithDefaultAnalyzer)
+func NewMemOnlyIndex(perField map[string]*analyzer.Analyzer, opts ...Option) *MemOnlyIndex {
+	o := newOptions(opts)
+	if o.onInvalidAnalyzer != nil {
+		for field, a := range perField {
+			if err := ValidateAnalyzer(a); err != nil {
+				o.onInvalidAnalyzer(field, err)
+			}
+		}
+	}
+
+	// copy, so changing the caller's map does not change the analysis of the indexed documents
+	pf := map[string]*analyzer.Analyzer{}
+	for k, v := range perField {
+		pf[k] = v
+	}
+	m := &MemOnlyIndex{postings: newMemPostings(o.hint.ExpectedDocs), boosts: map[int32]float32{}, fieldLen: map[string]map[int32]int32{}, perField: pf, declared: map[string]*analyzer.Analyzer{}, forward: &denseForward{}, forwardByID: map[string]int32{}, versionByID: map[string]string{}, fieldBoosts: map[string]map[int32]float32{}, IDField: "_id", JSONIDKey: "_id", MaxTermLength: DefaultMaxTermLength}
+	if o.sparseForward {
+		m.forward = newSparseForward()
+	}
+	m.schema = o.schema
+	m.defaultAnalyzer = o.defaultAnalyzer
+	if o.termVectors {
+		m.termVectors = map[int32]map[string]map[string]int{}
+	}
+	if o.multiValueScoring {
+		m.valueMatches = map[string]map[string]map[int32]int32{}
+		m.valueMatchTerms = map[int32]map[string][]string{}
+	}
+	if o.batchWindow > 0 {
+		m.batcher = newWriteBatcher(o.batchWindow, o.batchMax)
+	}
+	if o.postingStore != nil {
+		m.postings = o.postingStore
+	}
+	if n := o.hint.ExpectedDocs; n > 0 {
+		m.forwardByID = make(map[string]int32, n)
+		if !o.sparseForward {
+			m.forward = &denseForward{docs: make([]Document, 0, n)}
+		}
 	}
-	m := &MemOnlyIndex{postings: map[string]map[string][]int32{}, perField: perField, forwardByID: map[string]int32{}, IDField: "_id"}
 	return m
 }
 
@@ -37,200 +162,728 @@ func (m *MemOnlyIndex) MergeInto(b *MemOnlyIndex) {
 	b.RLock()
 	defer b.RUnlock()
 
-	offset := int32(len(m.forward))
+	offset := int32(m.forward.size())
 
 	for k, v := range b.perField {
 		m.perField[k] = v
 	}
+	for k, v := range b.declared {
+		if _, ok := m.declared[k]; !ok {
+			m.declared[k] = v
+		}
+	}
 
-	for field, terms := range b.postings {
-		for term, ps := range terms {
-			ms := m.postings[field][term]
+	for _, field := range b.postings.Fields() {
+		b.postings.Iterate(field, func(term string, ps []int32) {
+			ms := m.postings.Get(field, term)
 			for _, docId := range ps {
 				ms = append(ms, docId+offset)
 			}
-			m.postings[field][term] = ms
-		}
+			m.postings.Set(field, term, ms)
+		})
 	}
 
 	for uuid, docId := range b.forwardByID {
 		m.forwardByID[uuid] = docId + offset
 	}
 
-	m.forward = append(m.forward, b.forward...)
+	for uuid, version := range b.versionByID {
+		m.versionByID[uuid] = version
+	}
+
+	for docId, boost := range b.boosts {
+		m.boosts[docId+offset] = boost
+	}
+
+	for field, lengths := range b.fieldLen {
+		ml, ok := m.fieldLen[field]
+		if !ok {
+			ml = map[int32]int32{}
+			m.fieldLen[field] = ml
+		}
+		for docId, n := range lengths {
+			ml[docId+offset] = n
+		}
+	}
+
+	b.forward.foreach(func(did int32, d Document) {
+		m.forward.set(did+offset, d)
+	})
+	if n := b.forward.size(); n > 0 && m.forward.size() < int(offset)+n {
+		// keep the deleted documents at the end of b, so the ids stay the same
+		m.forward.set(offset+int32(n-1), nil)
+	}
+	if m.termVectors != nil {
+		for did, tv := range b.termVectors {
+			m.termVectors[did+offset] = tv
+		}
+	}
+	for did, updated := range b.updatedFields {
+		if m.updatedFields == nil {
+			m.updatedFields = map[int32]map[string][]string{}
+		}
+		m.updatedFields[did+offset] = updated
+	}
+	m.deletedSlots += b.deletedSlots
+	for field, docs := range b.fieldBoosts {
+		mb, ok := m.fieldBoosts[field]
+		if !ok {
+			mb = map[int32]float32{}
+			m.fieldBoosts[field] = mb
+		}
+		for did, boost := range docs {
+			mb[did+offset] = boost
+		}
+	}
+	if m.valueMatches != nil {
+		for field, terms := range b.valueMatches {
+			for t, docs := range terms {
+				for did, n := range docs {
+					m.addValueMatch(field, t, did+offset, n)
+				}
+			}
+		}
+	}
+	m.generation++
 }
 
+// Get returns the document with this document id, nil if there is none, it is safe to call while indexing
 func (m *MemOnlyIndex) Get(id int32) Document {
-	return m.forward[id]
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.forward.get(id)
 }
 
+// GetByID returns the last indexed document with this id in IDField, nil if there is none
 func (m *MemOnlyIndex) GetByID(uuid string) Document {
 	m.RLock()
-	id, ok := m.forwardByID[uuid]
-	m.RUnlock()
+	defer m.RUnlock()
 
+	id, ok := m.forwardByID[m.idKey(uuid)]
 	if ok {
-		return m.forward[id]
+		return m.forward.get(id)
 	}
 	return nil
 }
 
-func (m *MemOnlyIndex) DeleteByID(uuid string) {
+// RebuildByID reconstructs the id to document id mapping used by GetByID and DeleteByID by scanning the IDField
+// of every non deleted document, in case it drifted after manual manipulation or a merge of indexes with the same ids
+// when the same id is found more than once, the biggest document id (the last indexed document) wins
+func (m *MemOnlyIndex) RebuildByID() {
 	m.Lock()
 	defer m.Unlock()
 
-	id, ok := m.forwardByID[uuid]
+	m.forwardByID = map[string]int32{}
+	m.forward.foreach(func(did int32, d Document) {
+		for _, v := range m.indexedFieldsLocked(did, d)[m.IDField] {
+			m.forwardByID[m.idKey(v)] = did
+		}
+	})
+
+	for key := range m.versionByID {
+		if _, ok := m.forwardByID[key]; !ok {
+			delete(m.versionByID, key)
+		}
+	}
+}
+
+func (m *MemOnlyIndex) DeleteByID(uuid string) {
+	m.Lock()
+	id, ok := m.forwardByID[m.idKey(uuid)]
 	if ok {
 		m.deleteLocked(id)
 	}
+	remap := m.autoCompactLocked()
+	m.Unlock()
+
+	m.afterDelete(remap)
 }
 
 func (m *MemOnlyIndex) Delete(id int32) {
 	m.Lock()
-	defer m.Unlock()
 	m.deleteLocked(id)
+	remap := m.autoCompactLocked()
+	m.Unlock()
+
+	m.afterDelete(remap)
 }
 
 func (m *MemOnlyIndex) deleteLocked(id int32) {
-	d := m.forward[id]
+	d := m.forward.get(id)
+	if d == nil {
+		return
+	}
 
-	fields := d.IndexableFields()
+	fields := m.indexedFieldsLocked(id, d)
+
+	if len(m.StoredFields) > 0 || hasReaders(d) {
+		// the forward document does not have all the indexed fields
+		for _, v := range fields[m.IDField] {
+			delete(m.forwardByID, m.idKey(v))
+			delete(m.versionByID, m.idKey(v))
+		}
+		m.deleteAllPostings(id)
+		fields = nil
+	}
 
 	for field, value := range fields {
 		if field == m.IDField {
 			for _, v := range value {
-				delete(m.forwardByID, v)
-			}
-		}
-
-		analyzer, ok := m.perField[field]
-		if !ok {
-			if field == m.IDField || field == "id" || field == "uuid" {
-				analyzer = IDAnalyzer
-			} else {
-				analyzer = DefaultAnalyzer
+				delete(m.forwardByID, m.idKey(v))
+				delete(m.versionByID, m.idKey(v))
 			}
 		}
 
+		analyzer := m.analyzerFor(field)
 		for _, v := range value {
-			tokens := analyzer.AnalyzeIndex(v)
+			tokens := m.analyzeIndex(analyzer, v)
 			for _, t := range tokens {
-				m.deletePostings(field, t, id)
+				m.postings.Delete(field, t, id)
 			}
 		}
+		delete(m.fieldLen[field], id)
 	}
 
-	m.forward[id] = nil
+	m.forward.set(id, nil)
+	delete(m.updatedFields, id)
+	delete(m.boosts, id)
+	delete(m.termVectors, id)
+	m.deleteFieldBoosts(id)
+	m.deletedSlots++
+	if m.valueMatches != nil {
+		m.deleteValueMatches(id)
+	}
+	m.generation++
 }
 
-// Index a bunch of documents
-func (m *MemOnlyIndex) Index(docs ...Document) {
+// Index a bunch of documents, returns the assigned document ids in the same order as docs.
+// In SchemaStrict mode the documents with unknown fields are not indexed and get -1, use TryIndex to get the error
+func (m *MemOnlyIndex) Index(docs ...Document) []int32 {
+	if m.batcher != nil {
+		return m.batcher.submit(docs, m.flushBatch)
+	}
+
 	m.Lock()
 	defer m.Unlock()
 
-	for _, d := range docs {
+	return m.indexAllLocked(docs)
+}
+
+func (m *MemOnlyIndex) indexAllLocked(docs []Document) []int32 {
+	out := make([]int32, len(docs))
+	for i, d := range docs {
+		if m.checkSchemaLocked([]Document{d}) != nil || !m.hasRoomLocked(d) {
+			out[i] = -1
+			continue
+		}
+		out[i] = m.indexLocked(d, d.IndexableFields())
+	}
+	return out
+}
+
+// hasRoomLocked returns false if the document would get a document id bigger than maxDocumentID
+func (m *MemOnlyIndex) hasRoomLocked(d Document) bool {
+	if m.maxDocumentID == 0 {
+		return true
+	}
+	did := int32(m.forward.size())
+	if dd, ok := d.(DocumentWithID); ok && m.UseDocumentID && dd.DocumentID() >= 0 {
+		did = dd.DocumentID()
+	}
+	return did <= m.maxDocumentID
+}
+
+// IndexOrUpdate indexes documents, replacing the already indexed documents with the same id
+// documents whose version (see DocumentVersion) did not change since they were indexed are skipped and keep their document id,
+// which makes periodic full rebuilds cheap when most of the data is static
+func (m *MemOnlyIndex) IndexOrUpdate(docs ...Document) []int32 {
+	m.Lock()
+	defer m.Unlock()
+
+	version := m.DocumentVersion
+	if version == nil {
+		version = DefaultDocumentVersion
+	}
+
+	out := make([]int32, len(docs))
+	for i, d := range docs {
+		if m.checkSchemaLocked([]Document{d}) != nil || !m.hasRoomLocked(d) {
+			out[i] = -1
+			continue
+		}
 		fields := d.IndexableFields()
-		did := len(m.forward)
-		m.forward = append(m.forward, d)
-		for field, value := range fields {
-			if field == m.IDField {
-				for _, v := range value {
-					m.forwardByID[v] = int32(did)
-				}
-			}
+		ids := fields[m.IDField]
+		if len(ids) == 0 {
+			out[i] = m.indexLocked(d, fields)
+			continue
+		}
 
-			analyzer, ok := m.perField[field]
-			if !ok {
-				if field == m.IDField || field == "id" || field == "uuid" {
-					analyzer = IDAnalyzer
-				} else {
-					analyzer = DefaultAnalyzer
-				}
+		v := version(d)
+		key := m.idKey(ids[0])
+		if existing, ok := m.forwardByID[key]; ok {
+			if m.versionByID[key] == v {
+				out[i] = existing
+				continue
 			}
+			m.deleteLocked(existing)
+		}
+		out[i] = m.indexLocked(d, fields)
+		m.versionByID[key] = v
+	}
+	return out
+}
 
-			for _, v := range value {
-				tokens := analyzer.AnalyzeIndex(v)
-				for _, t := range tokens {
-					m.addPostings(field, t, int32(did))
+func (m *MemOnlyIndex) indexLocked(d Document, fields map[string][]string) int32 {
+	if da, ok := d.(DocumentWithAnalyzers); ok {
+		m.registerAnalyzersLocked(da)
+	}
+
+	did := m.nextDocumentID(d)
+	m.forward.set(did, m.storedDocument(d, fields))
+	delete(m.updatedFields, did)
+	if bd, ok := d.(BoostedDocument); ok {
+		if boost := bd.Boost(); boost != 1 {
+			m.boosts[did] = boost
+		}
+	}
+	m.addFieldBoosts(d, did)
+	for field, value := range fields {
+		if m.schema == SchemaIgnore && !m.knownFieldLocked(d, field) {
+			continue
+		}
+		m.indexFieldLocked(did, field, value)
+	}
+	if rd, ok := d.(ReaderDocument); ok {
+		for field, r := range rd.IndexableReaders() {
+			if m.schema == SchemaIgnore && !m.knownFieldLocked(d, field) {
+				continue
+			}
+			n := int(m.fieldLen[field][did])
+			// Index can not fail, the tokens read before an error are indexed
+			_ = AnalyzeReader(m.analyzerFor(field), r, func(t string) {
+				t = truncateTerm(t, m.MaxTermLength)
+				m.postings.Add(field, t, did)
+				if m.termVectors != nil {
+					m.addTermVector(did, field, t)
 				}
+				n++
+			})
+			m.setFieldLength(field, did, n)
+		}
+	}
+	m.generation++
+	m.report(1, 0)
+	return did
+}
+
+// indexFieldLocked adds the postings (and the id, length, term vectors..) of the values of the document field
+func (m *MemOnlyIndex) indexFieldLocked(did int32, field string, value []string) {
+	if field == m.IDField {
+		for _, v := range value {
+			m.forwardByID[m.idKey(v)] = did
+			delete(m.versionByID, m.idKey(v))
+		}
+	}
+
+	analyzer := m.analyzerFor(field)
+	n := 0
+	var valueTokens [][]string
+	// the values are analyzed one by one, the tokens of different values must not be combined (see Document)
+	for _, v := range value {
+		if m.KeepSurfaceForms {
+			m.addSurfaceForms(field, analyzer, v)
+		}
+		tokens := m.analyzeIndex(analyzer, v)
+		for _, t := range tokens {
+			m.postings.Add(field, t, did)
+			if m.termVectors != nil {
+				m.addTermVector(did, field, t)
 			}
 		}
+		n += len(tokens)
+		if m.valueMatches != nil {
+			valueTokens = append(valueTokens, tokens)
+		}
+	}
+	m.setFieldLength(field, did, n)
+	if m.valueMatches != nil {
+		m.addValueMatches(field, did, valueTokens)
 	}
 }
 
-func (m *MemOnlyIndex) addPostings(k, v string, did int32) {
-	pk, ok := m.postings[k]
-	if !ok {
-		pk = map[string][]int32{}
-		m.postings[k] = pk
+// nextDocumentID returns the document id for d, the document already indexed with this id is deleted
+func (m *MemOnlyIndex) nextDocumentID(d Document) int32 {
+	if dd, ok := d.(DocumentWithID); ok && m.UseDocumentID {
+		did := dd.DocumentID()
+		if did >= 0 {
+			m.deleteLocked(did)
+			return did
+		}
+	}
+
+	return int32(m.forward.size())
+}
+
+// storedDocument is what is kept in the forward index, either the document itself or only its StoredFields
+func (m *MemOnlyIndex) storedDocument(d Document, fields map[string][]string) Document {
+	if len(m.StoredFields) == 0 {
+		return d
 	}
 
-	current, ok := pk[v]
-	if !ok || len(current) == 0 {
-		pk[v] = []int32{did}
-	} else {
-		if current[len(current)-1] != did {
-			pk[v] = append(current, did)
+	stored := MapDocument{}
+	if v, ok := fields[m.IDField]; ok {
+		stored[m.IDField] = v
+	}
+	for _, field := range m.StoredFields {
+		if v, ok := fields[field]; ok {
+			stored[field] = v
 		}
 	}
+	return stored
+}
+
+// deleteAllPostings removes the document from every posting list, used when the indexed fields of the document are not known
+func (m *MemOnlyIndex) deleteAllPostings(did int32) {
+	for _, field := range m.postings.Fields() {
+		m.postings.Iterate(field, func(term string, _ []int32) {
+			m.postings.Delete(field, term, did)
+		})
+		delete(m.fieldLen[field], did)
+	}
 }
 
-func (m *MemOnlyIndex) deletePostings(k, v string, did int32) {
-	pk, ok := m.postings[k]
+func (m *MemOnlyIndex) setFieldLength(field string, did int32, n int) {
+	lengths, ok := m.fieldLen[field]
 	if !ok {
-		return
+		lengths = map[int32]int32{}
+		m.fieldLen[field] = lengths
 	}
+	lengths[did] = int32(n)
+}
 
-	current, ok := pk[v]
-	if !ok || len(current) == 0 {
-		return
+// FieldLength returns the number of tokens the field of this document produced at index time
+func (m *MemOnlyIndex) FieldLength(did int32, field string) int {
+	m.RLock()
+	defer m.RUnlock()
+
+	return int(m.fieldLen[field][did])
+}
+
+// AverageFieldLength returns the average number of tokens in this field across the documents that have it
+func (m *MemOnlyIndex) AverageFieldLength(field string) float64 {
+	m.RLock()
+	defer m.RUnlock()
+
+	lengths := m.fieldLen[field]
+	if len(lengths) == 0 {
+		return 0
 	}
 
-	// find the index where this documentID is and cut the slice
-	found := sort.Search(len(current), func(i int) bool {
-		return current[i] >= did
-	})
+	sum := 0
+	for _, n := range lengths {
+		sum += int(n)
+	}
+	return float64(sum) / float64(len(lengths))
+}
+
+func (m *MemOnlyIndex) analyzerFor(field string) *analyzer.Analyzer {
+	if _, ok := m.perField[field]; !ok {
+		if a, ok := m.declared[field]; ok {
+			return a
+		}
+	}
+	return fieldAnalyzer(m.perField, m.IDField, m.defaultAnalyzer, field)
+}
 
-	if found < len(current) && current[found] == did {
-		pk[v] = append(current[:found], current[found+1:]...)
+// registerAnalyzersLocked registers the analyzers declared by the document for the fields that are not configured,
+// not declared yet and not in any indexed document, so the postings of a field are always analyzed with the same analyzer
+func (m *MemOnlyIndex) registerAnalyzersLocked(d DocumentWithAnalyzers) {
+	for field, a := range d.FieldAnalyzers() {
+		if a == nil || field == m.IDField {
+			continue
+		}
+		if _, ok := m.perField[field]; ok {
+			continue
+		}
+		if _, ok := m.declared[field]; ok {
+			continue
+		}
+		// the field length is kept for every indexed document with the field, until it is deleted
+		if len(m.fieldLen[field]) > 0 {
+			continue
+		}
+		m.declared[field] = a
 	}
 }
 
+// idKey is the forwardByID key of an id, the id is analyzed with the IDField analyzer
+// which is IDAnalyzer (exact match) unless configured otherwise, e.g. with CaseInsensitiveIDAnalyzer
+func (m *MemOnlyIndex) idKey(uuid string) string {
+	return strings.Join(m.analyzerFor(m.IDField).AnalyzeIndex(uuid), " ")
+}
+
+func (m *MemOnlyIndex) analyzeIndex(a *analyzer.Analyzer, s string) []string {
+	return truncateTerms(a.AnalyzeIndex(s), m.MaxTermLength)
+}
+
+// NoTokensPolicy decides what happens when the searched text produces no tokens
+type NoTokensPolicy int
+
+const (
+	// NoTokensMatchNone returns no queries, so both iq.Or and iq.And of them match nothing
+	NoTokensMatchNone NoTokensPolicy = iota
+	// NoTokensMatchAll returns a single MatchAll query
+	NoTokensMatchAll
+	// NoTokensError makes CheckedTerms return ErrNoTokens, Terms matches nothing
+	NoTokensError
+)
+
+// ErrNoTokens is returned by CheckedTerms when the searched text produces no tokens and NoTokens is NoTokensError
+var ErrNoTokens = errors.New("no tokens")
+
 // Terms generates array of queries from the tokenized term for this field, using the perField analyzer
+// if there are no tokens the result depends on NoTokens
 func (m *MemOnlyIndex) Terms(field string, term string) []iq.Query {
+	queries, _ := m.CheckedTerms(field, term)
+	return queries
+}
+
+// CheckedTerms is Terms, but returns ErrNoTokens if there are no tokens and NoTokens is NoTokensError
+//
+// Example:
+//  m.NoTokens = index.NoTokensError
+//  queries, err := m.CheckedTerms("name", "the")
+//  if errors.Is(err, index.ErrNoTokens) {
+//  	// ask the user for something more specific
+//  }
+func (m *MemOnlyIndex) CheckedTerms(field string, term string) ([]iq.Query, error) {
 	m.RLock()
 	defer m.RUnlock()
 
-	analyzer, ok := m.perField[field]
-	if !ok {
-		analyzer = DefaultAnalyzer
+	return m.checkedTermsLocked(field, term)
+}
+
+func (m *MemOnlyIndex) checkedTermsLocked(field string, term string) ([]iq.Query, error) {
+	tokens := m.searchTokensLocked(field, term)
+	if len(tokens) == 0 {
+		switch m.NoTokens {
+		case NoTokensMatchAll:
+			return []iq.Query{m.matchAllLocked()}, nil
+		case NoTokensError:
+			return []iq.Query{}, fmt.Errorf("%w: field %s, text %q", ErrNoTokens, field, term)
+		}
 	}
-	tokens := analyzer.AnalyzeSearch(term)
+
 	queries := []iq.Query{}
 	for _, t := range tokens {
-		queries = append(queries, m.NewTermQuery(field, t))
+		queries = append(queries, m.newTermQueryLocked(field, t))
 	}
-	return queries
+	return queries, nil
+}
+
+func (m *MemOnlyIndex) searchTokensLocked(field string, term string) []string {
+	return truncateTerms(m.analyzerFor(field).AnalyzeSearch(term), m.MaxTermLength)
+}
+
+// TermsMulti creates query matching any of the values, each value is analyzed separately and all of its tokens have to match,
+// the same way the values of a multi valued field are indexed
+//
+// Example:
+//  query := m.TermsMulti("names", strings.Split("amsterdam|mokum", "|"))
+func (m *MemOnlyIndex) TermsMulti(field string, values []string) iq.Query {
+	queries := []iq.Query{}
+	for _, v := range values {
+		queries = append(queries, iq.And(m.Terms(field, v)...))
+	}
+	return iq.Or(queries...)
+}
+
+// CrossFieldQuery creates OR query of the text searched in all the fields, the text is analyzed with the analyzer of each field,
+// e.g. a fuzzy name field and an exact code field, and a document matching in more fields scores higher
+//
+// Example:
+//  query := m.CrossFieldQuery([]string{"name", "code"}, "AB-12 amsterdam")
+func (m *MemOnlyIndex) CrossFieldQuery(fields []string, text string) iq.Query {
+	queries := []iq.Query{}
+	for _, field := range fields {
+		if terms := m.Terms(field, text); len(terms) > 0 {
+			queries = append(queries, iq.Or(terms...))
+		}
+	}
+	return iq.Or(queries...)
+}
+
+// WeightedTerms creates OR query of the tokenized term where every term query is additionally boosted by its idf
+// iq.Term already scores 1*idf, with the extra boost the contribution is idf^2 (as in the classic tf-idf query weight),
+// so rare query tokens dominate the ranking, e.g. "york" matters more than "city" in "new york city"
+func (m *MemOnlyIndex) WeightedTerms(field string, term string) iq.Query {
+	m.RLock()
+	defer m.RUnlock()
+
+	tokens := m.searchTokensLocked(field, term)
+	queries := []iq.Query{}
+	for _, t := range tokens {
+		df := len(m.postings.Get(field, t))
+		if df == 0 {
+			continue
+		}
+		idf := m.idfLocked(df)
+		queries = append(queries, m.newTermQueryLocked(field, t).SetBoost(idf))
+	}
+	return iq.Or(queries...)
 }
 
+// DocFreq returns the number of documents containing this (already analyzed) term in the field
+func (m *MemOnlyIndex) DocFreq(field string, term string) int {
+	m.RLock()
+	defer m.RUnlock()
+
+	return len(m.postings.Get(field, truncateTerm(term, m.MaxTermLength)))
+}
+
+// HasTerm returns true if this (already analyzed) term is indexed in the field for at least one non deleted document,
+// e.g. to tell "there is nothing for X" apart from "the filters excluded everything"
+func (m *MemOnlyIndex) HasTerm(field string, term string) bool {
+	return m.DocFreq(field, term) > 0
+}
+
+// NewTermQuery creates query of the term as indexed, the term is not analyzed (see RawTermQuery)
 func (m *MemOnlyIndex) NewTermQuery(field string, term string) iq.Query {
 	m.RLock()
 	defer m.RUnlock()
 
+	return m.newTermQueryLocked(field, term)
+}
+
+// RawTermQuery is NewTermQuery, the query of the exact indexed term without analysis, e.g. to drill down into a facet
+// whose value came from the index itself and must match verbatim, where Terms would re-tokenize it
+//
+// Example:
+//  // the facet value is an indexed term, Terms would analyze it again
+//  query := iq.And(iq.Or(m.Terms("name", text)...), m.RawTermQuery("city", facet.Term))
+func (m *MemOnlyIndex) RawTermQuery(field string, exactTerm string) iq.Query {
+	return m.NewTermQuery(field, exactTerm)
+}
+
+func (m *MemOnlyIndex) newTermQueryLocked(field string, term string) iq.Query {
+	term = truncateTerm(term, m.MaxTermLength)
 	s := fmt.Sprintf("%s:%s", field, term)
-	pk, ok := m.postings[field]
-	if !ok {
-		return iq.Term(len(m.forward), s, []int32{})
-	}
-	pv, ok := pk[term]
-	if !ok {
-		return iq.Term(len(m.forward), s, []int32{})
+	pv := m.postings.Get(field, term)
+	if pv == nil {
+		return iq.Term(m.forward.size(), s, []int32{})
 	}
 	// there are allocation in iq.Term(), so dont just defer unlock, otherwise it will be locked while term is created
-	return iq.Term(len(m.forward), s, pv)
+	var q iq.Query = iq.Term(m.forward.size(), s, pv)
+	if m.IDF != nil && len(pv) > 0 {
+		q = &idfQuery{Query: q, idf: m.IDF(len(pv), m.forward.size()), boost: 1}
+	}
+	if counts := m.valueMatches[field][term]; len(counts) > 0 {
+		q = &valueCountQuery{Query: q, counts: copyValueCounts(counts, pv)}
+	}
+	if boosts := m.fieldBoosts[field]; len(boosts) > 0 {
+		q = &fieldBoostQuery{Query: q, boosts: copyFieldBoosts(boosts, pv)}
+	}
+	if f, ok := m.TermLengthBoost[field]; ok {
+		q = &scaledQuery{Query: q, factor: f(utf8.RuneCountInString(term))}
+	}
+	return q
+}
+
+// IDFFunc computes the inverse document frequency of a term matching df of numDocs documents, the score of a term query
+type IDFFunc func(df, numDocs int) float32
+
+// DefaultIDF is log(1 + numDocs/df), the idf of iq.Term
+func DefaultIDF(df, numDocs int) float32 {
+	return float32(math.Log1p(float64(numDocs) / float64(df)))
+}
+
+func (m *MemOnlyIndex) idfLocked(df int) float32 {
+	if m.IDF != nil {
+		return m.IDF(df, m.forward.size())
+	}
+	return DefaultIDF(df, m.forward.size())
+}
+
+// idfQuery is iq.Term scored with custom idf
+type idfQuery struct {
+	iq.Query
+	idf   float32
+	boost float32
+}
+
+func (q *idfQuery) Score() float32 {
+	return q.idf * q.boost
+}
+
+func (q *idfQuery) SetBoost(b float32) iq.Query {
+	q.boost = b
+	return q
+}
+
+// MatchAll creates query matching every non deleted document with constant score of 1
+// it can be used as a base for filter only queries, e.g. iq.And(m.MatchAll(), iq.Or(m.Terms("country", "NL")...))
+func (m *MemOnlyIndex) MatchAll() iq.Query {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.matchAllLocked()
+}
+
+func (m *MemOnlyIndex) matchAllLocked() iq.Query {
+	all := []int32{}
+	m.forward.foreach(func(did int32, d Document) {
+		all = append(all, did)
+	})
+	return iq.Constant(1, iq.Term(m.forward.size(), "*", all))
+}
+
+// ExistsQuery creates query matching every document with at least one indexed token in the field, with constant score of 1
+//
+// Example:
+//  // cities with alternative names
+//  query := iq.And(iq.Or(m.Terms("country", "NL")...), m.ExistsQuery("names"))
+func (m *MemOnlyIndex) ExistsQuery(field string) iq.Query {
+	m.RLock()
+	defer m.RUnlock()
+
+	return iq.Constant(1, iq.Term(m.forward.size(), "exists("+field+")", m.existingLocked(field)))
+}
+
+// MissingQuery creates query matching every non deleted document without indexed tokens in the field, with constant score of 1
+func (m *MemOnlyIndex) MissingQuery(field string) iq.Query {
+	m.RLock()
+	defer m.RUnlock()
+
+	existing := m.existingLocked(field)
+	missing := []int32{}
+	i := 0
+	m.forward.foreach(func(did int32, d Document) {
+		for i < len(existing) && existing[i] < did {
+			i++
+		}
+		if i < len(existing) && existing[i] == did {
+			return
+		}
+		missing = append(missing, did)
+	})
+	return iq.Constant(1, iq.Term(m.forward.size(), "missing("+field+")", missing))
+}
+
+// existingLocked returns the sorted document ids with at least one token in the field
+func (m *MemOnlyIndex) existingLocked(field string) []int32 {
+	existing := []int32{}
+	for did, n := range m.fieldLen[field] {
+		if n > 0 {
+			existing = append(existing, did)
+		}
+	}
+	sort.Slice(existing, func(i, j int) bool { return existing[i] < existing[j] })
+	return existing
 }
 
-// Foreach matching document
+// Foreach matching document, the score is multiplied by the document boost (see BoostedDocument)
+// The iq queries (Term, And, Or..) match in ascending document id order, so does Foreach, use Scan to rely on it
 // Example:
 //  query := iq.And(
 //  	iq.Or(m.Terms("name", "aMS u")...),
@@ -241,13 +894,21 @@ func (m *MemOnlyIndex) NewTermQuery(field string, term string) iq.Query {
 //  	log.Printf("%v matching with score %f", city, score)
 //  })
 func (m *MemOnlyIndex) Foreach(query iq.Query, cb func(int32, float32, Document)) {
+	m.ForeachUntil(query, func(did int32, score float32, doc Document) bool {
+		cb(did, score, doc)
+		return true
+	})
+}
+
+// ForeachUntil is Foreach, but stops as soon as cb returns false, e.g. when the caller has enough documents
+func (m *MemOnlyIndex) ForeachUntil(query iq.Query, cb func(int32, float32, Document) bool) {
 	m.RLock()
 	defer m.RUnlock()
 
 	for query.Next() != iq.NO_MORE {
 		did := query.GetDocId()
 		score := query.Score()
-		doc := m.forward[did]
+		doc := m.forward.get(did)
 		if doc == nil {
 			// deleted
 			// there is a race here between m.Terms() and m.Foreach()
@@ -258,10 +919,48 @@ func (m *MemOnlyIndex) Foreach(query iq.Query, cb func(int32, float32, Document)
 			// value
 			continue
 		}
-		cb(did, score, doc)
+		if boost, ok := m.boosts[did]; ok {
+			score *= boost
+		}
+		if !cb(did, score, m.updatedDocumentLocked(did, doc)) {
+			return
+		}
+	}
+}
+
+// ForeachID is Foreach without resolving the documents, mirroring DirIndex.Foreach, e.g. to fetch them in bulk from an external store
+// the score is multiplied by the document boost, deleted documents are skipped (also by queries created before the delete)
+func (m *MemOnlyIndex) ForeachID(query iq.Query, cb func(int32, float32)) {
+	m.RLock()
+	defer m.RUnlock()
+
+	for query.Next() != iq.NO_MORE {
+		did := query.GetDocId()
+		if m.forward.get(did) == nil {
+			// deleted after the query was created, see ForeachUntil
+			continue
+		}
+		score := query.Score()
+		if boost, ok := m.boosts[did]; ok {
+			score *= boost
+		}
+		cb(did, score)
 	}
 }
 
+// Scan is Foreach, but guarantees that cb is called in strictly ascending document id order, each document at most once,
+// e.g. to merge join the results with externally sorted data. Documents a (custom) query matches out of order are skipped
+func (m *MemOnlyIndex) Scan(query iq.Query, cb func(int32, float32, Document)) {
+	last := int32(-1)
+	m.Foreach(query, func(did int32, score float32, doc Document) {
+		if did <= last {
+			return
+		}
+		last = did
+		cb(did, score, doc)
+	})
+}
+
 // TopN documents
 // The following texample gets top5 results and also check add 100 to the score of cities that have NL in the score.
 // usually the score of your search is some linear combination of f(a*text + b*popularity + c*context..)
@@ -295,41 +994,100 @@ func (m *MemOnlyIndex) Foreach(query iq.Query, cb func(int32, float32, Document)
 //    ]
 //  }
 // If the callback is null, then the original score is used (1*idf at the moment)
+// Hits with the same score are sorted by ascending document id (see HitLess)
 func (m *MemOnlyIndex) TopN(limit int, query iq.Query, cb func(int32, float32, Document) float32) *SearchResult {
+	return m.TopNBy(limit, query, cb, HitLess)
+}
+
+// HitLess is the TopN order, higher score first and ties broken by ascending document id,
+// so the results (and the pages) are reproducible
+func HitLess(a, b Hit) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.ID < b.ID
+}
+
+// TopNBy is TopN with custom order, less reports whether hit a ranks before hit b, it should break the ties (e.g. by ID)
+// Example:
+//  top := m.TopNBy(5, q, nil, func(a, b index.Hit) bool {
+//  	if a.Score != b.Score {
+//  		return a.Score > b.Score
+//  	}
+//  	return a.ID > b.ID // newest first
+//  })
+func (m *MemOnlyIndex) TopNBy(limit int, query iq.Query, cb func(int32, float32, Document) float32, less func(a, b Hit) bool) *SearchResult {
+	return m.topN(limit, query, cb, less, TopNOptions{})
+}
+
+// TopNOptions configures TopNWith
+type TopNOptions struct {
+	// MinScore drops the hits scoring below it (after the callback), 0 keeps all of them
+	MinScore float32
+	// TotalAboveMinScore counts only the hits at or above MinScore in Total, by default Total counts all matching documents
+	TotalAboveMinScore bool
+	// Transform is applied to the score of the kept hits, after the callback and the MinScore cutoff, e.g. to cap the scores for display
+	Transform func(score float32) float32
+}
+
+// TopNWith is TopN with a relevance cutoff and a score transform, instead of filtering the hits afterwards
+// Example:
+//  top := m.TopNWith(10, q, nil, index.TopNOptions{
+//  	MinScore: 0.5,
+//  	Transform: func(score float32) float32 {
+//  		return float32(math.Min(float64(score), 10))
+//  	},
+//  })
+func (m *MemOnlyIndex) TopNWith(limit int, query iq.Query, cb func(int32, float32, Document) float32, opts TopNOptions) *SearchResult {
+	return m.topN(limit, query, cb, HitLess, opts)
+}
+
+func (m *MemOnlyIndex) topN(limit int, query iq.Query, cb func(int32, float32, Document) float32, less func(a, b Hit) bool, opts TopNOptions) *SearchResult {
 	out := &SearchResult{}
 	scored := []Hit{}
+	cutoff := opts.MinScore != 0
+	countAll := !(cutoff && opts.TotalAboveMinScore)
 	m.Foreach(query, func(did int32, originalScore float32, d Document) {
-		out.Total++
-		if limit == 0 {
-			return
+		if countAll {
+			out.Total++
+			if limit == 0 {
+				return
+			}
 		}
 		score := originalScore
 		if cb != nil {
 			score = cb(did, originalScore, d)
 		}
+		if cutoff {
+			if score < opts.MinScore {
+				return
+			}
+			if !countAll {
+				out.Total++
+				if limit == 0 {
+					return
+				}
+			}
+		}
+		if opts.Transform != nil {
+			score = opts.Transform(score)
+		}
+
+		hit := Hit{Score: score, ID: did, Document: d}
 
 		// just keep the list sorted
 		// FIXME: use bounded priority queue
-		doInsert := false
-		if len(scored) < limit {
-			doInsert = true
-		} else if scored[len(scored)-1].Score < score {
-			doInsert = true
+		if len(scored) == limit && !less(hit, scored[len(scored)-1]) {
+			return
 		}
-
-		if doInsert {
-			hit := Hit{Score: score, ID: did, Document: d}
-			if len(scored) < limit {
-				scored = append(scored, hit)
-			}
-			for i := 0; i < len(scored); i++ {
-				if scored[i].Score < hit.Score {
-					copy(scored[i+1:], scored[i:])
-					scored[i] = hit
-					break
-				}
-			}
+		i := sort.Search(len(scored), func(i int) bool {
+			return less(hit, scored[i])
+		})
+		if len(scored) < limit {
+			scored = append(scored, hit)
 		}
+		copy(scored[i+1:], scored[i:])
+		scored[i] = hit
 	})
 
 	out.Hits = scored
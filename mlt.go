@@ -0,0 +1,66 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+
+	iq "github.com/rekki/go-query"
+)
+
+// MoreLikeThisTerms is the number of the most significant terms of the source document MoreLikeThis searches for
+var MoreLikeThisTerms = 25
+
+// MoreLikeThis finds up to max documents similar to the document did, e.g. for "related items"
+//
+// The fields of the source document are analyzed again (with StoredFields only the stored ones are available) unless WithTermVectors is used,
+// its MoreLikeThisTerms terms with the highest tf*idf are searched for, tf is the number of times the term is in the document.
+// Terms only the source document has are skipped, since they can not match anything else.
+// The query is Or of the terms, each boosted by its idf (as in WeightedTerms) so the documents sharing more and rarer terms score higher,
+// the source document itself is excluded
+func (m *MemOnlyIndex) MoreLikeThis(did int32, fields []string, max int) *SearchResult {
+	type significant struct {
+		field string
+		term  string
+		score float64
+	}
+
+	m.RLock()
+	d := m.forward.get(did)
+	if d == nil {
+		m.RUnlock()
+		return &SearchResult{Hits: []Hit{}}
+	}
+
+	terms := []significant{}
+	for _, field := range fields {
+		for t, n := range m.termVectorLocked(did, field) {
+			df := len(m.postings.Get(field, t))
+			if df < 2 {
+				continue
+			}
+			terms = append(terms, significant{field: field, term: t, score: float64(n) * float64(m.idfLocked(df))})
+		}
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].score != terms[j].score {
+			return terms[i].score > terms[j].score
+		}
+		if terms[i].field != terms[j].field {
+			return terms[i].field < terms[j].field
+		}
+		return terms[i].term < terms[j].term
+	})
+	if len(terms) > MoreLikeThisTerms {
+		terms = terms[:MoreLikeThisTerms]
+	}
+
+	queries := []iq.Query{}
+	for _, t := range terms {
+		queries = append(queries, m.newTermQueryLocked(t.field, t.term).SetBoost(m.idfLocked(len(m.postings.Get(t.field, t.term)))))
+	}
+	source := iq.Term(m.forward.size(), fmt.Sprintf("mlt(%d)", did), []int32{did})
+	m.RUnlock()
+
+	return m.TopN(max, iq.AndNot(source, iq.Or(queries...)), nil)
+}
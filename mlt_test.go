@@ -0,0 +1,38 @@
+package index
+
+import (
+	"testing"
+)
+
+func TestMoreLikeThis(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		MapDocument{"title": {"red wine from bordeaux"}, "tags": {"wine", "france"}},
+		MapDocument{"title": {"white wine from bordeaux"}, "tags": {"wine", "france"}},
+		MapDocument{"title": {"red wine from chile"}, "tags": {"wine"}},
+		MapDocument{"title": {"red apples from the farm"}, "tags": {"fruit"}},
+		MapDocument{"title": {"fresh bread"}, "tags": {"bakery"}},
+	)
+
+	top := m.MoreLikeThis(0, []string{"title", "tags"}, 10)
+	if top.Total != 3 || len(top.Hits) != 3 {
+		t.Fatalf("unexpected result %v", top)
+	}
+	if top.Hits[0].ID != 1 || top.Hits[1].ID != 2 || top.Hits[2].ID != 3 {
+		t.Fatalf("unexpected order %v", top.Hits)
+	}
+
+	for _, hit := range top.Hits {
+		if hit.ID == 0 {
+			t.Fatalf("expected the source document to be excluded")
+		}
+	}
+
+	if m.MoreLikeThis(4, []string{"title"}, 10).Total != 0 {
+		t.Fatalf("expected nothing like the bread")
+	}
+	m.Delete(0)
+	if len(m.MoreLikeThis(0, []string{"title"}, 10).Hits) != 0 {
+		t.Fatalf("expected nothing for deleted document")
+	}
+}
@@ -0,0 +1,116 @@
+package index
+
+import (
+	iq "github.com/rekki/go-query"
+)
+
+// WithMultiValueScoring makes the term queries of MemOnlyIndex score a document by the number of values of a multi valued field
+// the term is in, e.g. a query hitting both "Amsterdam" and "Amsterdam Centraal" of the names field scores twice as much as a
+// document with one matching name. The posting lists only record presence, so the counts (only the ones above 1) are kept aside at index time
+func WithMultiValueScoring() Option {
+	return func(o *options) {
+		o.multiValueScoring = true
+	}
+}
+
+// addValueMatches counts in how many values each token is, tokens is the analysis of every value of the field
+func (m *MemOnlyIndex) addValueMatches(field string, did int32, tokens [][]string) {
+	if len(tokens) < 2 {
+		return
+	}
+
+	counts := map[string]int32{}
+	for _, value := range tokens {
+		seen := map[string]bool{}
+		for _, t := range value {
+			if !seen[t] {
+				seen[t] = true
+				counts[t]++
+			}
+		}
+	}
+
+	for t, n := range counts {
+		if n > 1 {
+			m.addValueMatch(field, t, did, n)
+		}
+	}
+}
+
+func (m *MemOnlyIndex) addValueMatch(field string, t string, did int32, n int32) {
+	terms, ok := m.valueMatches[field]
+	if !ok {
+		terms = map[string]map[int32]int32{}
+		m.valueMatches[field] = terms
+	}
+	docs, ok := terms[t]
+	if !ok {
+		docs = map[int32]int32{}
+		terms[t] = docs
+	}
+	if _, ok := docs[did]; !ok {
+		fields, ok := m.valueMatchTerms[did]
+		if !ok {
+			fields = map[string][]string{}
+			m.valueMatchTerms[did] = fields
+		}
+		fields[field] = append(fields[field], t)
+	}
+	docs[did] = n
+}
+
+func (m *MemOnlyIndex) deleteValueMatches(did int32) {
+	for field := range m.valueMatchTerms[did] {
+		m.deleteFieldValueMatches(did, field)
+	}
+	delete(m.valueMatchTerms, did)
+}
+
+func (m *MemOnlyIndex) deleteFieldValueMatches(did int32, field string) {
+	fields := m.valueMatchTerms[did]
+	terms := m.valueMatches[field]
+	for _, t := range fields[field] {
+		docs := terms[t]
+		delete(docs, did)
+		if len(docs) == 0 {
+			delete(terms, t)
+		}
+	}
+	delete(fields, field)
+}
+
+// copyValueCounts copies the counts of the postings, the query iterates them without the index lock
+func copyValueCounts(counts map[int32]int32, postings []int32) map[int32]int32 {
+	out := map[int32]int32{}
+	if len(counts) <= len(postings) {
+		for did, n := range counts {
+			out[did] = n
+		}
+		return out
+	}
+	for _, did := range postings {
+		if n, ok := counts[did]; ok {
+			out[did] = n
+		}
+	}
+	return out
+}
+
+// valueCountQuery multiplies the score of the term by the number of values it is in
+type valueCountQuery struct {
+	iq.Query
+	counts map[int32]int32
+}
+
+func (q *valueCountQuery) Score() float32 {
+	score := q.Query.Score()
+	if n, ok := q.counts[q.Query.GetDocId()]; ok {
+		score *= float32(n)
+	}
+	return score
+}
+
+func (q *valueCountQuery) SetBoost(b float32) iq.Query {
+	q.Query.SetBoost(b)
+	return q
+}
@@ -0,0 +1,66 @@
+package index
+
+import (
+	"sync"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestMultiValueScoring(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		opts := []Option{}
+		if enabled {
+			opts = append(opts, WithMultiValueScoring())
+		}
+		m := NewMemOnlyIndex(nil, opts...)
+		m.Index(
+			&ExampleCity{Names: []string{"Amsterdam", "Mokum"}},
+			&ExampleCity{Names: []string{"Amsterdam", "Amsterdam Centraal", "Mokum Amsterdam"}},
+		)
+
+		scores := map[int32]float32{}
+		m.Foreach(iq.Or(m.Terms("names", "amsterdam")...), func(did int32, score float32, doc Document) {
+			scores[did] = score
+		})
+		expected := float32(1)
+		if enabled {
+			expected = 3
+		}
+		if len(scores) != 2 || scores[1] != expected*scores[0] {
+			t.Fatalf("enabled %v: unexpected scores %v", enabled, scores)
+		}
+
+		if enabled {
+			m.Delete(1)
+			m.Index(&ExampleCity{Names: []string{"Amsterdam"}})
+			if len(m.valueMatches["names"]["amsterdam"]) != 0 {
+				t.Fatalf("expected counts of deleted document to be removed %v", m.valueMatches)
+			}
+			if len(m.valueMatchTerms) != 0 {
+				t.Fatalf("expected terms of deleted document to be removed %v", m.valueMatchTerms)
+			}
+		}
+	}
+}
+
+func TestMultiValueScoringWhileIndexing(t *testing.T) {
+	m := NewMemOnlyIndex(nil, WithMultiValueScoring())
+	m.Index(&ExampleCity{Names: []string{"Amsterdam", "Amsterdam Centraal"}})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			m.Index(&ExampleCity{Names: []string{"Amsterdam", "Amsterdam Zuid"}})
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		q := NewResettableQuery(iq.Or(m.Terms("names", "amsterdam")...))
+		if q.Cost() == 0 {
+			t.Fatalf("expected matches")
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,65 @@
+package index
+
+import (
+	"strings"
+
+	unorm "golang.org/x/text/unicode/norm"
+)
+
+// UnicodeNormalize converts the text to a Unicode normalization form, so the composed and the decomposed forms
+// of the same text (e.g. "é" as one code point and as "e" followed by a combining accent) become the same string.
+// NFC and NFD compose or decompose only, NFKC and NFKD also replace the compatibility characters (ligatures, full width letters, superscripts..)
+// Put it first in the normalizers, before unaccenting and lowercasing
+//
+// Example:
+//  []norm.Normalizer{index.NewUnicodeNormalize(unorm.NFKC), norm.NewLowerCase()}
+//  // "ｃａｆｅ́" -> "café"
+type UnicodeNormalize struct {
+	form unorm.Form
+}
+
+// NewUnicodeNormalize creates UnicodeNormalize normalizer to the form (norm.NFC, norm.NFKC.. of golang.org/x/text/unicode/norm)
+func NewUnicodeNormalize(form unorm.Form) *UnicodeNormalize {
+	return &UnicodeNormalize{form: form}
+}
+
+func (u *UnicodeNormalize) Apply(s string) string {
+	return u.form.String(s)
+}
+
+// LowerCaseASCII lowercases the ASCII letters A-Z only, the other characters are kept as they are.
+// norm.NewLowerCase (strings.ToLower) does full Unicode lowercasing, which is about twice slower on text with non-ASCII characters
+// (on pure ASCII text both are about the same, and the whole analysis costs much more than the lowercasing) and can surprise,
+// e.g. the Turkish "İ" becomes "i̇". LowerCaseASCII has no such surprises and does not allocate for text that is already lowercase,
+// but "ÉCOLE" becomes "École", so use it for (mostly) ASCII data or after Unaccent, which leaves only ASCII letters of latin text
+//
+// Example:
+//  []norm.Normalizer{norm.NewUnaccent(), index.NewLowerCaseASCII(), norm.NewRemoveNonAlphanumeric()}
+type LowerCaseASCII struct{}
+
+// NewLowerCaseASCII creates LowerCaseASCII normalizer
+func NewLowerCaseASCII() *LowerCaseASCII {
+	return &LowerCaseASCII{}
+}
+
+func (l *LowerCaseASCII) Apply(s string) string {
+	i := 0
+	for i < len(s) && (s[i] < 'A' || s[i] > 'Z') {
+		i++
+	}
+	if i == len(s) {
+		return s
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(s))
+	sb.WriteString(s[:i])
+	for ; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
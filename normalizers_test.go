@@ -0,0 +1,127 @@
+package index
+
+import (
+	"strings"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+	analyzer "github.com/rekki/go-query-analyze"
+	norm "github.com/rekki/go-query-analyze/normalize"
+	tokenize "github.com/rekki/go-query-analyze/tokenize"
+	unorm "golang.org/x/text/unicode/norm"
+)
+
+func TestUnicodeNormalize(t *testing.T) {
+	composed := "café"
+	decomposed := "café"
+	if composed == decomposed {
+		t.Fatal("expected different strings")
+	}
+
+	for input, expected := range map[string]string{
+		composed:   composed,
+		decomposed: composed,
+		"ｃａｆｅ́":    composed,
+		"ﬁx²":      "fix2",
+	} {
+		if got := NewUnicodeNormalize(unorm.NFKC).Apply(input); got != expected {
+			t.Fatalf("%q: expected %q got %q", input, expected, got)
+		}
+	}
+	if got := NewUnicodeNormalize(unorm.NFC).Apply("ﬁx"); got != "ﬁx" {
+		t.Fatalf("expected NFC to keep the ligature, got %q", got)
+	}
+
+	exact := analyzer.NewAnalyzer([]norm.Normalizer{NewUnicodeNormalize(unorm.NFC)}, DefaultSearchTokenizer, DefaultIndexTokenizer)
+	id := analyzer.NewAnalyzer([]norm.Normalizer{NewUnicodeNormalize(unorm.NFC), norm.NewTrim(" "), norm.NewLowerCase()}, []tokenize.Tokenizer{tokenize.NewNoop()}, []tokenize.Tokenizer{tokenize.NewNoop()})
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"exact": exact, "name": UnicodeAnalyzer, "_id": id})
+	m.Index(
+		MapDocument{"_id": {decomposed}, "exact": {decomposed}, "name": {"ｃａｆｅ"}},
+		MapDocument{"_id": {"cafe"}, "exact": {"cafe"}, "name": {"bar"}},
+	)
+	for field, text := range map[string]string{"exact": composed, "name": "CAFE"} {
+		top := m.TopN(10, iq.Or(m.Terms(field, text)...), nil)
+		if top.Total != 1 || top.Hits[0].ID != 0 {
+			t.Fatalf("%s: unexpected result %v", field, top)
+		}
+	}
+	if m.GetByID(composed) == nil || m.GetByID("CAFÉ") == nil {
+		t.Fatalf("expected the decomposed id to be found by the composed one")
+	}
+
+	// the defaults are unchanged, existing indexes keep their terms
+	for _, n := range DefaultNormalizer {
+		if _, ok := n.(*UnicodeNormalize); ok {
+			t.Fatalf("expected DefaultNormalizer without UnicodeNormalize")
+		}
+	}
+	if got := CaseInsensitiveIDAnalyzer.AnalyzeIndex(decomposed); got[0] != decomposed {
+		t.Fatalf("expected CaseInsensitiveIDAnalyzer to keep the id as it is, got %q", got[0])
+	}
+}
+
+func TestLowerCaseASCII(t *testing.T) {
+	for input, expected := range map[string]string{
+		"":               "",
+		"amsterdam":      "amsterdam",
+		"AMSTERDAM 2019": "amsterdam 2019",
+		"ÉCOLE":          "École",
+		"İstanbul":       "İstanbul",
+		"Über":           "Über",
+	} {
+		if got := NewLowerCaseASCII().Apply(input); got != expected {
+			t.Fatalf("%q: expected %q got %q", input, expected, got)
+		}
+	}
+
+	a := analyzer.NewAnalyzer(asciiNormalizer, DefaultSearchTokenizer, DefaultIndexTokenizer)
+	for _, text := range []string{"Amsterdam University 2019", "ÉCOLE Café", "New-York"} {
+		if strings.Join(a.AnalyzeIndex(text), " ") != strings.Join(DefaultAnalyzer.AnalyzeIndex(text), " ") {
+			t.Fatalf("%q: expected the default analysis, got %v", text, a.AnalyzeIndex(text))
+		}
+	}
+}
+
+// asciiNormalizer is DefaultNormalizer with ASCII lowercasing, after Unaccent
+var asciiNormalizer = []norm.Normalizer{
+	NewUnicodeNormalize(unorm.NFKC),
+	norm.NewUnaccent(),
+	NewLowerCaseASCII(),
+	norm.NewSpaceBetweenDigits(),
+	norm.NewRemoveNonAlphanumeric(),
+	norm.NewTrim(" "),
+}
+
+func benchmarkIndexNormalizer(b *testing.B, normalizer []norm.Normalizer) {
+	a := analyzer.NewAnalyzer(normalizer, DefaultSearchTokenizer, DefaultIndexTokenizer)
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"name": a, "country": a})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Index(&ExampleCity{Name: "Amsterdam University Of Applied Sciences", Country: "The Netherlands"})
+	}
+}
+
+func BenchmarkIndexLowerCase(b *testing.B) {
+	benchmarkIndexNormalizer(b, DefaultNormalizer)
+}
+
+func BenchmarkIndexLowerCaseASCII(b *testing.B) {
+	benchmarkIndexNormalizer(b, asciiNormalizer)
+}
+
+func BenchmarkLowerCase(b *testing.B) {
+	l := norm.NewLowerCase()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = l.Apply("Zürich Hauptbahnhof, Bahnhofstrasse 1")
+	}
+}
+
+func BenchmarkLowerCaseASCII(b *testing.B) {
+	l := NewLowerCaseASCII()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = l.Apply("Zürich Hauptbahnhof, Bahnhofstrasse 1")
+	}
+}
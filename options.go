@@ -0,0 +1,82 @@
+package index
+
+import (
+	"time"
+
+	analyzer "github.com/rekki/go-query-analyze"
+)
+
+// Option configures an index when it is created
+type Option func(*options)
+
+type options struct {
+	onInvalidAnalyzer  func(field string, err error)
+	sparseForward      bool
+	hint               IndexHint
+	schema             SchemaMode
+	batchWindow        time.Duration
+	batchMax           int
+	termVectors        bool
+	multiValueScoring  bool
+	onAnalyzerMismatch func(field string, err error)
+	postingStore       PostingStore
+	defaultAnalyzer    *analyzer.Analyzer
+	readFDs            int
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAnalyzerValidation validates the perField analyzers (see ValidateAnalyzer) when the index is created
+// and calls fn for every invalid one, fn can log the problem or panic to refuse the configuration
+//
+// Example:
+//  m := index.NewMemOnlyIndex(perField, index.WithAnalyzerValidation(func(field string, err error) {
+//  	log.Printf("field %s: %v", field, err)
+//  }))
+func WithAnalyzerValidation(fn func(field string, err error)) Option {
+	return func(o *options) {
+		o.onInvalidAnalyzer = fn
+	}
+}
+
+// WithSparseForward stores the documents of MemOnlyIndex in a map by document id instead of a slice,
+// use it with UseDocumentID when the ids are sparse or very big (e.g. in the billions), as the slice
+// would allocate space for every id up to the biggest one. The map costs more per document and per lookup,
+// and MatchAll has to sort the ids, so with dense ids the default slice is faster and smaller
+func WithSparseForward() Option {
+	return func(o *options) {
+		o.sparseForward = true
+	}
+}
+
+// IndexHint describes the expected size of the index, so it can size its structures up front
+type IndexHint struct {
+	// ExpectedDocs is the number of documents that will be indexed
+	ExpectedDocs int
+}
+
+// WithIndexHint preallocates the forward index and the id map of MemOnlyIndex for hint.ExpectedDocs documents,
+// and grows the posting lists by doubling them (up to ExpectedDocs) instead of the append growth, cutting
+// the reallocations and copying of the big posting lists during bulk indexing
+func WithIndexHint(hint IndexHint) Option {
+	return func(o *options) {
+		o.hint = hint
+	}
+}
+
+// WithDefaultAnalyzer sets the analyzer of the fields not configured in perField (nor the IDField) for this index only,
+// instead of the package DefaultAnalyzer, which is shared by every index in the process and should not be changed
+//
+// Example:
+//  m := index.NewMemOnlyIndex(perField, index.WithDefaultAnalyzer(index.FuzzyAnalyzer))
+func WithDefaultAnalyzer(a *analyzer.Analyzer) Option {
+	return func(o *options) {
+		o.defaultAnalyzer = a
+	}
+}
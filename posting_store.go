@@ -0,0 +1,149 @@
+package index
+
+import "sort"
+
+// PostingStore keeps the posting lists of a MemOnlyIndex, the ascending document ids of every analyzed term of every field,
+// the index does the analysis and the querying on top of it. The index calls it under its own lock (the reads under the read lock),
+// so it only has to be safe for concurrent reads. The default keeps maps in memory, see WithPostingStore
+type PostingStore interface {
+	// Add adds did to the postings of the term, keeping them ascending and without duplicates
+	Add(field, term string, did int32)
+	// Delete removes did from the postings of the term
+	Delete(field, term string, did int32)
+	// Get returns the postings of the term, nil if there are none. The index does not modify them,
+	// the term queries read them until they are exhausted
+	Get(field, term string) []int32
+	// Set replaces the postings of the term, empty postings remove the term, and the field if it has no terms left
+	Set(field, term string, postings []int32)
+	// Fields returns the fields with terms, in any order
+	Fields() []string
+	// Iterate calls cb for every term of the field, in any order, the postings of a term can be empty after Delete.
+	// cb can Delete from the postings it is called with, Compact renumbers them in place and Sets them back
+	Iterate(field string, cb func(term string, postings []int32))
+}
+
+// WithPostingStore makes MemOnlyIndex keep its postings in store, e.g. to try another storage without forking the index.
+// The store must be empty, WithIndexHint does not apply to it
+//
+// Example:
+//  m := index.NewMemOnlyIndex(perField, index.WithPostingStore(myBoltStore))
+func WithPostingStore(store PostingStore) Option {
+	return func(o *options) {
+		o.postingStore = store
+	}
+}
+
+// memPostings is the default PostingStore
+type memPostings struct {
+	postings map[string]map[string][]int32
+
+	// from IndexHint, 0 if unknown
+	expectedDocs int
+}
+
+func newMemPostings(expectedDocs int) *memPostings {
+	return &memPostings{postings: map[string]map[string][]int32{}, expectedDocs: expectedDocs}
+}
+
+func (s *memPostings) Add(k, v string, did int32) {
+	pk, ok := s.postings[k]
+	if !ok {
+		pk = map[string][]int32{}
+		s.postings[k] = pk
+	}
+
+	current, ok := pk[v]
+	if !ok || len(current) == 0 {
+		pk[v] = []int32{did}
+	} else {
+		last := current[len(current)-1]
+		if last < did {
+			if len(current) == cap(current) && s.expectedDocs > len(current) {
+				// double up to the expected number of documents, append grows big slices by 1.25x only
+				grown := make([]int32, len(current), min2(2*len(current), s.expectedDocs))
+				copy(grown, current)
+				current = grown
+			}
+			pk[v] = append(current, did)
+		} else if last > did {
+			// only with UseDocumentID, keep the postings sorted
+			found := sort.Search(len(current), func(i int) bool {
+				return current[i] >= did
+			})
+			if current[found] != did {
+				// copy, as Delete
+				postings := make([]int32, 0, len(current)+1)
+				postings = append(postings, current[:found]...)
+				postings = append(postings, did)
+				pk[v] = append(postings, current[found:]...)
+			}
+		}
+	}
+}
+
+func min2(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (s *memPostings) Delete(k, v string, did int32) {
+	pk, ok := s.postings[k]
+	if !ok {
+		return
+	}
+
+	current, ok := pk[v]
+	if !ok || len(current) == 0 {
+		return
+	}
+
+	// find the index where this documentID is and cut the slice
+	found := sort.Search(len(current), func(i int) bool {
+		return current[i] >= did
+	})
+
+	if found < len(current) && current[found] == did {
+		// copy, the term queries created before the delete are still reading current
+		postings := make([]int32, 0, len(current)-1)
+		postings = append(postings, current[:found]...)
+		pk[v] = append(postings, current[found+1:]...)
+	}
+}
+
+func (s *memPostings) Get(field, term string) []int32 {
+	return s.postings[field][term]
+}
+
+func (s *memPostings) Set(field, term string, postings []int32) {
+	pk, ok := s.postings[field]
+	if len(postings) == 0 {
+		if ok {
+			delete(pk, term)
+			if len(pk) == 0 {
+				delete(s.postings, field)
+			}
+		}
+		return
+	}
+	if !ok {
+		pk = map[string][]int32{}
+		s.postings[field] = pk
+	}
+	pk[term] = postings
+}
+
+func (s *memPostings) Fields() []string {
+	out := make([]string, 0, len(s.postings))
+	for field := range s.postings {
+		out = append(out, field)
+	}
+	return out
+}
+
+func (s *memPostings) Iterate(field string, cb func(term string, postings []int32)) {
+	for term, postings := range s.postings[field] {
+		cb(term, postings)
+	}
+}
@@ -0,0 +1,72 @@
+package index
+
+import (
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+// postingTerms returns the terms of the field with their postings
+func postingTerms(m *MemOnlyIndex, field string) map[string][]int32 {
+	out := map[string][]int32{}
+	m.postings.Iterate(field, func(term string, postings []int32) {
+		out[term] = postings
+	})
+	return out
+}
+
+// countingStore is the default store counting the calls
+type countingStore struct {
+	*memPostings
+	adds    int
+	deletes int
+}
+
+func (s *countingStore) Add(field, term string, did int32) {
+	s.adds++
+	s.memPostings.Add(field, term, did)
+}
+
+func (s *countingStore) Delete(field, term string, did int32) {
+	s.deletes++
+	s.memPostings.Delete(field, term, did)
+}
+
+func TestPostingStore(t *testing.T) {
+	store := &countingStore{memPostings: newMemPostings(0)}
+	m := NewMemOnlyIndex(nil, WithPostingStore(store))
+	m.Index(
+		&ExampleCity{Name: "Amsterdam", Country: "NL"},
+		&ExampleCity{Name: "Sofia", Country: "NL"},
+		&ExampleCity{Name: "Amsterdam", Country: "NL"},
+	)
+	if store.adds == 0 || len(store.Get("country", "nl")) != 3 {
+		t.Fatalf("expected the postings in the store, %d adds", store.adds)
+	}
+
+	top := m.TopN(10, iq.Or(m.Terms("name", "amsterdam")...), nil)
+	if top.Total != 2 || top.Hits[0].ID != 0 || top.Hits[1].ID != 2 {
+		t.Fatalf("unexpected result %v", top)
+	}
+
+	m.Delete(0)
+	if store.deletes == 0 || len(store.Get("name", "amsterdam")) != 1 {
+		t.Fatalf("expected the postings deleted from the store")
+	}
+
+	m.Compact()
+	if ps := store.Get("name", "amsterdam"); len(ps) != 1 || ps[0] != 1 {
+		t.Fatalf("expected remapped postings, got %v", ps)
+	}
+	if stats := m.PostingStats()["country"]; stats.Postings != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	store.Set("name", "amsterdam", nil)
+	store.Set("name", "sofia", nil)
+	for _, field := range store.Fields() {
+		if field == "name" {
+			t.Fatalf("expected empty postings to remove the field, got %v", store.Fields())
+		}
+	}
+}
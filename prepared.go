@@ -0,0 +1,119 @@
+package index
+
+import (
+	iq "github.com/rekki/go-query"
+)
+
+// PreparedQuery is a query compiled once with Compile and executed many times, see Compile
+type PreparedQuery struct {
+	m          *MemOnlyIndex
+	query      *ResettableQuery
+	generation uint64
+}
+
+// Compile runs the query once and keeps its matching document ids and scores, so executing it again does not analyze the text,
+// look up the postings or build the query structure. It is meant for a fixed set of very frequent queries.
+//
+// The matches are a snapshot of the postings at compile time: documents indexed (or updated) after Compile are not matched,
+// deleted documents are skipped by Execute, and Stale reports if the index changed since, in which case the query should be compiled again
+//
+// Example:
+//  top := m.Compile(iq.Or(m.Terms("name", "amsterdam")...))
+//  ...
+//  if top.Stale() {
+//  	top = m.Compile(iq.Or(m.Terms("name", "amsterdam")...))
+//  }
+//  top.Execute(func(did int32, score float32, doc index.Document) {
+//  	...
+//  })
+func (m *MemOnlyIndex) Compile(query iq.Query) *PreparedQuery {
+	m.RLock()
+	defer m.RUnlock()
+
+	return &PreparedQuery{m: m, query: NewResettableQuery(query), generation: m.generation}
+}
+
+// Execute calls cb for every document matched at compile time that is not deleted, same as Foreach, it is safe to call concurrently
+func (p *PreparedQuery) Execute(cb func(int32, float32, Document)) {
+	query := *p.query
+	query.Reset()
+	p.m.Foreach(&query, cb)
+}
+
+// TopN executes the query and returns the top documents, same as MemOnlyIndex.TopN
+func (p *PreparedQuery) TopN(limit int, cb func(int32, float32, Document) float32) *SearchResult {
+	query := *p.query
+	query.Reset()
+	return p.m.TopN(limit, &query, cb)
+}
+
+// Stale returns true if documents were indexed or deleted since the query was compiled
+func (p *PreparedQuery) Stale() bool {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	return p.m.generation != p.generation
+}
+
+// Len is the number of documents matched at compile time
+func (p *PreparedQuery) Len() int {
+	return len(p.query.dids)
+}
+
+// Cursor iterates the documents of a compiled query in ascending document id order and can resume from a position,
+// e.g. a paginated scan keeps Position between requests and resumes with Advance, without walking the earlier documents
+//
+// Example:
+//  c := p.Cursor()
+//  c.Advance(resumeFrom) // 0 for the first page
+//  next := c.Page(100, func(did int32, score float32, doc index.Document) {
+//  	...
+//  })
+//  // next is iq.NO_MORE at the end, otherwise the position of the next page
+type Cursor struct {
+	p     *PreparedQuery
+	query ResettableQuery
+}
+
+// Cursor creates a cursor before the first document of the query
+func (p *PreparedQuery) Cursor() *Cursor {
+	c := &Cursor{p: p, query: *p.query}
+	c.query.Reset()
+	return c
+}
+
+// Advance positions the cursor on the first matching document with id >= target and returns its id, or iq.NO_MORE
+func (c *Cursor) Advance(target int32) int32 {
+	return c.query.Advance(target)
+}
+
+// Position is the document id the cursor is on, iq.NOT_READY before the first Advance or Page, iq.NO_MORE at the end
+func (c *Cursor) Position() int32 {
+	return c.query.GetDocId()
+}
+
+// Page calls cb for up to n documents starting at the current position (or the first document),
+// deleted documents are skipped and not counted, and returns the position of the next page
+func (c *Cursor) Page(n int, cb func(int32, float32, Document)) int32 {
+	m := c.p.m
+	m.RLock()
+	defer m.RUnlock()
+
+	did := c.query.GetDocId()
+	if did == iq.NOT_READY {
+		did = c.query.Next()
+	}
+	for ; n > 0 && did != iq.NO_MORE; did = c.query.Next() {
+		doc := m.forward.get(did)
+		if doc == nil {
+			continue
+		}
+		score := c.query.Score()
+		if boost, ok := m.boosts[did]; ok {
+			score *= boost
+		}
+		cb(did, score, m.updatedDocumentLocked(did, doc))
+		n--
+	}
+	return did
+}
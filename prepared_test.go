@@ -0,0 +1,86 @@
+package index
+
+import (
+	"sync"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestCompile(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{Name: "Amsterdam", Country: "NL"},
+		&ExampleCity{Name: "Sofia", Country: "BG"},
+		&ExampleCity{Name: "Amsterdam", Country: "NL"},
+	)
+
+	p := m.Compile(iq.Or(m.Terms("name", "amsterdam")...))
+	if p.Len() != 2 || p.Stale() {
+		t.Fatalf("unexpected compiled query %d %v", p.Len(), p.Stale())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dids := []int32{}
+			p.Execute(func(did int32, score float32, doc Document) {
+				dids = append(dids, did)
+			})
+			if len(dids) != 2 || dids[0] != 0 || dids[1] != 2 {
+				t.Errorf("unexpected matching %v", dids)
+			}
+		}()
+	}
+	wg.Wait()
+
+	m.Index(&ExampleCity{Name: "Amsterdam", Country: "NL"})
+	if !p.Stale() {
+		t.Fatalf("expected stale query after indexing")
+	}
+	if top := p.TopN(10, nil); top.Total != 2 {
+		t.Fatalf("expected the compile time snapshot, got %d", top.Total)
+	}
+
+	m.Delete(0)
+	if top := p.TopN(10, nil); top.Total != 1 || top.Hits[0].ID != 2 {
+		t.Fatalf("expected deleted document to be skipped, got %+v", top)
+	}
+
+	p = m.Compile(iq.Or(m.Terms("name", "amsterdam")...))
+	if p.Stale() || p.Len() != 2 {
+		t.Fatalf("unexpected recompiled query %d", p.Len())
+	}
+}
+
+func TestCursor(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	for i := 0; i < 10; i++ {
+		m.Index(&ExampleCity{Name: "Amsterdam"})
+	}
+	m.Delete(3)
+	p := m.Compile(iq.Or(m.Terms("name", "amsterdam")...))
+
+	pages := [][]int32{}
+	next := int32(0)
+	for next != iq.NO_MORE {
+		// a new cursor for every page, as if resumed in a later request
+		c := p.Cursor()
+		c.Advance(next)
+		page := []int32{}
+		next = c.Page(4, func(did int32, score float32, doc Document) {
+			page = append(page, did)
+		})
+		pages = append(pages, page)
+	}
+	if len(pages) != 3 || len(pages[0]) != 4 || pages[0][3] != 4 || pages[1][0] != 5 || len(pages[2]) != 1 || pages[2][0] != 9 {
+		t.Fatalf("unexpected pages %v", pages)
+	}
+
+	c := p.Cursor()
+	if c.Position() != iq.NOT_READY || c.Advance(3) != 4 || c.Position() != 4 || c.Advance(100) != iq.NO_MORE {
+		t.Fatalf("unexpected positions")
+	}
+}
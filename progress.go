@@ -0,0 +1,57 @@
+package index
+
+import (
+	"sync"
+	"time"
+)
+
+// Progress of a long index build, see ProgressReporter
+type Progress struct {
+	// Documents indexed so far
+	Documents int `json:"documents"`
+	// Elapsed since the first indexed document
+	Elapsed time.Duration `json:"elapsed"`
+	// BytesWritten to the posting files so far, DirIndex only
+	BytesWritten int64 `json:"bytes_written"`
+}
+
+// ProgressReporter calls OnProgress every ProgressEvery (by default 10000) indexed documents, nothing is tracked if OnProgress is nil
+// MemOnlyIndex calls it while it is locked, so OnProgress must not use the index
+//
+// Example:
+//  m.OnProgress = func(p index.Progress) {
+//  	log.Printf("indexed %d documents in %s", p.Documents, p.Elapsed)
+//  }
+type ProgressReporter struct {
+	OnProgress    func(Progress)
+	ProgressEvery int
+
+	start     time.Time
+	documents int
+	bytes     int64
+	mu        sync.Mutex
+}
+
+func (p *ProgressReporter) report(documents int, bytes int64) {
+	if p.OnProgress == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+	every := p.ProgressEvery
+	if every < 1 {
+		every = 10000
+	}
+
+	before := p.documents
+	p.documents += documents
+	p.bytes += bytes
+	if p.documents/every > before/every {
+		p.OnProgress(Progress{Documents: p.documents, Elapsed: time.Since(p.start), BytesWritten: p.bytes})
+	}
+}
@@ -0,0 +1,339 @@
+package index
+
+import (
+	"reflect"
+	"sort"
+
+	iq "github.com/rekki/go-query"
+)
+
+// DisMax creates disjunction-max query, the score of a document is the max score of the matching sub queries plus tieBreaker times the sum of the rest
+// useful when the same text is searched across multiple fields and matching in many fields should not be over rewarded (as with iq.Or)
+// it is the iq.DisMax query, exposed here so the index helpers can be used together with it
+//
+// Example:
+//  query := index.DisMax(0.1,
+//  	iq.Or(m.Terms("name", "amsterdam")...),
+//  	iq.Or(m.Terms("names", "amsterdam")...),
+//  )
+func DisMax(tieBreaker float32, queries ...iq.Query) iq.Query {
+	return iq.DisMax(tieBreaker, queries...)
+}
+
+// EstimateCost returns how many postings the query will walk through before it is exhausted: for a term query it is the length
+// of its posting list, for Or (and DisMax) the sum of its clauses, and for And the cost of its cheapest clause, since the intersection
+// is driven by it (the AndNot exclusion is not counted). Call it before iterating the query, it can be used to reject or reorder pathological queries.
+func EstimateCost(query iq.Query) int {
+	cost, _ := walkQuery(reflect.ValueOf(query), nil)
+	return cost
+}
+
+// QueryTerm is a term query of a query with the length of its posting list
+type QueryTerm struct {
+	// Term is the name of the term query, e.g. "name:amsterdam", empty for the lazy term queries of DirIndex
+	Term    string
+	DocFreq int
+}
+
+// QueryTerms returns the term queries of the query (including the AndNot exclusions) with their document frequency,
+// e.g. to put the rarest term first, call it before iterating the query
+//
+// Example:
+//  for _, t := range index.QueryTerms(query) {
+//  	log.Printf("%s matches %d documents", t.Term, t.DocFreq)
+//  }
+func QueryTerms(query iq.Query) []QueryTerm {
+	_, terms := walkQuery(reflect.ValueOf(query), []QueryTerm{})
+	return terms
+}
+
+var (
+	queryType       = reflect.TypeOf((*iq.Query)(nil)).Elem()
+	queryPackage    = reflect.TypeOf(iq.Term(1, "", nil)).Elem().PkgPath()
+	resettableQuery = reflect.TypeOf(ResettableQuery{})
+)
+
+// walkQuery returns the cost of the query and appends its terms, iq does not export the clauses of its queries,
+// so they are read with reflection
+func walkQuery(v reflect.Value, terms []QueryTerm) (int, []QueryTerm) {
+	top := v
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, terms
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0, terms
+	}
+
+	t := v.Type()
+	switch {
+	case t == resettableQuery:
+		df := v.FieldByName("dids").Len()
+		return df, append(terms, QueryTerm{Term: v.FieldByName("name").String(), DocFreq: df})
+	case t.PkgPath() == queryPackage && t.Name() == "termQuery":
+		df := v.FieldByName("postings").Len()
+		return df, append(terms, QueryTerm{Term: v.FieldByName("term").String(), DocFreq: df})
+	case t.PkgPath() == queryPackage && t.Name() == "fileTerm":
+		df := int(v.FieldByName("n").Int())
+		return df, append(terms, QueryTerm{DocFreq: df})
+	case t.PkgPath() == queryPackage && t.Name() == "andQuery":
+		clauses := v.FieldByName("queries")
+		cost := 0
+		for i := 0; i < clauses.Len(); i++ {
+			c, more := walkQuery(clauses.Index(i), terms)
+			terms = more
+			if i == 0 || c < cost {
+				cost = c
+			}
+		}
+		_, terms = walkQuery(v.FieldByName("not"), terms)
+		return cost, terms
+	case t.PkgPath() == queryPackage && (t.Name() == "orQuery" || t.Name() == "disMaxQuery"):
+		clauses := v.FieldByName("queries")
+		cost := 0
+		for i := 0; i < clauses.Len(); i++ {
+			c, more := walkQuery(clauses.Index(i), terms)
+			terms = more
+			cost += c
+		}
+		return cost, terms
+	}
+
+	// the wrappers (boosts, scores, constant) of one query
+	for i := 0; i < t.NumField(); i++ {
+		if ft := t.Field(i).Type; ft == queryType || (ft.Kind() == reflect.Ptr && ft.Implements(queryType)) {
+			return walkQuery(v.Field(i), terms)
+		}
+	}
+	if top.CanInterface() {
+		if q, ok := top.Interface().(iq.Query); ok {
+			return q.Cost(), terms
+		}
+	}
+	return 0, terms
+}
+
+// ScoreCombiner combines the per clause scores of CombineAnd and CombineOr into the document score,
+// scores are in the order the clauses were given, clauses not matching the document score 0
+type ScoreCombiner func(scores []float32) float32
+
+// SumScores adds the clause scores, same as iq.And and iq.Or
+func SumScores(scores []float32) float32 {
+	sum := float32(0)
+	for _, s := range scores {
+		sum += s
+	}
+	return sum
+}
+
+// ProductScores multiplies the clause scores, a document has to score well in every clause to rank high
+func ProductScores(scores []float32) float32 {
+	product := float32(1)
+	for _, s := range scores {
+		product *= s
+	}
+	return product
+}
+
+// WeightedSumScores returns combiner of the clause scores multiplied by their weight, missing weights are 1
+func WeightedSumScores(weights ...float32) ScoreCombiner {
+	return func(scores []float32) float32 {
+		sum := float32(0)
+		for i, s := range scores {
+			if i < len(weights) {
+				s *= weights[i]
+			}
+			sum += s
+		}
+		return sum
+	}
+}
+
+type combinedQuery struct {
+	// iq.And or iq.Or, used to find the matching documents
+	iq.Query
+	queries []iq.Query
+	scores  []float32
+	combine ScoreCombiner
+	boost   float32
+}
+
+// CombineAnd matches the same documents as iq.And, but the score is computed by combine from the score of every clause
+//
+// Example:
+//  query := index.CombineAnd(index.ProductScores,
+//  	iq.Or(m.Terms("name", "ams university")...),
+//  	iq.Or(m.Terms("country", "NL BG")...),
+//  )
+func CombineAnd(combine ScoreCombiner, queries ...iq.Query) iq.Query {
+	// iq.And sorts its clauses by cost
+	sorted := make([]iq.Query, len(queries))
+	copy(sorted, queries)
+	return newCombinedQuery(iq.And(sorted...), combine, queries)
+}
+
+// CombineOr matches the same documents as iq.Or, but the score is computed by combine from the score of every clause
+//
+// Example:
+//  query := index.CombineOr(index.WeightedSumScores(2, 1),
+//  	iq.Or(m.Terms("name", "amsterdam")...),
+//  	iq.Or(m.Terms("names", "amsterdam")...),
+//  )
+func CombineOr(combine ScoreCombiner, queries ...iq.Query) iq.Query {
+	sorted := make([]iq.Query, len(queries))
+	copy(sorted, queries)
+	return newCombinedQuery(iq.Or(sorted...), combine, queries)
+}
+
+func newCombinedQuery(q iq.Query, combine ScoreCombiner, queries []iq.Query) *combinedQuery {
+	if combine == nil {
+		combine = SumScores
+	}
+	return &combinedQuery{Query: q, queries: queries, scores: make([]float32, len(queries)), combine: combine, boost: 1}
+}
+
+func (q *combinedQuery) Score() float32 {
+	did := q.GetDocId()
+	for i, sub := range q.queries {
+		if sub.GetDocId() == did {
+			q.scores[i] = sub.Score()
+		} else {
+			q.scores[i] = 0
+		}
+	}
+	return q.combine(q.scores) * q.boost
+}
+
+func (q *combinedQuery) SetBoost(b float32) iq.Query {
+	q.boost = b
+	return q
+}
+
+func (q *combinedQuery) String() string {
+	return "combined" + q.Query.String()
+}
+
+// ResettableQuery is a query whose matches were collected once and can be iterated again after Reset,
+// iq queries can not be rewound, so a query that is run many times (e.g. in a benchmark) has to be rebuilt with Terms every time,
+// analyzing the text and allocating the term queries again, a ResettableQuery only walks its collected matches.
+// The matches are a snapshot taken when it is created, documents indexed later are not matched
+//
+// Example:
+//  q := index.NewResettableQuery(iq.Or(m.Terms("name", "amsterdam")...))
+//  for i := 0; i < 1000; i++ {
+//  	q.Reset()
+//  	m.Foreach(q, cb)
+//  }
+type ResettableQuery struct {
+	dids   []int32
+	scores []float32
+	cursor int
+	boost  float32
+	name   string
+}
+
+// NewResettableQuery iterates the query and collects its matching document ids and scores
+func NewResettableQuery(query iq.Query) *ResettableQuery {
+	q := &ResettableQuery{dids: []int32{}, scores: []float32{}, boost: 1, name: query.String()}
+	for query.Next() != iq.NO_MORE {
+		q.dids = append(q.dids, query.GetDocId())
+		q.scores = append(q.scores, query.Score())
+	}
+	q.Reset()
+	return q
+}
+
+// Reset rewinds the query, so it can be iterated again from the beginning
+func (q *ResettableQuery) Reset() {
+	q.cursor = -1
+}
+
+func (q *ResettableQuery) GetDocId() int32 {
+	if q.cursor < 0 {
+		return iq.NOT_READY
+	}
+	if q.cursor >= len(q.dids) {
+		return iq.NO_MORE
+	}
+	return q.dids[q.cursor]
+}
+
+func (q *ResettableQuery) Next() int32 {
+	if q.cursor < len(q.dids) {
+		q.cursor++
+	}
+	return q.GetDocId()
+}
+
+func (q *ResettableQuery) Advance(target int32) int32 {
+	from := q.cursor
+	if from < 0 {
+		from = 0
+	}
+	if from < len(q.dids) && q.dids[from] >= target {
+		q.cursor = from
+		return q.GetDocId()
+	}
+	q.cursor = from + sort.Search(len(q.dids)-from, func(i int) bool {
+		return q.dids[from+i] >= target
+	})
+	return q.GetDocId()
+}
+
+func (q *ResettableQuery) Score() float32 {
+	return q.scores[q.cursor] * q.boost
+}
+
+func (q *ResettableQuery) SetBoost(b float32) iq.Query {
+	q.boost = b
+	return q
+}
+
+func (q *ResettableQuery) Cost() int {
+	return len(q.dids)
+}
+
+func (q *ResettableQuery) String() string {
+	return "resettable" + q.name
+}
+
+func (q *ResettableQuery) PayloadDecode(p iq.Payload) {}
+
+// ClauseMatch is if a clause matched the current document and its score, see TopNWithClauses
+type ClauseMatch struct {
+	Matched bool
+	Score   float32
+}
+
+// TopNWithClauses is TopN, but the callback also gets which of the clauses matched the document and their scores,
+// e.g. to rank a name match above a description only match, or as features for a re-ranking model.
+// The clauses must be the direct sub queries of query (or the query itself), a sub query of a clause can be positioned
+// on a document its parent does not match. The matches slice is reused, it is valid only during the callback
+//
+// Example:
+//  name := iq.Or(m.Terms("name", text)...)
+//  description := iq.Or(m.Terms("description", text)...)
+//  m.TopNWithClauses(10, iq.Or(name, description), []iq.Query{name, description}, func(did int32, score float32, matches []index.ClauseMatch, doc index.Document) float32 {
+//  	if matches[0].Matched {
+//  		return score * 10
+//  	}
+//  	return score
+//  })
+func (m *MemOnlyIndex) TopNWithClauses(limit int, query iq.Query, clauses []iq.Query, cb func(int32, float32, []ClauseMatch, Document) float32) *SearchResult {
+	matches := make([]ClauseMatch, len(clauses))
+	return m.TopN(limit, query, func(did int32, score float32, doc Document) float32 {
+		for i, c := range clauses {
+			if c.GetDocId() == did {
+				matches[i] = ClauseMatch{Matched: true, Score: c.Score()}
+			} else {
+				matches[i] = ClauseMatch{}
+			}
+		}
+		if cb == nil {
+			return score
+		}
+		return cb(did, score, matches, doc)
+	})
+}
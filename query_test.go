@@ -0,0 +1,266 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+	analyzer "github.com/rekki/go-query-analyze"
+	tokenize "github.com/rekki/go-query-analyze/tokenize"
+)
+
+func TestDisMax(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	list := []*ExampleCity{
+		{Name: "Amsterdam", Names: []string{"Amsterdam"}},
+		{Name: "Amsterdam"},
+		{Name: "Sofia"},
+	}
+	m.Index(toDocuments(list)...)
+
+	scores := map[int32]float32{}
+	q := DisMax(0.5, iq.Or(m.Terms("name", "amsterdam")...), iq.Or(m.Terms("names", "amsterdam")...))
+	m.Foreach(q, func(did int32, score float32, doc Document) {
+		scores[did] = score
+	})
+	if len(scores) != 2 {
+		t.Fatalf("expected 2 got %v", scores)
+	}
+
+	name := iq.Or(m.Terms("name", "amsterdam")...)
+	name.Next()
+	names := iq.Or(m.Terms("names", "amsterdam")...)
+	names.Next()
+
+	max, rest := name.Score(), names.Score()
+	if rest > max {
+		max, rest = rest, max
+	}
+	if scores[0] != max+0.5*rest {
+		t.Fatalf("expected %f got %f", max+0.5*rest, scores[0])
+	}
+	if scores[1] != name.Score() {
+		t.Fatalf("expected %f got %f", name.Score(), scores[1])
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	list := []*ExampleCity{}
+	for i := 0; i < 100; i++ {
+		list = append(list, &ExampleCity{Name: "Amsterdam", Country: "NL"})
+	}
+	list = append(list, &ExampleCity{Name: "Amsterdam", Country: "BG"})
+	m.Index(toDocuments(list)...)
+
+	if m.DocFreq("country", "nl") != 100 || m.DocFreq("country", "bg") != 1 || m.DocFreq("country", "uk") != 0 {
+		t.Fatalf("unexpected doc freq")
+	}
+
+	common := EstimateCost(iq.Or(m.Terms("country", "nl")...))
+	rare := EstimateCost(iq.And(iq.Or(m.Terms("country", "nl")...), iq.Or(m.Terms("country", "bg")...)))
+	if rare >= common {
+		t.Fatalf("expected the and to be driven by the rare term, common: %d rare: %d", common, rare)
+	}
+	if rare != 1 {
+		t.Fatalf("expected the and to cost its cheapest clause, got %d", rare)
+	}
+	both := iq.Or(iq.Or(m.Terms("country", "nl")...), iq.Or(m.Terms("country", "bg")...))
+	if c := EstimateCost(both); c != 101 {
+		t.Fatalf("expected the or to cost the sum of its clauses, got %d", c)
+	}
+
+	terms := QueryTerms(iq.AndNot(iq.Or(m.Terms("country", "bg")...), both))
+	if len(terms) != 3 || terms[0].DocFreq != 100 || terms[1].DocFreq != 1 || terms[2].DocFreq != 1 {
+		t.Fatalf("unexpected terms %v", terms)
+	}
+	if terms[0].Term != "country:nl" {
+		t.Fatalf("unexpected term name %q", terms[0].Term)
+	}
+}
+
+func TestCombineScores(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	list := []*ExampleCity{
+		{Name: "Amsterdam", Country: "NL"},
+		{Name: "Amsterdam", Country: "BG"},
+		{Name: "Sofia", Country: "NL"},
+		{Name: "Sofia", Country: "BG"},
+		{Name: "Rotterdam", Country: "NL"},
+	}
+	m.Index(toDocuments(list)...)
+
+	score := func(q iq.Query) float32 {
+		q.Next()
+		return q.Score()
+	}
+	amsterdam := score(iq.Or(m.Terms("name", "amsterdam")...))
+	nl := score(iq.Or(m.Terms("country", "nl")...))
+
+	scores := map[int32]float32{}
+	// the country clause is more expensive, so iq.And would reorder the clauses
+	q := CombineAnd(func(s []float32) float32 {
+		return s[0]*10 + s[1]
+	}, iq.Or(m.Terms("country", "nl")...), iq.Or(m.Terms("name", "amsterdam")...))
+	m.Foreach(q, func(did int32, score float32, doc Document) {
+		scores[did] = score
+	})
+	if len(scores) != 1 || scores[0] != nl*10+amsterdam {
+		t.Fatalf("unexpected scores %v", scores)
+	}
+
+	scores = map[int32]float32{}
+	q = CombineOr(WeightedSumScores(2), iq.Or(m.Terms("name", "amsterdam")...), iq.Or(m.Terms("country", "nl")...))
+	m.Foreach(q, func(did int32, score float32, doc Document) {
+		scores[did] = score
+	})
+	if len(scores) != 4 || scores[0] != 2*amsterdam+nl || scores[1] != 2*amsterdam || scores[2] != nl {
+		t.Fatalf("unexpected scores %v", scores)
+	}
+
+	scores = map[int32]float32{}
+	q = CombineOr(ProductScores, iq.Or(m.Terms("name", "amsterdam")...), iq.Or(m.Terms("country", "nl")...))
+	m.Foreach(q, func(did int32, score float32, doc Document) {
+		scores[did] = score
+	})
+	if scores[0] != amsterdam*nl || scores[1] != 0 {
+		t.Fatalf("unexpected scores %v", scores)
+	}
+}
+
+func TestResettableQuery(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	for i := 0; i < 10; i++ {
+		country := "NL"
+		if i%2 == 0 {
+			country = "BG"
+		}
+		m.Index(&ExampleCity{Name: "Amsterdam", Country: country})
+	}
+
+	q := NewResettableQuery(iq.Or(m.Terms("country", "nl")...))
+	for run := 0; run < 3; run++ {
+		q.Reset()
+		dids := []int32{}
+		m.Foreach(q, func(did int32, score float32, doc Document) {
+			dids = append(dids, did)
+		})
+		if len(dids) != 5 || dids[0] != 1 || dids[4] != 9 {
+			t.Fatalf("run %d: unexpected matching %v", run, dids)
+		}
+	}
+
+	q.Reset()
+	and := iq.And(q, iq.Or(m.Terms("name", "amsterdam")...))
+	if and.Next() != 1 || and.Advance(4) != 5 || and.Next() != 7 {
+		t.Fatalf("unexpected advance")
+	}
+}
+
+func TestTopNWithClauses(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		MapDocument{"name": {"Amsterdam"}, "description": {"capital of the netherlands"}},
+		MapDocument{"name": {"Rotterdam"}, "description": {"close to amsterdam"}},
+		MapDocument{"name": {"Sofia"}, "description": {"capital of bulgaria"}},
+	)
+
+	name := iq.Or(m.Terms("name", "amsterdam")...)
+	description := iq.Or(m.Terms("description", "amsterdam capital")...)
+	seen := map[int32][]ClauseMatch{}
+	top := m.TopNWithClauses(10, iq.Or(name, description), []iq.Query{name, description}, func(did int32, score float32, matches []ClauseMatch, doc Document) float32 {
+		seen[did] = append([]ClauseMatch{}, matches...)
+		if matches[0].Matched {
+			return score * 10
+		}
+		return score
+	})
+	if top.Total != 3 || top.Hits[0].ID != 0 {
+		t.Fatalf("unexpected top %+v", top)
+	}
+	if !seen[0][0].Matched || !seen[0][1].Matched || seen[1][0].Matched || !seen[1][1].Matched || seen[2][0].Matched || seen[2][0].Score != 0 {
+		t.Fatalf("unexpected matches %v", seen)
+	}
+	if seen[0][0].Score <= 0 || seen[1][1].Score <= 0 {
+		t.Fatalf("expected clause scores %v", seen)
+	}
+}
+
+func TestScan(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	for i := 0; i < 100; i++ {
+		m.Index(MapDocument{"name": {fmt.Sprintf("city%d amsterdam", i%7)}})
+	}
+
+	last := int32(-1)
+	n := 0
+	m.Scan(iq.Or(iq.Or(m.Terms("name", "city3")...), iq.Or(m.Terms("name", "amsterdam")...)), func(did int32, score float32, doc Document) {
+		if did <= last {
+			t.Fatalf("out of order %d after %d", did, last)
+		}
+		last = did
+		n++
+	})
+	if n != 100 {
+		t.Fatalf("expected 100 got %d", n)
+	}
+
+	unordered := &ResettableQuery{dids: []int32{3, 1, 3, 5}, scores: []float32{1, 1, 1, 1}, boost: 1, cursor: -1}
+	dids := []int32{}
+	m.Scan(unordered, func(did int32, score float32, doc Document) {
+		dids = append(dids, did)
+	})
+	if len(dids) != 2 || dids[0] != 3 || dids[1] != 5 {
+		t.Fatalf("unexpected scan %v", dids)
+	}
+}
+
+func TestCrossFieldQuery(t *testing.T) {
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"name": FuzzyAnalyzer, "code": IDAnalyzer})
+	m.Index(
+		MapDocument{"name": {"Amsterdam"}, "code": {"AMS"}},
+		MapDocument{"name": {"Rotterdam"}, "code": {"RTM"}},
+		MapDocument{"name": {"Sofia"}, "code": {"SOF"}},
+	)
+
+	for text, expected := range map[string][]int32{
+		"amsterdm": {0, 1},
+		"RTM":      {1},
+		"rtm":      {},
+		"AMS":      {0},
+		"sofia":    {2},
+	} {
+		dids := []int32{}
+		m.Foreach(m.CrossFieldQuery([]string{"name", "code"}, text), func(did int32, score float32, doc Document) {
+			dids = append(dids, did)
+		})
+		if fmt.Sprintf("%v", dids) != fmt.Sprintf("%v", expected) {
+			t.Fatalf("%q: expected %v got %v", text, expected, dids)
+		}
+	}
+
+	top := m.TopN(10, m.CrossFieldQuery([]string{"name", "code"}, "amsterdam"), nil)
+	if top.Hits[0].ID != 0 {
+		t.Fatalf("expected the closest name first %+v", top)
+	}
+}
+
+func TestRawTermQuery(t *testing.T) {
+	shingles := analyzer.NewAnalyzer(DefaultNormalizer, DefaultSearchTokenizer, []tokenize.Tokenizer{tokenize.NewWhitespace(), tokenize.NewShingles(2)})
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"city": shingles, "tag": CaseSensitiveAnalyzer})
+	m.Index(
+		MapDocument{"city": {"New York"}, "tag": {"new_york"}},
+		MapDocument{"city": {"York"}, "tag": {"york"}},
+	)
+
+	count := func(q iq.Query) int {
+		return m.TopN(0, q, nil).Total
+	}
+	// the indexed shingle matches verbatim, searching "new york" is two terms matching both
+	if count(m.RawTermQuery("city", "newyork")) != 1 || count(iq.Or(m.Terms("city", "new york")...)) != 2 {
+		t.Fatalf("unexpected raw term matches")
+	}
+	if count(m.RawTermQuery("tag", "new_york")) != 1 || count(m.RawTermQuery("tag", "NEW_YORK")) != 0 || count(m.RawTermQuery("city", "New York")) != 0 {
+		t.Fatalf("expected verbatim matches only")
+	}
+}
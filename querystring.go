@@ -0,0 +1,101 @@
+package index
+
+import (
+	"strings"
+
+	iq "github.com/rekki/go-query"
+)
+
+// Operator combines the words of Query
+type Operator int
+
+const (
+	// OperatorOr matches documents with any of the words (higher recall)
+	OperatorOr Operator = iota
+	// OperatorAnd matches documents with all of the words (higher precision)
+	OperatorAnd
+)
+
+// Query is QueryWith(field, text, OperatorOr)
+//
+// Example:
+//  query := m.Query("name", "amsterdam -usa")
+//  // same as iq.AndNot(iq.Or(m.Terms("name", "usa")...), iq.Or(m.Terms("name", "amsterdam")...))
+func (m *MemOnlyIndex) Query(field string, text string) iq.Query {
+	return m.QueryWith(field, text, OperatorOr)
+}
+
+// QueryWith parses a minimal query syntax:
+//  - the whitespace separated words are analyzed with Terms (a word matches if any of its tokens does)
+//    and combined with the default operator
+//  - AND and OR between two words override the default operator for them, AND binds tighter than OR,
+//    e.g. with OperatorOr "amsterdam AND nl rotterdam" is (amsterdam AND nl) OR rotterdam
+//  - words prefixed with "-" exclude the documents matching them, a query with only exclusions matches all other documents
+//  - a leading "\" makes the word literal, e.g. "\-5" searches for -5 and "\OR" for or
+func (m *MemOnlyIndex) QueryWith(field string, text string, defaultOperator Operator) iq.Query {
+	chains, exclude := parseQuery(text, defaultOperator)
+
+	or := []iq.Query{}
+	for _, chain := range chains {
+		and := []iq.Query{}
+		for _, w := range chain {
+			and = append(and, iq.Or(m.Terms(field, w)...))
+		}
+		if len(and) == 1 {
+			or = append(or, and[0])
+		} else {
+			or = append(or, iq.And(and...))
+		}
+	}
+	var query iq.Query = iq.Or(or...)
+	if len(or) == 1 {
+		query = or[0]
+	}
+	if len(exclude) == 0 {
+		return query
+	}
+
+	not := []iq.Query{}
+	for _, w := range exclude {
+		not = append(not, m.Terms(field, w)...)
+	}
+	if len(chains) == 0 {
+		return iq.AndNot(iq.Or(not...), m.MatchAll())
+	}
+	return iq.AndNot(iq.Or(not...), query)
+}
+
+// parseQuery returns the words as OR'd chains of AND'd words, and the excluded words
+func parseQuery(text string, defaultOperator Operator) ([][]string, []string) {
+	chains := [][]string{}
+	exclude := []string{}
+	var pending *Operator
+	for _, w := range strings.Fields(text) {
+		switch {
+		case w == "AND" || w == "OR":
+			op := OperatorOr
+			if w == "AND" {
+				op = OperatorAnd
+			}
+			pending = &op
+			continue
+		case strings.HasPrefix(w, `\`) && len(w) > 1:
+			w = w[1:]
+		case len(w) > 1 && w[0] == '-':
+			exclude = append(exclude, w[1:])
+			continue
+		}
+
+		op := defaultOperator
+		if pending != nil {
+			op = *pending
+			pending = nil
+		}
+		if op == OperatorAnd && len(chains) > 0 {
+			chains[len(chains)-1] = append(chains[len(chains)-1], w)
+		} else {
+			chains = append(chains, []string{w})
+		}
+	}
+	return chains, exclude
+}
@@ -0,0 +1,57 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		MapDocument{"name": {"Amsterdam NL"}},
+		MapDocument{"name": {"Amsterdam USA"}},
+		MapDocument{"name": {"Sofia"}},
+		MapDocument{"name": {"minus -5"}},
+		MapDocument{"name": {"Rotterdam NL"}},
+	)
+
+	for _, c := range []struct {
+		text     string
+		op       Operator
+		expected []int32
+	}{
+		{"amsterdam", OperatorOr, []int32{0, 1}},
+		{"amsterdam -usa", OperatorOr, []int32{0}},
+		{"amsterdam sofia -usa", OperatorOr, []int32{0, 2}},
+		{"-usa", OperatorOr, []int32{0, 2, 3, 4}},
+		{"-", OperatorOr, []int32{}},
+		{"", OperatorOr, []int32{}},
+		{`\-5`, OperatorOr, []int32{3}},
+
+		// recall vs precision
+		{"amsterdam nl", OperatorOr, []int32{0, 1, 4}},
+		{"amsterdam nl", OperatorAnd, []int32{0}},
+		{"amsterdam nl -usa", OperatorAnd, []int32{0}},
+		{"amsterdam sofia", OperatorAnd, []int32{}},
+
+		// per query override
+		{"amsterdam AND nl", OperatorOr, []int32{0}},
+		{"amsterdam OR sofia", OperatorAnd, []int32{0, 1, 2}},
+		{"amsterdam AND nl OR sofia", OperatorOr, []int32{0, 2}},
+		{"nl amsterdam OR rotterdam", OperatorAnd, []int32{0, 4}},
+		{"AND amsterdam OR", OperatorAnd, []int32{0, 1}},
+	} {
+		dids := []int32{}
+		m.Foreach(m.QueryWith("name", c.text, c.op), func(did int32, score float32, doc Document) {
+			dids = append(dids, did)
+		})
+		if fmt.Sprintf("%v", dids) != fmt.Sprintf("%v", c.expected) {
+			t.Fatalf("%q %v: expected %v got %v", c.text, c.op, c.expected, dids)
+		}
+	}
+
+	chains, exclude := parseQuery(`a \-5 -b \OR`, OperatorAnd)
+	if fmt.Sprintf("%v %v", chains, exclude) != "[[a -5 OR]] [b]" {
+		t.Fatalf("unexpected parse %v %v", chains, exclude)
+	}
+}
@@ -0,0 +1,72 @@
+package index
+
+import iq "github.com/rekki/go-query"
+
+// MemReader gives access to the index from inside a scoring callback without locking it again,
+// which could deadlock if a writer is waiting for the lock held by the iteration.
+// It is only valid for the duration of the callback it was given to, do not keep it
+type MemReader struct {
+	m *MemOnlyIndex
+}
+
+// Terms is MemOnlyIndex.Terms
+func (r *MemReader) Terms(field string, term string) []iq.Query {
+	queries, _ := r.m.checkedTermsLocked(field, term)
+	return queries
+}
+
+// NewTermQuery is MemOnlyIndex.NewTermQuery
+func (r *MemReader) NewTermQuery(field string, term string) iq.Query {
+	return r.m.newTermQueryLocked(field, term)
+}
+
+// DocFreq is MemOnlyIndex.DocFreq
+func (r *MemReader) DocFreq(field string, term string) int {
+	return len(r.m.postings.Get(field, truncateTerm(term, r.m.MaxTermLength)))
+}
+
+// HasTerm is MemOnlyIndex.HasTerm
+func (r *MemReader) HasTerm(field string, term string) bool {
+	return r.DocFreq(field, term) > 0
+}
+
+// NumDocs is the number of document ids in the index (including the deleted ones), the N of the idf
+func (r *MemReader) NumDocs() int {
+	return r.m.forward.size()
+}
+
+// Get is MemOnlyIndex.Get
+func (r *MemReader) Get(did int32) Document {
+	return r.m.forward.get(did)
+}
+
+// GetByID is MemOnlyIndex.GetByID
+func (r *MemReader) GetByID(uuid string) Document {
+	did, ok := r.m.forwardByID[r.m.idKey(uuid)]
+	if !ok {
+		return nil
+	}
+	return r.m.forward.get(did)
+}
+
+// FieldLength is MemOnlyIndex.FieldLength
+func (r *MemReader) FieldLength(did int32, field string) int {
+	return int(r.m.fieldLen[field][did])
+}
+
+// TopNWithReader is TopN where the callback also gets a MemReader, to consult the index (e.g. document frequencies) while scoring
+// the callback must not call the methods of the index itself, they would lock it again
+//
+// Example:
+//  top := m.TopNWithReader(10, query, func(r *index.MemReader, did int32, score float32, doc index.Document) float32 {
+//  	if r.DocFreq("brand", doc.IndexableFields()["brand"][0]) < 10 {
+//  		score *= 1.2 // boost niche brands
+//  	}
+//  	return score
+//  })
+func (m *MemOnlyIndex) TopNWithReader(limit int, query iq.Query, cb func(*MemReader, int32, float32, Document) float32) *SearchResult {
+	r := &MemReader{m: m}
+	return m.TopN(limit, query, func(did int32, score float32, d Document) float32 {
+		return cb(r, did, score, d)
+	})
+}
@@ -0,0 +1,44 @@
+package index
+
+import (
+	"sync"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestTopNWithReader(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{TestID: "ams", Name: "Amsterdam", Country: "NL"},
+		&ExampleCity{TestID: "rot", Name: "Rotterdam", Country: "NL"},
+		&ExampleCity{TestID: "sof", Name: "Sofia", Country: "BG"},
+	)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			m.Index(&ExampleCity{Name: "Eindhoven", Country: "NL"})
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		top := m.TopNWithReader(10, iq.Or(m.Terms("name", "amsterdam sofia")...), func(r *MemReader, did int32, score float32, d Document) float32 {
+			country := d.IndexableFields()["country"][0]
+			sub := iq.Or(r.Terms("country", country)...)
+			if sub.Next() == iq.NO_MORE {
+				t.Fatalf("expected the country to match")
+			}
+			if r.Get(did) != d || r.GetByID(d.IndexableFields()["_id"][0]) != d || r.FieldLength(did, "name") != 1 {
+				t.Fatalf("unexpected reader state")
+			}
+			return float32(r.DocFreq("country", country))
+		})
+		if len(top.Hits) != 2 || top.Hits[0].ID != 0 {
+			t.Fatalf("unexpected hits %v", top.Hits)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,118 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	iq "github.com/rekki/go-query"
+)
+
+// EvalRelevanceK is the number of top hits EvalRelevance judges
+var EvalRelevanceK = 10
+
+// Judgment is a labeled query, the ids (values of IDField) of the documents relevant for the text searched in the field
+type Judgment struct {
+	Field    string   `json:"field"`
+	Query    string   `json:"query"`
+	Relevant []string `json:"relevant"`
+}
+
+// QueryRelevance is the relevance of the top EvalRelevanceK hits of one judged query
+type QueryRelevance struct {
+	Judgment
+	// Precision is the fraction of the top hits that are relevant
+	Precision float64 `json:"precision"`
+	// Recall is the fraction of the relevant documents that are in the top hits
+	Recall float64 `json:"recall"`
+	// Missing are the relevant ids not in the top hits
+	Missing []string `json:"missing"`
+}
+
+// RelevanceReport is the result of EvalRelevance, the precision and recall are averaged over the queries
+type RelevanceReport struct {
+	K         int              `json:"k"`
+	Precision float64          `json:"precision"`
+	Recall    float64          `json:"recall"`
+	Queries   []QueryRelevance `json:"queries"`
+}
+
+// LoadJudgments reads newline delimited JSON judgments, one per line, empty lines are skipped
+//  {"field":"name","query":"amsterdm","relevant":["nl-ams"]}
+func LoadJudgments(r io.Reader) ([]Judgment, error) {
+	out := []Judgment{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		j := Judgment{}
+		if err := json.Unmarshal(scanner.Bytes(), &j); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		out = append(out, j)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EvalRelevance searches every judged query (iq.Or of the Terms of the field) and computes precision@EvalRelevanceK and recall@EvalRelevanceK
+// of the hits, the documents are identified by their IDField. Index the same fixture with two analyzers to compare them before changing one
+//
+// Example:
+//  judgments, err := index.LoadJudgments(f)
+//  if err != nil {
+//  	panic(err)
+//  }
+//  before := index.EvalRelevance(withDefault, judgments)
+//  after := index.EvalRelevance(withFuzzy, judgments)
+//  log.Printf("recall@%d %.2f -> %.2f", after.K, before.Recall, after.Recall)
+func EvalRelevance(m *MemOnlyIndex, judgments []Judgment) RelevanceReport {
+	k := EvalRelevanceK
+	report := RelevanceReport{K: k, Queries: []QueryRelevance{}}
+	for _, j := range judgments {
+		relevant := map[string]bool{}
+		for _, id := range j.Relevant {
+			relevant[id] = true
+		}
+
+		found := map[string]bool{}
+		hits := 0
+		top := m.TopN(k, iq.Or(m.Terms(j.Field, j.Query)...), nil)
+		for _, hit := range top.Hits {
+			hits++
+			for _, id := range hit.Document.IndexableFields()[m.IDField] {
+				if relevant[id] {
+					found[id] = true
+					break
+				}
+			}
+		}
+
+		q := QueryRelevance{Judgment: j, Missing: []string{}}
+		for _, id := range j.Relevant {
+			if !found[id] {
+				q.Missing = append(q.Missing, id)
+			}
+		}
+		if hits > 0 {
+			q.Precision = float64(len(found)) / float64(hits)
+		}
+		if len(relevant) > 0 {
+			q.Recall = float64(len(found)) / float64(len(relevant))
+		}
+		report.Precision += q.Precision
+		report.Recall += q.Recall
+		report.Queries = append(report.Queries, q)
+	}
+	if n := len(report.Queries); n > 0 {
+		report.Precision /= float64(n)
+		report.Recall /= float64(n)
+	}
+	return report
+}
@@ -0,0 +1,63 @@
+package index
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	analyzer "github.com/rekki/go-query-analyze"
+)
+
+func loadCities(t *testing.T, perField map[string]*analyzer.Analyzer) *MemOnlyIndex {
+	f, err := os.Open("testdata/cities.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m := NewMemOnlyIndex(perField)
+	if err := m.IndexJSONL(f); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestEvalRelevance(t *testing.T) {
+	f, err := os.Open("testdata/cities_judgments.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	judgments, err := LoadJudgments(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(judgments) != 8 {
+		t.Fatalf("unexpected judgments %v", judgments)
+	}
+
+	exact := EvalRelevance(loadCities(t, nil), judgments)
+	if exact.K != EvalRelevanceK || len(exact.Queries) != 8 {
+		t.Fatalf("unexpected report %+v", exact)
+	}
+	amsterdam := exact.Queries[0]
+	if amsterdam.Precision != 1 || amsterdam.Recall != 1 || len(amsterdam.Missing) != 0 {
+		t.Fatalf("unexpected relevance %+v", amsterdam)
+	}
+	misspelled := exact.Queries[1]
+	if misspelled.Recall != 0 || len(misspelled.Missing) != 2 {
+		t.Fatalf("unexpected relevance %+v", misspelled)
+	}
+
+	fuzzy := EvalRelevance(loadCities(t, map[string]*analyzer.Analyzer{"name": FuzzyAnalyzer}), judgments)
+	if fuzzy.Recall <= exact.Recall || fuzzy.Queries[1].Recall != 1 {
+		t.Fatalf("expected fuzzy to find the misspelled cities, recall %f -> %f", exact.Recall, fuzzy.Recall)
+	}
+	if fuzzy.Precision >= exact.Precision {
+		t.Fatalf("expected fuzzy to match more noise, precision %f -> %f", exact.Precision, fuzzy.Precision)
+	}
+
+	if _, err := LoadJudgments(strings.NewReader("{\"field\":\"name\"}\n{")); err == nil || !strings.HasPrefix(err.Error(), "line 2: ") {
+		t.Fatalf("expected line 2 error, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// SchemaMode is what the index does with fields that are not configured in perField (nor the IDField)
+type SchemaMode int
+
+const (
+	// SchemaOpen indexes unknown fields with the default analyzer (DefaultAnalyzer unless WithDefaultAnalyzer)
+	SchemaOpen SchemaMode = iota
+	// SchemaStrict rejects documents with unknown fields, see ErrUnknownField
+	SchemaStrict
+	// SchemaIgnore does not index unknown fields
+	SchemaIgnore
+)
+
+// ErrUnknownField is returned when indexing a document with a field that is not in perField in SchemaStrict mode
+var ErrUnknownField = errors.New("unknown field")
+
+// WithSchemaMode sets what happens with fields not configured in perField, by default SchemaOpen.
+// SchemaStrict catches typos in field names: DirIndex.Index and MemOnlyIndex.TryIndex return ErrUnknownField
+// and index none of the documents, MemOnlyIndex.Index and IndexOrUpdate can not return the error, they skip the documents
+// with unknown fields (their document id is -1) and index the others. Fields declared by DocumentWithAnalyzers are known to MemOnlyIndex (not to DirIndex)
+//
+// Example:
+//  m := index.NewMemOnlyIndex(perField, index.WithSchemaMode(index.SchemaStrict))
+//  _, err := m.TryIndex(docs...)
+func WithSchemaMode(mode SchemaMode) Option {
+	return func(o *options) {
+		o.schema = mode
+	}
+}
+
+// checkSchema returns ErrUnknownField for the first (sorted) field of the document that is not known
+func checkSchema(d Document, known func(string) bool) error {
+	unknown := []string{}
+	for field := range d.IndexableFields() {
+		if !known(field) {
+			unknown = append(unknown, field)
+		}
+	}
+	if rd, ok := d.(ReaderDocument); ok {
+		for field := range rd.IndexableReaders() {
+			if !known(field) {
+				unknown = append(unknown, field)
+			}
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("%w: %q", ErrUnknownField, unknown[0])
+}
+
+// declaredAnalyzer returns true if the document declares the analyzer of the field
+func declaredAnalyzer(d Document, field string) bool {
+	da, ok := d.(DocumentWithAnalyzers)
+	if !ok {
+		return false
+	}
+	return da.FieldAnalyzers()[field] != nil
+}
+
+func (m *MemOnlyIndex) knownFieldLocked(d Document, field string) bool {
+	_, ok := m.perField[field]
+	_, declared := m.declared[field]
+	return ok || declared || field == m.IDField || declaredAnalyzer(d, field)
+}
+
+func (m *MemOnlyIndex) checkSchemaLocked(docs []Document) error {
+	if m.schema != SchemaStrict {
+		return nil
+	}
+	for _, d := range docs {
+		if err := checkSchema(d, func(field string) bool { return m.knownFieldLocked(d, field) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TryIndex is Index, but returns ErrUnknownField instead of skipping the documents with unknown fields in SchemaStrict mode,
+// in which case none of the documents is indexed
+func (m *MemOnlyIndex) TryIndex(docs ...Document) ([]int32, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.checkSchemaLocked(docs); err != nil {
+		return nil, err
+	}
+	return m.indexAllLocked(docs), nil
+}
+
+// knownField does not accept the fields declared by DocumentWithAnalyzers, DirIndex does not use the declared analyzers
+func (d *DirIndex) knownField(field string) bool {
+	_, ok := d.perField[field]
+	return ok || field == d.IDField
+}
+
+func (d *DirIndex) checkSchema(docs []DocumentWithID) error {
+	if d.schema != SchemaStrict {
+		return nil
+	}
+	for _, doc := range docs {
+		if err := checkSchema(doc, d.knownField); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package index
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	analyzer "github.com/rekki/go-query-analyze"
+)
+
+func TestSchemaMode(t *testing.T) {
+	perField := map[string]*analyzer.Analyzer{"name": DefaultAnalyzer, "names": DefaultAnalyzer}
+
+	m := NewMemOnlyIndex(perField, WithSchemaMode(SchemaStrict))
+	if _, err := m.TryIndex(&ExampleCity{Name: "Amsterdam"}, &ExampleCity{Name: "Sofia", Country: "BG"}); !errors.Is(err, ErrUnknownField) || err.Error() != `unknown field: "country"` {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+	if m.DocFreq("name", "amsterdam") != 0 {
+		t.Fatalf("expected nothing indexed")
+	}
+	if dids := m.Index(MapDocument{"name": {"Amsterdam"}}, &ExampleCity{Name: "Sofia"}, MapDocument{"names": {"Zurich"}}); dids[0] != 0 || dids[1] != -1 || dids[2] != 1 {
+		t.Fatalf("expected the document with unknown fields skipped, got %v", dids)
+	}
+	if m.DocFreq("name", "sofia") != 0 || m.DocFreq("name", "amsterdam") != 1 {
+		t.Fatalf("unexpected postings")
+	}
+	if dids := m.IndexOrUpdate(&ExampleCity{Name: "Sofia", TestID: "s"}); dids[0] != -1 || m.GetByID("s") != nil {
+		t.Fatalf("expected IndexOrUpdate to skip the document, got %v", dids)
+	}
+	if _, err := m.TryIndex(MapDocument{"name": {"Amsterdam"}, "_id": {"a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	batched := NewMemOnlyIndex(perField, WithSchemaMode(SchemaStrict), WithWriteBatching(time.Millisecond, 0))
+	if dids := batched.Index(&ExampleCity{Name: "Sofia"}, MapDocument{"name": {"Sofia"}}); dids[0] != -1 || dids[1] != 0 {
+		t.Fatalf("expected the batched index to skip the document, got %v", dids)
+	}
+
+	m = NewMemOnlyIndex(perField, WithSchemaMode(SchemaIgnore))
+	m.Index(&ExampleCity{Name: "Amsterdam", Country: "NL"})
+	if m.DocFreq("name", "amsterdam") != 1 || m.DocFreq("country", "nl") != 0 {
+		t.Fatalf("expected country to be ignored")
+	}
+
+	m = NewMemOnlyIndex(perField)
+	m.Index(&ExampleCity{Name: "Amsterdam", Country: "NL"})
+	if m.DocFreq("country", "nl") != 1 {
+		t.Fatalf("expected country to be indexed")
+	}
+}
+
+func TestDirSchemaMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	perField := map[string]*analyzer.Analyzer{"name": DefaultAnalyzer, "names": DefaultAnalyzer}
+	d := NewDirIndex(dir, NewFDCache(10), perField, WithSchemaMode(SchemaStrict))
+	if err := d.Index(&ExampleCity{Name: "Amsterdam", Country: "NL"}); !errors.Is(err, ErrUnknownField) {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+	if d.DocFreq("name", "amsterdam") != 0 {
+		t.Fatalf("expected nothing indexed")
+	}
+	// DirIndex does not use the declared analyzers, so they do not make a field known
+	if err := d.Index(&soundexCity{ExampleCity{Name: "Amsterdam", Country: "NL"}}); !errors.Is(err, ErrUnknownField) {
+		t.Fatalf("expected unknown field error for a declared field, got %v", err)
+	}
+
+	d = NewDirIndex(dir, NewFDCache(10), perField, WithSchemaMode(SchemaIgnore))
+	if err := d.Index(&ExampleCity{Name: "Amsterdam", Country: "NL"}); err != nil {
+		t.Fatal(err)
+	}
+	if d.DocFreq("name", "amsterdam") != 1 || d.DocFreq("country", "nl") != 0 {
+		t.Fatalf("expected country to be ignored")
+	}
+}
@@ -0,0 +1,125 @@
+package index
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	iq "github.com/rekki/go-query"
+)
+
+// RecencyBoost returns TopN callback multiplying the score by exponential decay of the document age,
+// factor 1 for a document from now (or the future), 0.5 for a document halfLife old, 0.25 for 2*halfLife and so on.
+// The age is computed from the first value of field, either unix time in seconds or RFC3339 time,
+// documents without (valid, non zero) timestamp are not decayed, as in elasticsearch decay functions.
+// The current time is taken when RecencyBoost is called, so all documents of the query use the same time
+//
+// Example:
+//  top := m.TopN(10, query, index.RecencyBoost("created_at", 30*24*time.Hour))
+func RecencyBoost(field string, halfLife time.Duration) func(int32, float32, Document) float32 {
+	now := time.Now()
+	return func(did int32, score float32, d Document) float32 {
+		return score * float32(recencyFactor(now, d, field, halfLife))
+	}
+}
+
+func recencyFactor(now time.Time, d Document, field string, halfLife time.Duration) float64 {
+	values := d.IndexableFields()[field]
+	if len(values) == 0 || halfLife <= 0 {
+		return 1
+	}
+
+	t, ok := parseTimestamp(values[0])
+	if !ok {
+		return 1
+	}
+	age := now.Sub(t)
+	if age <= 0 {
+		return 1
+	}
+	return math.Exp2(-float64(age) / float64(halfLife))
+}
+
+// parseTimestamp parses unix time in seconds or RFC3339 time, zero times are invalid
+func parseTimestamp(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if sec == 0 {
+			return time.Time{}, false
+		}
+		return time.Unix(sec, 0), true
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil || t.IsZero() {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// AutocompleteCoverage returns TopN callback for fields indexed with AutocompleteAnalyzer, multiplying the score by how much
+// of the matched words the query covers, e.g. for "ams" 1 for "Ams", 0.33 for "Amsterdam", so the closest completions rank first.
+// For every search token the shortest word of the field starting with it is used, the factor is the average coverage
+// (token length / word length, in runes) over the tokens, 0 for a token no word starts with
+//
+// Example:
+//  top := m.TopN(10, iq.And(m.Terms("name", "ams")...), m.AutocompleteCoverage("name", "ams"))
+func (m *MemOnlyIndex) AutocompleteCoverage(field, query string) func(int32, float32, Document) float32 {
+	m.RLock()
+	a := m.analyzerFor(field)
+	tokens := m.searchTokensLocked(field, query)
+	m.RUnlock()
+
+	return func(did int32, score float32, d Document) float32 {
+		if len(tokens) == 0 {
+			return score
+		}
+
+		words := []string{}
+		for _, v := range d.IndexableFields()[field] {
+			words = append(words, a.AnalyzeSearch(v)...)
+		}
+
+		coverage := float32(0)
+		for _, t := range tokens {
+			shortest := 0
+			for _, w := range words {
+				if n := utf8.RuneCountInString(w); strings.HasPrefix(w, t) && (shortest == 0 || n < shortest) {
+					shortest = n
+				}
+			}
+			if shortest > 0 {
+				coverage += float32(utf8.RuneCountInString(t)) / float32(shortest)
+			}
+		}
+		return score * coverage / float32(len(tokens))
+	}
+}
+
+// LinearLengthBoost is a TermLengthBoost function scaling the terms shorter than n runes by length/n
+func LinearLengthBoost(n int) func(length int) float32 {
+	return func(length int) float32 {
+		if length >= n {
+			return 1
+		}
+		return float32(length) / float32(n)
+	}
+}
+
+// scaledQuery multiplies the score of the query by a constant factor, which is kept when the query is boosted
+type scaledQuery struct {
+	iq.Query
+	factor float32
+}
+
+func (q *scaledQuery) Score() float32 {
+	return q.Query.Score() * q.factor
+}
+
+func (q *scaledQuery) SetBoost(b float32) iq.Query {
+	q.Query.SetBoost(b)
+	return q
+}
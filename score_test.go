@@ -0,0 +1,85 @@
+package index
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	iq "github.com/rekki/go-query"
+	analyzer "github.com/rekki/go-query-analyze"
+)
+
+func TestRecencyBoost(t *testing.T) {
+	day := 24 * time.Hour
+	now := time.Now()
+	boost := RecencyBoost("created_at", day)
+
+	cases := []struct {
+		created  []string
+		expected float64
+	}{
+		{[]string{strconv.FormatInt(now.Unix(), 10)}, 1},
+		{[]string{now.Add(-day).Format(time.RFC3339)}, 0.5},
+		{[]string{strconv.FormatInt(now.Add(-2*day).Unix(), 10)}, 0.25},
+		{[]string{now.Add(day).Format(time.RFC3339)}, 1},
+		{[]string{"0"}, 1},
+		{[]string{"0001-01-01T00:00:00Z"}, 1},
+		{[]string{"yesterday"}, 1},
+		{nil, 1},
+	}
+	for _, c := range cases {
+		score := boost(0, 2, MapDocument{"created_at": c.created})
+		if math.Abs(float64(score)-2*c.expected) > 0.001 {
+			t.Fatalf("%v: expected %f got %f", c.created, 2*c.expected, score)
+		}
+	}
+}
+
+func TestAutocompleteCoverage(t *testing.T) {
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"name": AutocompleteAnalyzer})
+	m.Index(
+		MapDocument{"name": {"Amsterdam"}},
+		MapDocument{"name": {"Amstelveen"}},
+		MapDocument{"name": {"Ams"}},
+		MapDocument{"name": {"Amsterdam Zuid"}},
+	)
+
+	top := m.TopN(10, iq.And(m.Terms("name", "Ams")...), m.AutocompleteCoverage("name", "Ams"))
+	expected := []int32{2, 0, 3, 1}
+	if len(top.Hits) != len(expected) {
+		t.Fatalf("unexpected hits %v", top.Hits)
+	}
+	for i, hit := range top.Hits {
+		if hit.ID != expected[i] {
+			t.Fatalf("expected %v got %v", expected, top.Hits)
+		}
+	}
+
+	top = m.TopN(10, iq.And(m.Terms("name", "amsterdam zu")...), m.AutocompleteCoverage("name", "amsterdam zu"))
+	if len(top.Hits) != 1 || top.Hits[0].ID != 3 {
+		t.Fatalf("unexpected hits %v", top.Hits)
+	}
+}
+
+func TestTermLengthBoost(t *testing.T) {
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"name": AutocompleteAnalyzer})
+	m.TermLengthBoost = map[string]func(int) float32{"name": LinearLengthBoost(4)}
+	m.Index(MapDocument{"name": {"Amsterdam"}}, MapDocument{"name": {"Sofia"}})
+
+	score := func(q iq.Query) float32 {
+		top := m.TopN(1, q, nil)
+		if top.Total == 0 {
+			return 0
+		}
+		return top.Hits[0].Score
+	}
+	full := score(m.NewTermQuery("name", "amst"))
+	short := score(m.NewTermQuery("name", "a"))
+	if full <= 0 || short != full/4 {
+		t.Fatalf("expected short prefix to score a quarter, got %f %f", short, full)
+	}
+	if boosted := score(m.NewTermQuery("name", "a").SetBoost(2)); boosted != short*2 {
+		t.Fatalf("expected the length boost to be kept, got %f", boosted)
+	}
+}
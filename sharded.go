@@ -0,0 +1,251 @@
+package index
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	iq "github.com/rekki/go-query"
+	analyzer "github.com/rekki/go-query-analyze"
+)
+
+// ShardedIndex splits the documents across multiple MemOnlyIndex shards, which are indexed and searched concurrently
+// the document ids are global: shard document id * number of shards + shard number, so every shard can hold at most
+// math.MaxInt32 / number of shards documents
+type ShardedIndex struct {
+	shards []*MemOnlyIndex
+	next   uint32
+}
+
+// ShardQuery builds the query for one shard, iq queries can not be reused, so every shard needs its own
+//
+// Example:
+//  query := func(m *index.MemOnlyIndex) iq.Query {
+//  	return iq.And(
+//  		iq.Or(s.ShardTerms(m, "name", "ams university")...),
+//  		iq.Or(s.ShardTerms(m, "country", "NL BG")...),
+//  	)
+//  }
+//  top := s.TopN(5, query, nil)
+type ShardQuery func(shard *MemOnlyIndex) iq.Query
+
+// NewShardedIndex creates n shards, each one created with NewMemOnlyIndex(perField, opts...)
+func NewShardedIndex(n int, perField map[string]*analyzer.Analyzer, opts ...Option) *ShardedIndex {
+	if n < 1 {
+		n = 1
+	}
+	s := &ShardedIndex{}
+	for i := 0; i < n; i++ {
+		shard := NewMemOnlyIndex(perField, opts...)
+		// the biggest document id that fits in int32 as global id
+		shard.maxDocumentID = int32((math.MaxInt32 - i) / n)
+		s.shards = append(s.shards, shard)
+	}
+	return s
+}
+
+// Shards returns the underlying indexes, e.g. to set their options before indexing
+func (s *ShardedIndex) Shards() []*MemOnlyIndex {
+	return s.shards
+}
+
+// globalID does not overflow, the shards do not index documents beyond their maxDocumentID
+func (s *ShardedIndex) globalID(shard int, did int32) int32 {
+	if did < 0 {
+		// not indexed
+		return -1
+	}
+	return did*int32(len(s.shards)) + int32(shard)
+}
+
+func (s *ShardedIndex) localID(did int32) (int, int32) {
+	n := int32(len(s.shards))
+	return int(did % n), did / n
+}
+
+// shardFor picks the shard by hash of DocumentID() if the document has one, otherwise by hash of its IDField (analyzed as GetByID does,
+// so equal ids go to the same shard), otherwise round robin
+func (s *ShardedIndex) shardFor(d Document) int {
+	n := uint32(len(s.shards))
+	if dd, ok := d.(DocumentWithID); ok {
+		return int(uint32(dd.DocumentID()) % n)
+	}
+	first := s.shards[0]
+	if ids := d.IndexableFields()[first.IDField]; len(ids) > 0 {
+		first.RLock()
+		key := first.idKey(ids[0])
+		first.RUnlock()
+
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		return int(h.Sum32() % n)
+	}
+	return int(atomic.AddUint32(&s.next, 1) % n)
+}
+
+// Index a bunch of documents (the shards are indexed concurrently), returns the assigned global document ids in the same order as docs
+// the documents a shard does not index (see MemOnlyIndex.Index) get -1, as the documents beyond the capacity of the shard
+func (s *ShardedIndex) Index(docs ...Document) []int32 {
+	perShard := make([][]Document, len(s.shards))
+	positions := make([][]int, len(s.shards))
+	for i, d := range docs {
+		shard := s.shardFor(d)
+		perShard[shard] = append(perShard[shard], d)
+		positions[shard] = append(positions[shard], i)
+	}
+
+	out := make([]int32, len(docs))
+	var wg sync.WaitGroup
+	for shard := range s.shards {
+		if len(perShard[shard]) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			for i, did := range s.shards[shard].Index(perShard[shard]...) {
+				out[positions[shard][i]] = s.globalID(shard, did)
+			}
+		}(shard)
+	}
+	wg.Wait()
+	return out
+}
+
+// Get the document by global document id
+func (s *ShardedIndex) Get(did int32) Document {
+	shard, local := s.localID(did)
+	return s.shards[shard].Get(local)
+}
+
+// GetByID looks up the id in every shard
+func (s *ShardedIndex) GetByID(uuid string) Document {
+	for _, m := range s.shards {
+		if d := m.GetByID(uuid); d != nil {
+			return d
+		}
+	}
+	return nil
+}
+
+// Delete the document by global document id
+func (s *ShardedIndex) Delete(did int32) {
+	shard, local := s.localID(did)
+	s.shards[shard].Delete(local)
+}
+
+// DeleteByID deletes the id from every shard
+func (s *ShardedIndex) DeleteByID(uuid string) {
+	for _, m := range s.shards {
+		m.DeleteByID(uuid)
+	}
+}
+
+// GlobalDocFreq returns the number of documents containing this (already analyzed) term in the field across all shards
+func (s *ShardedIndex) GlobalDocFreq(field string, term string) int {
+	df := 0
+	for _, m := range s.shards {
+		df += m.DocFreq(field, term)
+	}
+	return df
+}
+
+func (s *ShardedIndex) totalDocuments() int {
+	n := 0
+	for _, m := range s.shards {
+		m.RLock()
+		n += m.forward.size()
+		m.RUnlock()
+	}
+	return n
+}
+
+// Terms creates ShardQuery of iq.Or of the ShardTerms
+func (s *ShardedIndex) Terms(field string, term string) ShardQuery {
+	return func(m *MemOnlyIndex) iq.Query {
+		return iq.Or(s.ShardTerms(m, field, term)...)
+	}
+}
+
+// ShardTerms is shard.Terms(field, term), but the queries score with the idf of the whole index instead of the shard one,
+// so the scores from different shards are comparable, use it instead of shard.Terms when building a ShardQuery
+func (s *ShardedIndex) ShardTerms(shard *MemOnlyIndex, field string, term string) []iq.Query {
+	// the queries and their dfs come from one tokenization under one lock, so they agree even if the shard is written meanwhile
+	shard.RLock()
+	tokens := shard.searchTokensLocked(field, term)
+	if len(tokens) == 0 {
+		// NoTokens decides, there is nothing to score
+		queries, _ := shard.checkedTermsLocked(field, term)
+		shard.RUnlock()
+		return queries
+	}
+	queries := make([]iq.Query, len(tokens))
+	dfs := make([]int, len(tokens))
+	for i, t := range tokens {
+		queries[i] = shard.newTermQueryLocked(field, t)
+		dfs[i] = len(shard.postings.Get(field, truncateTerm(t, shard.MaxTermLength)))
+	}
+	total := shard.forward.size()
+	idf := shard.IDF
+	shard.RUnlock()
+	if idf == nil {
+		idf = DefaultIDF
+	}
+
+	globalTotal := s.totalDocuments()
+	for i, t := range tokens {
+		df := dfs[i]
+		if df == 0 {
+			continue
+		}
+		local := idf(df, total)
+		if local == 0 {
+			continue
+		}
+		// the term query scores 1*idf
+		queries[i] = queries[i].SetBoost(idf(s.GlobalDocFreq(field, t), globalTotal) / local)
+	}
+	return queries
+}
+
+// TopN runs the query on every shard concurrently and merges their top documents, same as MemOnlyIndex.TopN
+// build the query with ShardTerms, otherwise the scores of different shards are not comparable
+// the callback gets the global document id, it is called concurrently from multiple shards
+func (s *ShardedIndex) TopN(limit int, query ShardQuery, cb func(int32, float32, Document) float32) *SearchResult {
+	results := make([]*SearchResult, len(s.shards))
+	var wg sync.WaitGroup
+	for shard := range s.shards {
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+
+			var shardCb func(int32, float32, Document) float32
+			if cb != nil {
+				shardCb = func(did int32, score float32, d Document) float32 {
+					return cb(s.globalID(shard, did), score, d)
+				}
+			}
+			results[shard] = s.shards[shard].TopN(limit, query(s.shards[shard]), shardCb)
+		}(shard)
+	}
+	wg.Wait()
+
+	out := &SearchResult{Hits: []Hit{}}
+	for shard, r := range results {
+		out.Total += r.Total
+		for _, hit := range r.Hits {
+			hit.ID = s.globalID(shard, hit.ID)
+			out.Hits = append(out.Hits, hit)
+		}
+	}
+
+	sort.Slice(out.Hits, func(i, j int) bool {
+		return HitLess(out.Hits[i], out.Hits[j])
+	})
+	if len(out.Hits) > limit {
+		out.Hits = out.Hits[:limit]
+	}
+	return out
+}
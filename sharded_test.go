@@ -0,0 +1,145 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+	analyzer "github.com/rekki/go-query-analyze"
+)
+
+func TestShardedIndex(t *testing.T) {
+	s := NewShardedIndex(4, nil)
+
+	docs := []Document{}
+	for i := 0; i < 100; i++ {
+		country := "NL"
+		if i%3 == 0 {
+			country = "BG"
+		}
+		docs = append(docs, &ExampleCity{TestID: fmt.Sprintf("c%d", i), Name: fmt.Sprintf("city %d", i), Country: country})
+	}
+	dids := s.Index(docs...)
+
+	for i, did := range dids {
+		if s.Get(did) != docs[i] {
+			t.Fatalf("unexpected document %d for %d", did, i)
+		}
+	}
+	if s.GetByID("c42") != docs[42] {
+		t.Fatalf("unexpected GetByID")
+	}
+
+	top := s.TopN(5, func(m *MemOnlyIndex) iq.Query {
+		return iq.And(iq.Or(m.Terms("name", "city")...), iq.Or(m.Terms("country", "bg")...))
+	}, func(did int32, score float32, d Document) float32 {
+		if s.Get(did) != d {
+			t.Fatalf("unexpected document for %d", did)
+		}
+		return 1
+	})
+	if top.Total != 34 || len(top.Hits) != 5 {
+		t.Fatalf("unexpected result %v", top)
+	}
+	for i := 1; i < len(top.Hits); i++ {
+		if top.Hits[i-1].ID >= top.Hits[i].ID {
+			t.Fatalf("expected ties sorted by id %v", top.Hits)
+		}
+	}
+
+	s.DeleteByID("c42")
+	if s.GetByID("c42") != nil {
+		t.Fatalf("expected c42 to be deleted")
+	}
+	top = s.TopN(100, s.Terms("name", "42"), nil)
+	if top.Total != 0 {
+		t.Fatalf("unexpected result %v", top)
+	}
+	top = s.TopN(100, s.Terms("name", "city"), nil)
+	if top.Total != 99 || len(top.Hits) != 99 {
+		t.Fatalf("unexpected result %v", top.Total)
+	}
+}
+
+func TestShardedGlobalDocFreq(t *testing.T) {
+	s := NewShardedIndex(2, nil)
+	m := NewMemOnlyIndex(nil)
+
+	docs := []Document{}
+	for i := 0; i < 20; i++ {
+		name := "Rotterdam"
+		// all amsterdams end up in shard 0
+		if i%2 == 0 && i < 10 {
+			name = "Amsterdam"
+		}
+		docs = append(docs, &ExampleCity{ID: int32(i), Name: name})
+	}
+	s.Index(docs...)
+	m.Index(docs...)
+
+	if s.GlobalDocFreq("name", "amsterdam") != 5 || s.GlobalDocFreq("name", "rotterdam") != 15 {
+		t.Fatalf("unexpected doc freq")
+	}
+
+	expected := map[string]float32{}
+	for _, term := range []string{"amsterdam", "rotterdam"} {
+		q := iq.Or(m.Terms("name", term)...)
+		q.Next()
+		expected[term] = q.Score()
+	}
+
+	top := s.TopN(20, s.Terms("name", "amsterdam rotterdam"), nil)
+	if len(top.Hits) != 20 {
+		t.Fatalf("unexpected result %v", top)
+	}
+	for _, hit := range top.Hits {
+		e := expected[strings.ToLower(hit.Document.(*ExampleCity).Name)]
+		if math.Abs(float64(hit.Score-e)) > 0.0001 {
+			t.Fatalf("expected %f got %f for %v", e, hit.Score, hit.Document)
+		}
+	}
+}
+
+func TestShardedIndexIDKey(t *testing.T) {
+	s := NewShardedIndex(8, map[string]*analyzer.Analyzer{"_id": CaseInsensitiveIDAnalyzer})
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("city-%d", i)
+		if a, b := s.shardFor(MapDocument{"_id": {id}}), s.shardFor(MapDocument{"_id": {" " + strings.ToUpper(id)}}); a != b {
+			t.Fatalf("%s: expected the same shard for equal ids, got %d and %d", id, a, b)
+		}
+	}
+}
+
+func TestShardTermsNoTokens(t *testing.T) {
+	s := NewShardedIndex(2, nil)
+	s.Index(&ExampleCity{ID: 0, Name: "Amsterdam"}, &ExampleCity{ID: 1, Name: "Sofia"})
+
+	if top := s.TopN(10, s.Terms("name", " ,. "), nil); top.Total != 0 {
+		t.Fatalf("expected match none, got %v", top.Total)
+	}
+	for _, shard := range s.Shards() {
+		shard.NoTokens = NoTokensMatchAll
+	}
+	if top := s.TopN(10, s.Terms("name", " ,. "), nil); top.Total != 2 {
+		t.Fatalf("expected match all, got %v", top.Total)
+	}
+}
+
+func TestShardedCapacity(t *testing.T) {
+	s := NewShardedIndex(4, nil)
+	if max := s.Shards()[3].maxDocumentID; int64(max)*4+3 > math.MaxInt32 || int64(max+1)*4+3 <= math.MaxInt32 {
+		t.Fatalf("unexpected capacity %d", max)
+	}
+
+	// a full shard does not index, the other shards still do
+	s.Shards()[0].maxDocumentID = 1
+	dids := s.Index(&ExampleCity{ID: 0, Name: "a"}, &ExampleCity{ID: 4, Name: "a"}, &ExampleCity{ID: 8, Name: "a"}, &ExampleCity{ID: 1, Name: "a"})
+	if dids[0] != 0 || dids[1] != 4 || dids[2] != -1 || dids[3] != 1 {
+		t.Fatalf("unexpected ids %v", dids)
+	}
+	if top := s.TopN(10, s.Terms("name", "a"), nil); top.Total != 3 {
+		t.Fatalf("expected 3 got %d", top.Total)
+	}
+}
@@ -0,0 +1,177 @@
+package index
+
+import iq "github.com/rekki/go-query"
+
+// FieldPostingStats are the aggregate posting list statistics of a field, see PostingStats
+type FieldPostingStats struct {
+	// Terms is the number of distinct terms with postings
+	Terms int `json:"terms"`
+	// Postings is the total number of entries in all posting lists
+	Postings int `json:"postings"`
+	// MinLength, MaxLength and AvgLength are the min, max and average posting list length
+	MinLength int     `json:"min_length"`
+	MaxLength int     `json:"max_length"`
+	AvgLength float64 `json:"avg_length"`
+	// MaxTerm is the term with the longest posting list, e.g. a term in every document
+	MaxTerm string `json:"max_term"`
+}
+
+// PostingStats computes the posting statistics of every field in one pass over the postings,
+// to decide on posting compression or sharding and to spot pathological fields
+func (m *MemOnlyIndex) PostingStats() map[string]FieldPostingStats {
+	m.RLock()
+	defer m.RUnlock()
+
+	out := map[string]FieldPostingStats{}
+	for _, field := range m.postings.Fields() {
+		s := FieldPostingStats{}
+		m.postings.Iterate(field, func(t string, postings []int32) {
+			n := len(postings)
+			if n == 0 {
+				return
+			}
+			if s.Terms == 0 || n < s.MinLength {
+				s.MinLength = n
+			}
+			if n > s.MaxLength || (n == s.MaxLength && t < s.MaxTerm) {
+				s.MaxLength = n
+				s.MaxTerm = t
+			}
+			s.Terms++
+			s.Postings += n
+		})
+		if s.Terms == 0 {
+			continue
+		}
+		s.AvgLength = float64(s.Postings) / float64(s.Terms)
+		out[field] = s
+	}
+	return out
+}
+
+// TokenStats are the number of tokens the index analysis of a field produced, see FieldTokenStats
+type TokenStats struct {
+	// Tokens is the total number of tokens of the field in all documents
+	Tokens int `json:"tokens"`
+	// Documents is the number of documents with the field
+	Documents int `json:"documents"`
+	// AvgPerDocument and MaxPerDocument are the average and max number of tokens of the field in a document
+	AvgPerDocument float64 `json:"avg_per_document"`
+	MaxPerDocument int     `json:"max_per_document"`
+}
+
+// FieldTokenStats returns the token counts of every field of the indexed (not deleted) documents, from the field lengths recorded by Index,
+// to spot analyzer misconfiguration, e.g. an edge ngram field producing 50 times the tokens of the text
+func (m *MemOnlyIndex) FieldTokenStats() map[string]TokenStats {
+	m.RLock()
+	defer m.RUnlock()
+
+	out := map[string]TokenStats{}
+	for field, lengths := range m.fieldLen {
+		if len(lengths) == 0 {
+			continue
+		}
+		s := TokenStats{Documents: len(lengths)}
+		for _, n := range lengths {
+			s.Tokens += int(n)
+			if int(n) > s.MaxPerDocument {
+				s.MaxPerDocument = int(n)
+			}
+		}
+		s.AvgPerDocument = float64(s.Tokens) / float64(s.Documents)
+		out[field] = s
+	}
+	return out
+}
+
+// IsDeleted returns true if the document id is in the range of the index but has no document, because it was deleted
+// (or, with UseDocumentID, was never used)
+func (m *MemOnlyIndex) IsDeleted(did int32) bool {
+	m.RLock()
+	defer m.RUnlock()
+
+	return did >= 0 && int(did) < m.forward.size() && m.forward.get(did) == nil
+}
+
+// DanglingPostings finds the postings of documents that are not in the index (deleted or out of range) by "field:term",
+// it is a diagnostic of the delete path, after Delete there should be none
+func (m *MemOnlyIndex) DanglingPostings() map[string][]int32 {
+	m.RLock()
+	defer m.RUnlock()
+
+	out := map[string][]int32{}
+	for _, field := range m.postings.Fields() {
+		m.postings.Iterate(field, func(t string, postings []int32) {
+			for _, did := range postings {
+				if m.forward.get(did) == nil {
+					key := field + ":" + t
+					out[key] = append(out[key], did)
+				}
+			}
+		})
+	}
+	return out
+}
+
+// ScoreDistribution is the histogram of the scores of all the matches of a query, see ScoreHistogram
+type ScoreDistribution struct {
+	// Min and Max are the lowest and highest score, 0 without matches
+	Min float32 `json:"min"`
+	Max float32 `json:"max"`
+	// Total is the number of matches
+	Total int `json:"total"`
+	// Buckets are the number of matches per score range, the ranges split [Min, Max] in equal parts, see Bucket
+	Buckets []int `json:"buckets"`
+}
+
+// Bucket returns the score range of the bucket, from inclusive and to exclusive (inclusive for the last bucket)
+func (s ScoreDistribution) Bucket(i int) (from float32, to float32) {
+	width := (s.Max - s.Min) / float32(len(s.Buckets))
+	from = s.Min + float32(i)*width
+	if i == len(s.Buckets)-1 {
+		return from, s.Max
+	}
+	return from, from + width
+}
+
+// ScoreHistogram runs the query with Foreach, without top k truncation, and counts the scores of the matches in buckets,
+// e.g. to pick a TopNOptions.MinScore from the distribution instead of guessing. The scores are kept in memory (4 bytes per match)
+// until the range is known. buckets smaller than 1 is 1
+//
+// Example:
+//  h := m.ScoreHistogram(iq.Or(m.Terms("name", "amsterdam")...), 10)
+//  for i, n := range h.Buckets {
+//  	from, to := h.Bucket(i)
+//  	log.Printf("%.2f-%.2f: %d", from, to, n)
+//  }
+func (m *MemOnlyIndex) ScoreHistogram(query iq.Query, buckets int) ScoreDistribution {
+	if buckets < 1 {
+		buckets = 1
+	}
+	out := ScoreDistribution{Buckets: make([]int, buckets)}
+
+	scores := []float32{}
+	m.Foreach(query, func(did int32, score float32, doc Document) {
+		if len(scores) == 0 || score < out.Min {
+			out.Min = score
+		}
+		if len(scores) == 0 || score > out.Max {
+			out.Max = score
+		}
+		scores = append(scores, score)
+	})
+	out.Total = len(scores)
+
+	width := (out.Max - out.Min) / float32(buckets)
+	for _, score := range scores {
+		i := buckets - 1
+		if width > 0 {
+			i = int((score - out.Min) / width)
+		}
+		if i >= buckets {
+			i = buckets - 1
+		}
+		out.Buckets[i]++
+	}
+	return out
+}
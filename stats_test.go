@@ -0,0 +1,126 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+	analyzer "github.com/rekki/go-query-analyze"
+)
+
+func TestPostingStats(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		MapDocument{"name": {"Amsterdam Noord"}, "country": {"NL"}},
+		MapDocument{"name": {"Amsterdam Zuid"}, "country": {"NL"}},
+		MapDocument{"name": {"Rotterdam"}, "country": {"NL"}},
+		MapDocument{"name": {"Sofia"}},
+	)
+	m.Delete(3)
+
+	stats := m.PostingStats()
+	name := stats["name"]
+	if name.Terms != 4 || name.Postings != 5 || name.MinLength != 1 || name.MaxLength != 2 || name.MaxTerm != "amsterdam" || name.AvgLength != 1.25 {
+		t.Fatalf("unexpected name stats %+v", name)
+	}
+	country := stats["country"]
+	if country.Terms != 1 || country.MaxLength != 3 || country.MaxTerm != "nl" {
+		t.Fatalf("unexpected country stats %+v", country)
+	}
+}
+
+func TestFieldTokenStats(t *testing.T) {
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"autocomplete": AutocompleteAnalyzer})
+	m.Index(
+		MapDocument{"name": {"Amsterdam Noord"}, "autocomplete": {"Amsterdam Noord"}},
+		MapDocument{"name": {"Sofia"}, "autocomplete": {"Sofia"}},
+		MapDocument{"name": {"Paris"}},
+	)
+	m.Delete(2)
+
+	stats := m.FieldTokenStats()
+	if s := stats["name"]; s.Tokens != 3 || s.Documents != 2 || s.AvgPerDocument != 1.5 || s.MaxPerDocument != 2 {
+		t.Fatalf("unexpected name stats %+v", s)
+	}
+	if s := stats["autocomplete"]; s.Tokens != 9+5+5 || s.Documents != 2 || s.MaxPerDocument != 14 {
+		t.Fatalf("unexpected autocomplete stats %+v", s)
+	}
+}
+
+func TestDanglingPostings(t *testing.T) {
+	words := []string{"amsterdam", "sofia", "paris", "berlin", "new", "york", "zurich"}
+	for _, stored := range [][]string{nil, {"name"}} {
+		m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"names": FuzzyAnalyzer})
+		m.StoredFields = stored
+		r := rand.New(rand.NewSource(42))
+		for i := 0; i < 500; i++ {
+			m.Index(MapDocument{
+				"_id":   {fmt.Sprintf("%d", i)},
+				"name":  {words[r.Intn(len(words))] + " " + words[r.Intn(len(words))]},
+				"names": {words[r.Intn(len(words))], words[r.Intn(len(words))]},
+			})
+		}
+
+		deleted := map[int32]bool{}
+		for i := 0; i < 200; i++ {
+			did := int32(r.Intn(500))
+			if r.Intn(2) == 0 {
+				m.Delete(did)
+			} else {
+				m.DeleteByID(fmt.Sprintf("%d", did))
+			}
+			deleted[did] = true
+		}
+
+		if dangling := m.DanglingPostings(); len(dangling) != 0 {
+			t.Fatalf("stored %v: dangling postings %v", stored, dangling)
+		}
+		for did := int32(-1); did < 501; did++ {
+			if m.IsDeleted(did) != deleted[did] {
+				t.Fatalf("stored %v: %d expected deleted %v", stored, did, deleted[did])
+			}
+		}
+
+		// a posting the delete path missed
+		for did := range deleted {
+			m.postings.Add("name", "amsterdam", did)
+			if dangling := m.DanglingPostings(); len(dangling) != 1 || len(dangling["name:amsterdam"]) != 1 || dangling["name:amsterdam"][0] != did {
+				t.Fatalf("expected the dangling posting of %d, got %v", did, dangling)
+			}
+			break
+		}
+	}
+}
+
+func TestScoreHistogram(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		MapDocument{"name": {"Amsterdam Noord"}},
+		MapDocument{"name": {"Amsterdam Zuid"}},
+		MapDocument{"name": {"Amsterdam"}},
+		MapDocument{"name": {"Noord"}},
+		MapDocument{"name": {"Sofia"}},
+	)
+	query := func() iq.Query {
+		return iq.Or(m.NewTermQuery("name", "amsterdam"), m.NewTermQuery("name", "noord").SetBoost(3))
+	}
+
+	h := m.ScoreHistogram(query(), 4)
+	if h.Total != 4 || fmt.Sprintf("%v", h.Buckets) != "[2 0 1 1]" {
+		t.Fatalf("unexpected histogram %+v", h)
+	}
+	if from, to := h.Bucket(3); from >= to || to != h.Max {
+		t.Fatalf("unexpected last bucket %f-%f", from, to)
+	}
+	if from, _ := h.Bucket(0); from != h.Min {
+		t.Fatalf("unexpected first bucket %f", from)
+	}
+
+	if h := m.ScoreHistogram(m.NewTermQuery("name", "sofia"), 0); h.Total != 1 || fmt.Sprintf("%v", h.Buckets) != "[1]" {
+		t.Fatalf("unexpected histogram %+v", h)
+	}
+	if h := m.ScoreHistogram(m.NewTermQuery("name", "paris"), 3); h.Total != 0 || fmt.Sprintf("%v", h.Buckets) != "[0 0 0]" {
+		t.Fatalf("unexpected histogram %+v", h)
+	}
+}
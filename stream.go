@@ -0,0 +1,86 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	iq "github.com/rekki/go-query"
+)
+
+// StreamJSONFlushEvery is the number of hits StreamJSON writes between flushes
+var StreamJSONFlushEvery = 100
+
+// StreamJSON writes every matching document to w as JSON array of Hit while iterating the query, without keeping them in memory,
+// the score is computed by cb as in TopN (the original score is used if cb is nil) and the hits are in document id order.
+// The query is iterated in chunks of StreamJSONFlushEvery hits under the read lock, the chunk is encoded and written
+// (and flushed, including w itself if it has Flush(), e.g. http.Flusher) after the lock is released, so a slow client does not block indexing.
+// cb is called outside of the lock too.
+// If a document can not be encoded the array is closed after the previous hit, so the output is always valid JSON, and the error is returned
+//
+// Example:
+//  func handler(w http.ResponseWriter, r *http.Request) {
+//  	w.Header().Set("Content-Type", "application/json")
+//  	err := m.StreamJSON(w, iq.Or(m.Terms("country", "NL")...), nil)
+//  	if err != nil {
+//  		log.Printf("export failed: %v", err)
+//  	}
+//  }
+func (m *MemOnlyIndex) StreamJSON(w io.Writer, query iq.Query, cb func(int32, float32, Document) float32) error {
+	bw := bufio.NewWriter(w)
+	flush := func() error {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if f, ok := w.(interface{ Flush() }); ok {
+			f.Flush()
+		}
+		return nil
+	}
+
+	size := StreamJSONFlushEvery
+	if size < 1 {
+		size = 1
+	}
+
+	_, err := bw.WriteString("[")
+	n := 0
+	chunk := make([]Hit, 0, size)
+	for err == nil {
+		chunk = chunk[:0]
+		m.ForeachUntil(query, func(did int32, score float32, d Document) bool {
+			chunk = append(chunk, Hit{Score: score, ID: did, Document: d})
+			return len(chunk) < size
+		})
+
+		for _, hit := range chunk {
+			if cb != nil {
+				hit.Score = cb(hit.ID, hit.Score, hit.Document)
+			}
+			data, e := json.Marshal(hit)
+			if e != nil {
+				err = e
+				break
+			}
+			if n > 0 {
+				bw.WriteByte(',')
+			}
+			bw.Write(data)
+			n++
+		}
+		if len(chunk) < size {
+			break
+		}
+		if err == nil {
+			err = flush()
+		}
+	}
+
+	if _, e := bw.WriteString("]"); e != nil && err == nil {
+		err = e
+	}
+	if e := flush(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
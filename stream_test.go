@@ -0,0 +1,111 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	iq "github.com/rekki/go-query"
+)
+
+type unencodableCity struct {
+	ExampleCity
+	Broken func()
+}
+
+func TestStreamJSON(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	for i := 0; i < 250; i++ {
+		m.Index(&ExampleCity{Name: "Amsterdam", Country: "NL"})
+	}
+	m.Index(&ExampleCity{Name: "Sofia", Country: "BG"})
+
+	var out bytes.Buffer
+	err := m.StreamJSON(&out, iq.Or(m.Terms("country", "NL")...), func(did int32, score float32, d Document) float32 {
+		return float32(did)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hits := []struct {
+		Score float32
+		ID    int32
+	}{}
+	if err := json.Unmarshal(out.Bytes(), &hits); err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 250 || hits[249].ID != 249 || hits[249].Score != 249 {
+		t.Fatalf("unexpected hits %v", len(hits))
+	}
+
+	out.Reset()
+	err = m.StreamJSON(&out, iq.Or(m.Terms("country", "BG")...), nil)
+	if err != nil || !json.Valid(out.Bytes()) {
+		t.Fatalf("unexpected output %s %v", out.String(), err)
+	}
+
+	m.Index(&unencodableCity{ExampleCity: ExampleCity{Name: "Broken", Country: "NL"}, Broken: func() {}})
+	out.Reset()
+	err = m.StreamJSON(&out, iq.Or(m.Terms("country", "NL")...), nil)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if err := json.Unmarshal(out.Bytes(), &hits); err != nil || len(hits) != 250 {
+		t.Fatalf("expected valid json with 250 hits, got %v %d", err, len(hits))
+	}
+}
+
+// blockingWriter blocks the writes until release is closed
+type blockingWriter struct {
+	bytes.Buffer
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case w.writing <- struct{}{}:
+	default:
+	}
+	<-w.release
+	return w.Buffer.Write(p)
+}
+
+func TestStreamJSONSlowClient(t *testing.T) {
+	defer func(n int) { StreamJSONFlushEvery = n }(StreamJSONFlushEvery)
+	StreamJSONFlushEvery = 10
+
+	m := NewMemOnlyIndex(nil)
+	for i := 0; i < 25; i++ {
+		m.Index(&ExampleCity{Name: "Amsterdam", Country: "NL"})
+	}
+
+	w := &blockingWriter{writing: make(chan struct{}, 1), release: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		done <- m.StreamJSON(w, iq.Or(m.Terms("country", "NL")...), nil)
+	}()
+
+	<-w.writing
+	indexed := make(chan struct{})
+	go func() {
+		m.Index(&ExampleCity{Name: "Sofia", Country: "BG"})
+		close(indexed)
+	}()
+	select {
+	case <-indexed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Index blocked by the stalled client")
+	}
+
+	close(w.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	hits := []struct{ ID int32 }{}
+	if err := json.Unmarshal(w.Bytes(), &hits); err != nil || len(hits) != 25 {
+		t.Fatalf("expected 25 hits, got %d %v", len(hits), err)
+	}
+}
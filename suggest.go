@@ -0,0 +1,228 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	iq "github.com/rekki/go-query"
+)
+
+// SuggestMaxDistance returns the maximum edit distance for a term of this length (in runes) used by Suggest
+var SuggestMaxDistance = func(length int) int {
+	if length <= 4 {
+		return 1
+	}
+	return 2
+}
+
+// Suggest returns up to max indexed terms of this field close to term by edit distance, to be used for "did you mean"
+//
+// term is analyzed with the search analyzer of the field and its last token is used,
+// the term itself is never suggested. Candidates within SuggestMaxDistance are ranked by
+// distance, then by document frequency (more documents first) and finally alphabetically
+func (m *MemOnlyIndex) Suggest(field, term string, max int) []string {
+	m.RLock()
+	defer m.RUnlock()
+
+	term, ok := m.lastSearchToken(field, term)
+	if !ok || max <= 0 {
+		return []string{}
+	}
+
+	type candidate struct {
+		term     string
+		distance int
+		count    int
+	}
+
+	length := utf8.RuneCountInString(term)
+	maxDistance := SuggestMaxDistance(length)
+	candidates := []candidate{}
+	m.postings.Iterate(field, func(t string, postings []int32) {
+		if len(postings) == 0 || t == term {
+			return
+		}
+		diff := utf8.RuneCountInString(t) - length
+		if diff > maxDistance || -diff > maxDistance {
+			return
+		}
+		distance := editDistance(term, t)
+		if distance <= maxDistance {
+			candidates = append(candidates, candidate{term: t, distance: distance, count: len(postings)})
+		}
+	})
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		return a.term < b.term
+	})
+
+	out := []string{}
+	for i := 0; i < len(candidates) && i < max; i++ {
+		out = append(out, candidates[i].term)
+	}
+	return out
+}
+
+func (m *MemOnlyIndex) lastSearchToken(field, s string) (string, bool) {
+	tokens := truncateTerms(m.analyzerFor(field).AnalyzeSearch(s), m.MaxTermLength)
+	if len(tokens) == 0 {
+		return "", false
+	}
+	return tokens[len(tokens)-1], true
+}
+
+// editDistance is the levenshtein distance between a and b in runes
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// Suggestion is an indexed term and the number of documents it appears in
+type Suggestion struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+	// Surface is the original text of the term (see SurfaceForm), to be displayed
+	Surface string `json:"surface"`
+}
+
+// Complete returns up to max indexed terms of this field starting with prefix, the most popular (by document frequency) first, ties are sorted alphabetically
+//
+// prefix is analyzed with the search analyzer of the field and its last token is used.
+// Use it on a field indexed with whole tokens (e.g. DefaultAnalyzer), on a field indexed with
+// AutocompleteAnalyzer every prefix is itself an indexed term, so the prefixes would be returned as well.
+//
+// Example:
+//  for _, s := range m.Complete("name", "ams", 5) {
+//  	log.Printf("%s (%d)", s.Term, s.Count)
+//  }
+func (m *MemOnlyIndex) Complete(field, prefix string, max int) []Suggestion {
+	m.RLock()
+	defer m.RUnlock()
+
+	prefix, ok := m.lastSearchToken(field, prefix)
+	if !ok || max <= 0 {
+		return []Suggestion{}
+	}
+
+	out := []Suggestion{}
+	m.postings.Iterate(field, func(t string, postings []int32) {
+		if len(postings) > 0 && strings.HasPrefix(t, prefix) {
+			out = append(out, Suggestion{Term: t, Count: len(postings), Surface: m.surfaceFormLocked(field, t)})
+		}
+	})
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Term < out[j].Term
+	})
+
+	if len(out) > max {
+		out = out[:max]
+	}
+	return out
+}
+
+// PrefixMaxExpansions is the maximum number of indexed terms a PrefixQuery matches, the most popular ones are kept
+var PrefixMaxExpansions = 100
+
+// PrefixQuery creates OR query of the indexed terms of this field starting with the (already analyzed) prefix,
+// up to PrefixMaxExpansions of them, the most popular (by document frequency) first
+func (m *MemOnlyIndex) PrefixQuery(field string, prefix string) iq.Query {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.prefixQueryLocked(field, prefix)
+}
+
+func (m *MemOnlyIndex) prefixQueryLocked(field string, prefix string) iq.Query {
+	terms := []Suggestion{}
+	m.postings.Iterate(field, func(t string, postings []int32) {
+		if len(postings) > 0 && strings.HasPrefix(t, prefix) {
+			terms = append(terms, Suggestion{Term: t, Count: len(postings)})
+		}
+	})
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count != terms[j].Count {
+			return terms[i].Count > terms[j].Count
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > PrefixMaxExpansions {
+		terms = terms[:PrefixMaxExpansions]
+	}
+
+	queries := []iq.Query{}
+	for _, t := range terms {
+		queries = append(queries, m.newTermQueryLocked(field, t.Term))
+	}
+	return iq.Or(queries...)
+}
+
+// SearchAsYouType creates AND query of the text typed so far in a search box: the tokens are searched exactly,
+// except the last one which is still being typed and is searched as a prefix (see PrefixQuery). If the text ends with whitespace
+// the last token is complete and searched exactly too. As Complete, use it on a field indexed with whole tokens,
+// it gives typeahead without indexing every prefix with AutocompleteAnalyzer
+//
+// Example:
+//  query := m.SearchAsYouType("name", "new yo") // new AND (york OR yonkers ...)
+func (m *MemOnlyIndex) SearchAsYouType(field string, text string) iq.Query {
+	m.RLock()
+	defer m.RUnlock()
+
+	tokens := m.searchTokensLocked(field, text)
+	if len(tokens) == 0 {
+		return iq.Or()
+	}
+	typing := ""
+	if r, _ := utf8.DecodeLastRuneInString(text); !unicode.IsSpace(r) {
+		typing = tokens[len(tokens)-1]
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	queries := []iq.Query{}
+	for _, t := range tokens {
+		queries = append(queries, m.newTermQueryLocked(field, t))
+	}
+	if typing != "" {
+		queries = append(queries, m.prefixQueryLocked(field, typing))
+	}
+	return iq.And(queries...)
+}
@@ -0,0 +1,144 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestSuggest(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	list := []*ExampleCity{
+		{Name: "Amsterdam"},
+		{Name: "Amsterdam"},
+		{Name: "Amstelveen"},
+		{Name: "Rotterdam"},
+		{Name: "Amsterdan"},
+		{Name: "Sofia"},
+	}
+	m.Index(toDocuments(list)...)
+
+	got := m.Suggest("name", "Amsterdm", 10)
+	if fmt.Sprintf("%v", got) != "[amsterdam amsterdan]" {
+		t.Fatalf("unexpected suggestions %v", got)
+	}
+
+	got = m.Suggest("name", "amsterdam", 1)
+	if fmt.Sprintf("%v", got) != "[amsterdan]" {
+		t.Fatalf("unexpected suggestions %v", got)
+	}
+
+	got = m.Suggest("name", "sofa", 10)
+	if fmt.Sprintf("%v", got) != "[sofia]" {
+		t.Fatalf("unexpected suggestions %v", got)
+	}
+
+	if len(m.Suggest("name", "xyz", 10)) != 0 || len(m.Suggest("missing", "sofia", 10)) != 0 {
+		t.Fatal("expected no suggestions")
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		d    int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"zürich", "zurich", 1},
+	}
+	for _, c := range cases {
+		if editDistance(c.a, c.b) != c.d {
+			t.Fatalf("%s %s expected %d got %d", c.a, c.b, c.d, editDistance(c.a, c.b))
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	list := []*ExampleCity{
+		{Name: "Amsterdam"},
+		{Name: "Amsterdam Zuid"},
+		{Name: "Amstelveen"},
+		{Name: "Ams"},
+		{Name: "Rotterdam"},
+	}
+	m.Index(toDocuments(list)...)
+
+	got := m.Complete("name", "AMS", 10)
+	if fmt.Sprintf("%v", got) != "[{amsterdam 2 amsterdam} {ams 1 ams} {amstelveen 1 amstelveen}]" {
+		t.Fatalf("unexpected completions %v", got)
+	}
+
+	got = m.Complete("name", "amsterdam zu", 1)
+	if fmt.Sprintf("%v", got) != "[{zuid 1 zuid}]" {
+		t.Fatalf("unexpected completions %v", got)
+	}
+
+	if len(m.Complete("name", "x", 10)) != 0 || len(m.Complete("name", "", 10)) != 0 {
+		t.Fatal("expected no completions")
+	}
+}
+
+func TestSurfaceForm(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.KeepSurfaceForms = true
+	m.Index(
+		MapDocument{"name": {"Zürich, Schweiz"}},
+		MapDocument{"name": {"São Paulo"}},
+		MapDocument{"name": {"zurich"}},
+	)
+
+	if m.SurfaceForm("name", "zurich") != "Zürich" || m.SurfaceForm("name", "sao") != "São" || m.SurfaceForm("name", "schweiz") != "Schweiz" {
+		t.Fatalf("unexpected surface forms %v", m.surface)
+	}
+	if m.SurfaceForm("name", "zur") != "zur" || m.SurfaceForm("unknown", "zurich") != "zurich" {
+		t.Fatalf("expected unknown tokens as they are")
+	}
+
+	got := m.Complete("name", "zür", 1)
+	if len(got) != 1 || got[0].Term != "zurich" || got[0].Surface != "Zürich" {
+		t.Fatalf("unexpected completions %v", got)
+	}
+}
+
+func TestSearchAsYouType(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	list := []*ExampleCity{
+		{Name: "New York"},
+		{Name: "New Yorkshire"},
+		{Name: "York"},
+		{Name: "New Delhi"},
+		{Name: "Newark"},
+	}
+	m.Index(toDocuments(list)...)
+
+	search := func(q iq.Query) string {
+		dids := []int32{}
+		m.Foreach(q, func(did int32, score float32, doc Document) {
+			dids = append(dids, did)
+		})
+		return fmt.Sprintf("%v", dids)
+	}
+	for text, expected := range map[string]string{
+		"new yo":    "[0 1]",
+		"New York":  "[0 1]",
+		"new york ": "[0]",
+		"new":       "[0 1 3 4]",
+		"new ":      "[0 1 3]",
+		"new x":     "[]",
+		"  ":        "[]",
+	} {
+		if got := search(m.SearchAsYouType("name", text)); got != expected {
+			t.Fatalf("%q: expected %s got %s", text, expected, got)
+		}
+	}
+
+	defer func(n int) { PrefixMaxExpansions = n }(PrefixMaxExpansions)
+	PrefixMaxExpansions = 1
+	if got := search(m.PrefixQuery("name", "new")); got != "[0 1 3]" {
+		t.Fatalf("expected the most popular expansion only, got %s", got)
+	}
+}
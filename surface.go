@@ -0,0 +1,51 @@
+package index
+
+import (
+	"strings"
+	"unicode"
+
+	analyzer "github.com/rekki/go-query-analyze"
+)
+
+// addSurfaceForms remembers the original word of every whitespace separated word of s that analyzes to a single search token,
+// words producing more tokens (or none) can not be mapped back and are skipped, the first seen form of a token is kept
+func (m *MemOnlyIndex) addSurfaceForms(field string, a *analyzer.Analyzer, s string) {
+	forms, ok := m.surface[field]
+	if !ok {
+		if m.surface == nil {
+			m.surface = map[string]map[string]string{}
+		}
+		forms = map[string]string{}
+		m.surface[field] = forms
+	}
+
+	for _, word := range strings.Fields(s) {
+		word = strings.TrimFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		tokens := m.analyzeIndex(a, word)
+		search := truncateTerms(a.AnalyzeSearch(word), m.MaxTermLength)
+		if len(search) != 1 || len(tokens) == 0 {
+			continue
+		}
+		if _, ok := forms[search[0]]; !ok {
+			forms[search[0]] = word
+		}
+	}
+}
+
+// SurfaceForm returns the original text of an indexed token, e.g. "Zürich" for "zurich", to show it instead of the analyzed token
+// it requires KeepSurfaceForms, the token itself is returned if its original text is unknown
+func (m *MemOnlyIndex) SurfaceForm(field, token string) string {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.surfaceFormLocked(field, token)
+}
+
+func (m *MemOnlyIndex) surfaceFormLocked(field, token string) string {
+	if form, ok := m.surface[field][token]; ok {
+		return form
+	}
+	return token
+}
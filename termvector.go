@@ -0,0 +1,58 @@
+package index
+
+// WithTermVectors makes MemOnlyIndex keep the terms and their frequencies of every indexed field of every document,
+// so TermVector (and MoreLikeThis) do not analyze the document again. It costs a map per field per document,
+// usually more memory than the postings of the same fields
+func WithTermVectors() Option {
+	return func(o *options) {
+		o.termVectors = true
+	}
+}
+
+// TermVector returns the indexed terms of the document field with the number of times each is in the field, or nil if the document is deleted.
+// With WithTermVectors the stored vector is returned and it must not be modified, otherwise (or for documents merged
+// from an index without term vectors) the field is analyzed again,
+// which needs the field in the forward document (see StoredFields) and misses the fields of ReaderDocument
+func (m *MemOnlyIndex) TermVector(did int32, field string) map[string]int {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.termVectorLocked(did, field)
+}
+
+func (m *MemOnlyIndex) termVectorLocked(did int32, field string) map[string]int {
+	d := m.forward.get(did)
+	if d == nil {
+		return nil
+	}
+	if fields, ok := m.termVectors[did]; ok {
+		tv := fields[field]
+		if tv == nil {
+			tv = map[string]int{}
+		}
+		return tv
+	}
+
+	tv := map[string]int{}
+	analyzer := m.analyzerFor(field)
+	for _, v := range m.indexedFieldsLocked(did, d)[field] {
+		for _, t := range m.analyzeIndex(analyzer, v) {
+			tv[t]++
+		}
+	}
+	return tv
+}
+
+func (m *MemOnlyIndex) addTermVector(did int32, field string, t string) {
+	fields, ok := m.termVectors[did]
+	if !ok {
+		fields = map[string]map[string]int{}
+		m.termVectors[did] = fields
+	}
+	tv, ok := fields[field]
+	if !ok {
+		tv = map[string]int{}
+		fields[field] = tv
+	}
+	tv[t]++
+}
@@ -0,0 +1,34 @@
+package index
+
+import (
+	"testing"
+)
+
+func TestTermVector(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithTermVectors()}} {
+		m := NewMemOnlyIndex(nil, opts...)
+		m.Index(
+			MapDocument{"name": {"Amsterdam Amsterdam", "Sofia"}},
+			MapDocument{"name": {"Sofia"}},
+		)
+
+		tv := m.TermVector(0, "name")
+		if len(tv) != 2 || tv["amsterdam"] != 2 || tv["sofia"] != 1 {
+			t.Fatalf("unexpected term vector %v", tv)
+		}
+		if tv := m.TermVector(0, "country"); len(tv) != 0 {
+			t.Fatalf("unexpected term vector %v", tv)
+		}
+
+		m.Delete(0)
+		if tv := m.TermVector(0, "name"); tv != nil {
+			t.Fatalf("expected nil term vector of deleted document, got %v", tv)
+		}
+	}
+
+	m := NewMemOnlyIndex(nil, WithTermVectors())
+	m.Index(&streamedDocument{name: "a", body: "Amsterdam amsterdam"})
+	if tv := m.TermVector(0, "body"); tv["amsterdam"] != 2 {
+		t.Fatalf("expected term vector of streamed field, got %v", tv)
+	}
+}
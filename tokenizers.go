@@ -0,0 +1,260 @@
+package index
+
+import (
+	"strings"
+	"unicode"
+
+	tokenize "github.com/rekki/go-query-analyze/tokenize"
+)
+
+// UnicodeSegment splits the text on transitions between letters, digits and the other characters, and between the scripts (latin, cyrillic, han..) of the letters,
+// the characters that are neither letters nor digits (whitespace, punctuation, symbols) separate tokens and are dropped, e.g.
+//  "abc123def word-word" -> "abc" "123" "def" "word" "word"
+// Combining marks stay with the preceding letter. The tokens are numbered with consecutive positions and keep the line of their input token
+type UnicodeSegment struct{}
+
+// NewUnicodeSegment creates UnicodeSegment tokenizer
+func NewUnicodeSegment() *UnicodeSegment {
+	return &UnicodeSegment{}
+}
+
+// segmentScripts are the scripts whose letters form separate tokens, letters of other scripts are one class
+var segmentScripts = []*unicode.RangeTable{
+	unicode.Latin,
+	unicode.Cyrillic,
+	unicode.Greek,
+	unicode.Han,
+	unicode.Hiragana,
+	unicode.Katakana,
+	unicode.Hangul,
+	unicode.Arabic,
+	unicode.Hebrew,
+	unicode.Thai,
+	unicode.Devanagari,
+}
+
+const (
+	segmentSeparator = -1
+	segmentDigit     = -2
+	segmentLetter    = -3
+)
+
+// segmentClass is the script index of a letter, or one of the segment constants
+func segmentClass(r rune) int {
+	switch {
+	case unicode.IsLetter(r):
+		for i, script := range segmentScripts {
+			if unicode.Is(script, r) {
+				return i
+			}
+		}
+		return segmentLetter
+	case unicode.IsDigit(r):
+		return segmentDigit
+	default:
+		return segmentSeparator
+	}
+}
+
+func (u *UnicodeSegment) Apply(current []tokenize.Token) []tokenize.Token {
+	out := []tokenize.Token{}
+	position := 0
+	for _, t := range current {
+		var sb strings.Builder
+		class := segmentSeparator
+		emit := func() {
+			if sb.Len() > 0 {
+				out = append(out, tokenize.Token{Text: sb.String(), Position: position, LineNo: t.LineNo})
+				position++
+				sb.Reset()
+			}
+		}
+		for _, r := range t.Text {
+			if unicode.IsMark(r) && class != segmentSeparator {
+				sb.WriteRune(r)
+				continue
+			}
+			c := segmentClass(r)
+			if c != class {
+				emit()
+				class = c
+			}
+			if c != segmentSeparator {
+				sb.WriteRune(r)
+			}
+		}
+		emit()
+	}
+	return out
+}
+
+// KeepOriginal applies the transform tokenizers (e.g. soundex or a stemmer) to every token and emits the original token
+// followed by the transformed ones at the same position, so both exact and transformed queries match ("keyword repeat"),
+// a transformed token equal to the original is not repeated
+//
+// Example:
+//  []tokenize.Tokenizer{tokenize.NewWhitespace(), index.NewKeepOriginal(tokenize.NewSoundex())}
+//  // "amsterdam" -> "amsterdam" "A523"
+type KeepOriginal struct {
+	transform []tokenize.Tokenizer
+}
+
+// NewKeepOriginal creates KeepOriginal tokenizer applying the transform tokenizers in order
+func NewKeepOriginal(transform ...tokenize.Tokenizer) *KeepOriginal {
+	return &KeepOriginal{transform: transform}
+}
+
+func (k *KeepOriginal) Apply(current []tokenize.Token) []tokenize.Token {
+	out := []tokenize.Token{}
+	for _, t := range current {
+		out = append(out, t)
+
+		transformed := []tokenize.Token{t}
+		for _, tokenizer := range k.transform {
+			transformed = tokenizer.Apply(transformed)
+		}
+		for _, x := range transformed {
+			if x.Text == t.Text {
+				continue
+			}
+			x.Position = t.Position
+			x.LineNo = t.LineNo
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// TrimToken trims the cutset from both ends of every token and drops the tokens that become empty (the others keep their positions),
+// e.g. "(amsterdam)," -> "amsterdam". The normalizer NewTrim trims the whole text once before tokenizing,
+// TrimToken trims every token after the tokenizers that split the text (use it after a custom or regex split leaving punctuation on the tokens)
+type TrimToken struct {
+	cutset string
+}
+
+// NewTrimToken creates TrimToken tokenizer
+func NewTrimToken(cutset string) *TrimToken {
+	return &TrimToken{cutset: cutset}
+}
+
+func (t *TrimToken) Apply(current []tokenize.Token) []tokenize.Token {
+	out := make([]tokenize.Token, 0, len(current))
+	for _, token := range current {
+		token.Text = strings.Trim(token.Text, t.cutset)
+		if token.Text != "" {
+			out = append(out, token)
+		}
+	}
+	return out
+}
+
+// RuneNgram is tokenize.CharNgram counting runes instead of bytes, so the ngrams of multibyte text are valid UTF-8,
+// e.g. NewRuneNgram(2): "café" -> "ca" "af" "fé". Tokens shorter than size runes are kept as they are
+type RuneNgram struct {
+	size int
+}
+
+// NewRuneNgram creates RuneNgram tokenizer
+func NewRuneNgram(size int) *RuneNgram {
+	return &RuneNgram{size: size}
+}
+
+func (w *RuneNgram) Apply(current []tokenize.Token) []tokenize.Token {
+	out := []tokenize.Token{}
+	for _, s := range current {
+		// byte offsets of the runes, and of the end
+		starts := []int{}
+		for i := range s.Text {
+			starts = append(starts, i)
+		}
+		if len(starts) < w.size {
+			out = append(out, s)
+			continue
+		}
+		starts = append(starts, len(s.Text))
+		for i := 0; i+w.size < len(starts); i++ {
+			out = append(out, s.Clone(s.Text[starts[i]:starts[i+w.size]]))
+		}
+	}
+	return out
+}
+
+// IdentifierSplit splits identifiers on the camelCase boundaries, on the transitions between letters and digits,
+// and on the underscores (and the other characters that are neither letters nor digits), the parts are lowercased, e.g.
+//  "getUserName" "get_user_name" -> "get" "user" "name"
+//  "HTTPServer2Config" -> "http" "server" "2" "config"
+// The parts keep the position and the line of the identifier. Use it with a normalizer that keeps the case (see IdentifierAnalyzer),
+// DefaultNormalizer lowercases the text before the tokenizers, so there would be no camelCase left to split
+type IdentifierSplit struct {
+	// KeepWhole emits the whole lowercased identifier before its parts, if it has more than one part
+	KeepWhole bool
+}
+
+// NewIdentifierSplit creates IdentifierSplit tokenizer
+func NewIdentifierSplit() *IdentifierSplit {
+	return &IdentifierSplit{}
+}
+
+func (s *IdentifierSplit) Apply(current []tokenize.Token) []tokenize.Token {
+	out := []tokenize.Token{}
+	for _, t := range current {
+		parts := splitIdentifier(t.Text)
+		if s.KeepWhole && len(parts) > 1 {
+			out = append(out, t.Clone(strings.ToLower(t.Text)))
+		}
+		for _, p := range parts {
+			out = append(out, t.Clone(strings.ToLower(p)))
+		}
+	}
+	return out
+}
+
+// splitIdentifier returns the parts of the identifier, see IdentifierSplit
+func splitIdentifier(s string) []string {
+	runes := []rune(s)
+	parts := []string{}
+	start := -1
+	for i, r := range runes {
+		if unicode.IsMark(r) && start >= 0 {
+			continue
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				parts = append(parts, string(runes[start:i]))
+				start = -1
+			}
+			continue
+		}
+		if start >= 0 && identifierBoundary(runes, i) {
+			parts = append(parts, string(runes[start:i]))
+			start = -1
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		parts = append(parts, string(runes[start:]))
+	}
+	return parts
+}
+
+// identifierBoundary returns true if a part starts at runes[i], the previous rune being a letter or digit (or a mark)
+func identifierBoundary(runes []rune, i int) bool {
+	prev := i - 1
+	for prev > 0 && unicode.IsMark(runes[prev]) {
+		prev--
+	}
+	p, r := runes[prev], runes[i]
+	switch {
+	case unicode.IsDigit(p) != unicode.IsDigit(r):
+		return true
+	case unicode.IsLower(p) && unicode.IsUpper(r):
+		// getUser
+		return true
+	case unicode.IsUpper(p) && unicode.IsUpper(r) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+		// the last capital of an acronym starts the next part, HTTPServer
+		return true
+	}
+	return false
+}
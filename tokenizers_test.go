@@ -0,0 +1,140 @@
+package index
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	iq "github.com/rekki/go-query"
+	analyzer "github.com/rekki/go-query-analyze"
+	tokenize "github.com/rekki/go-query-analyze/tokenize"
+)
+
+func TestUnicodeSegment(t *testing.T) {
+	for text, expected := range map[string]string{
+		"abc123def":         "abc 123 def",
+		"word-word":         "word word",
+		"  iPhone 12, 64GB": "iPhone 12 64 GB",
+		"Москва2020moscow":  "Москва 2020 moscow",
+		"東京tokyo":           "東京 tokyo",
+		"café-bar":         "café bar",
+		"cafe\u0301 bar":    "cafe\u0301 bar",
+		"--":                "",
+	} {
+		tokens := tokenize.Tokenize(text, NewUnicodeSegment())
+		if strings.Join(tokens, " ") != expected {
+			t.Fatalf("%q: expected %q got %q", text, expected, tokens)
+		}
+	}
+
+	tokens := tokenize.TokenizeT("ab1 c", tokenize.NewWhitespace(), NewUnicodeSegment())
+	for i, tok := range tokens {
+		if tok.Position != i {
+			t.Fatalf("unexpected positions %v", tokens)
+		}
+	}
+}
+
+func TestKeepOriginal(t *testing.T) {
+	tokens := tokenize.TokenizeT("amsterdam 12", tokenize.NewWhitespace(), NewKeepOriginal(tokenize.NewSoundex()))
+	texts := []string{}
+	for _, tok := range tokens {
+		texts = append(texts, tok.Text)
+	}
+	expected := []string{"amsterdam", tokenize.EncodeSoundex("amsterdam"), "12", tokenize.EncodeSoundex("12")}
+	if strings.Join(texts, " ") != strings.Join(expected, " ") || tokens[1].Position != tokens[0].Position || tokens[2].Position != 1 {
+		t.Fatalf("unexpected tokens %v", tokens)
+	}
+
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{
+		"name": analyzer.NewAnalyzer(DefaultNormalizer, []tokenize.Tokenizer{tokenize.NewWhitespace()}, []tokenize.Tokenizer{tokenize.NewWhitespace(), NewKeepOriginal(tokenize.NewSoundex())}),
+	})
+	m.Index(MapDocument{"name": {"Amsterdam"}})
+	for _, term := range []string{"amsterdam", tokenize.EncodeSoundex("amsterdam")} {
+		if m.DocFreq("name", term) != 1 {
+			t.Fatalf("expected %s to be indexed", term)
+		}
+	}
+}
+
+func TestTrimToken(t *testing.T) {
+	tokens := tokenize.TokenizeT(`"amsterdam", (sofia) -- paris.`, tokenize.NewWhitespace(), NewTrimToken(`"(),.-`))
+	texts := []string{}
+	for _, tok := range tokens {
+		texts = append(texts, tok.Text)
+	}
+	if strings.Join(texts, " ") != "amsterdam sofia paris" || tokens[2].Position != 3 {
+		t.Fatalf("unexpected tokens %v", tokens)
+	}
+}
+
+func TestRuneNgram(t *testing.T) {
+	a := analyzer.NewAnalyzer(nil, []tokenize.Tokenizer{tokenize.NewWhitespace()}, []tokenize.Tokenizer{tokenize.NewWhitespace(), NewRuneNgram(2), tokenize.NewSurround("$")})
+	for text, expected := range map[string]string{
+		"café":  "$ca af fé$",
+		"東京タワー": "$東京 京タ タワ ワー$",
+		"é":     "$é$",
+		"ab":    "$ab$",
+	} {
+		tokens := a.AnalyzeIndex(text)
+		for _, token := range tokens {
+			if !utf8.ValidString(token) {
+				t.Fatalf("%s: invalid ngram %q", text, token)
+			}
+		}
+		if strings.Join(tokens, " ") != expected {
+			t.Fatalf("%s: expected %q got %q", text, expected, strings.Join(tokens, " "))
+		}
+	}
+
+	for _, text := range []string{"Ελλάδα", "東京タワー", "Zürich"} {
+		for _, token := range FuzzyAnalyzer.AnalyzeIndex(text) {
+			if !utf8.ValidString(token) {
+				t.Fatalf("%s: invalid fuzzy token %q", text, token)
+			}
+		}
+	}
+
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"name": FuzzyAnalyzer})
+	m.Index(MapDocument{"name": {"東京タワー"}}, MapDocument{"name": {"大阪"}})
+	top := m.TopN(10, iq.Or(m.Terms("name", "東京タ")...), nil)
+	if top.Total != 1 || top.Hits[0].ID != 0 {
+		t.Fatalf("unexpected result %v", top)
+	}
+}
+
+func TestIdentifierSplit(t *testing.T) {
+	split := []tokenize.Tokenizer{tokenize.NewWhitespace(), NewIdentifierSplit()}
+	for text, expected := range map[string]string{
+		"getUserName":       "get user name",
+		"GetUserName":       "get user name",
+		"get_user_name":     "get user name",
+		"__init__":          "init",
+		"HTTPServer2Config": "http server 2 config",
+		"parseJSON utf8":    "parse json utf 8",
+		"user":              "user",
+		"Zürich_cafés":      "zürich cafés",
+	} {
+		if got := strings.Join(tokenize.Tokenize(text, split...), " "); got != expected {
+			t.Fatalf("%s: expected %q got %q", text, expected, got)
+		}
+	}
+
+	tokens := tokenize.TokenizeT("a getUserName", tokenize.NewWhitespace(), &IdentifierSplit{KeepWhole: true})
+	got := []string{}
+	for _, token := range tokens {
+		got = append(got, fmt.Sprintf("%s:%d", token.Text, token.Position))
+	}
+	if strings.Join(got, " ") != "a:0 getusername:1 get:1 user:1 name:1" {
+		t.Fatalf("unexpected tokens %v", got)
+	}
+
+	m := NewMemOnlyIndex(map[string]*analyzer.Analyzer{"name": IdentifierAnalyzer})
+	m.Index(MapDocument{"name": {"getUserName"}}, MapDocument{"name": {"get_user_name"}}, MapDocument{"name": {"HTTPServer2Config"}})
+	for text, expected := range map[string]int{"user": 2, "UserName": 2, "getusername": 1, "server": 1, "config": 1} {
+		if top := m.TopN(10, iq.And(m.Terms("name", text)...), nil); top.Total != expected {
+			t.Fatalf("%s: expected %d matches got %d", text, expected, top.Total)
+		}
+	}
+}
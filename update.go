@@ -0,0 +1,135 @@
+package index
+
+// hasReaders returns true if the document has fields indexed from readers, see ReaderDocument
+func hasReaders(d Document) bool {
+	_, ok := d.(ReaderDocument)
+	return ok
+}
+
+// IndexedFields returns the indexable fields of the document with the values changed by UpdateField, nil if there is no such document
+func (m *MemOnlyIndex) IndexedFields(did int32) map[string][]string {
+	m.RLock()
+	defer m.RUnlock()
+
+	d := m.forward.get(did)
+	if d == nil {
+		return nil
+	}
+	return m.indexedFieldsLocked(did, d)
+}
+
+// indexedFieldsLocked returns the indexable fields of the forward document d with the updated fields of did
+func (m *MemOnlyIndex) indexedFieldsLocked(did int32, d Document) map[string][]string {
+	updated, ok := m.updatedFields[did]
+	if !ok {
+		return d.IndexableFields()
+	}
+	out := map[string][]string{}
+	for k, v := range d.IndexableFields() {
+		out[k] = v
+	}
+	for k, v := range updated {
+		if len(v) == 0 {
+			delete(out, k)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// UpdatedDocument is the document the callbacks of Foreach, TopN (and its hits) and Cursor.Page get for a document changed by
+// UpdateField, its IndexableFields are the updated ones, Document is the indexed document (as returned by Get)
+//
+// Example:
+//  m.Foreach(query, func(did int32, score float32, doc index.Document) {
+//  	if u, ok := doc.(*index.UpdatedDocument); ok {
+//  		doc = u.Document
+//  	}
+//  	log.Printf("%s is out of stock", doc.(*ExampleCity).Name)
+//  })
+type UpdatedDocument struct {
+	Document
+	fields map[string][]string
+}
+
+// IndexableFields returns the fields with the values changed by UpdateField
+func (d *UpdatedDocument) IndexableFields() map[string][]string {
+	return d.fields
+}
+
+// updatedDocumentLocked returns d, or an UpdatedDocument if UpdateField changed it
+func (m *MemOnlyIndex) updatedDocumentLocked(did int32, d Document) Document {
+	if _, ok := m.updatedFields[did]; !ok {
+		return d
+	}
+	return &UpdatedDocument{Document: d, fields: m.indexedFieldsLocked(did, d)}
+}
+
+// UpdateField replaces the values of one field of the document, only the postings of this field are removed and added again,
+// which is much cheaper than indexing the whole document for a frequently changing field (e.g. stock).
+// The field does not have to exist before, and no values remove it. Get still returns the indexed document as it was,
+// the new values are kept next to it, see IndexedFields and UpdatedDocument.
+// A deleted document is not updated. IndexOrUpdate indexes the document again the next time, even if its version did not change
+//
+// Example:
+//  m.UpdateField(did, "stock", []string{"in_stock"})
+func (m *MemOnlyIndex) UpdateField(did int32, field string, values []string) {
+	m.Lock()
+	defer m.Unlock()
+
+	d := m.forward.get(did)
+	if d == nil {
+		return
+	}
+
+	m.unindexFieldLocked(d, did, field)
+	m.indexFieldLocked(did, field, values)
+
+	if m.updatedFields == nil {
+		m.updatedFields = map[int32]map[string][]string{}
+	}
+	updated, ok := m.updatedFields[did]
+	if !ok {
+		updated = map[string][]string{}
+		m.updatedFields[did] = updated
+	}
+	updated[field] = values
+	m.generation++
+}
+
+// unindexFieldLocked removes the postings (and the id, length, term vectors..) of the document field
+func (m *MemOnlyIndex) unindexFieldLocked(d Document, did int32, field string) {
+	fields := m.indexedFieldsLocked(did, d)
+	values := fields[field]
+	if len(m.StoredFields) > 0 || hasReaders(d) {
+		// the indexed values might not be in the forward document
+		m.postings.Iterate(field, func(t string, _ []int32) {
+			m.postings.Delete(field, t, did)
+		})
+	} else {
+		analyzer := m.analyzerFor(field)
+		for _, v := range values {
+			for _, t := range m.analyzeIndex(analyzer, v) {
+				m.postings.Delete(field, t, did)
+			}
+		}
+	}
+
+	for _, v := range fields[m.IDField] {
+		delete(m.versionByID, m.idKey(v))
+	}
+	if field == m.IDField {
+		for _, v := range values {
+			if current, ok := m.forwardByID[m.idKey(v)]; ok && current == did {
+				delete(m.forwardByID, m.idKey(v))
+			}
+		}
+	}
+
+	delete(m.fieldLen[field], did)
+	delete(m.termVectors[did], field)
+	if m.valueMatches != nil {
+		m.deleteFieldValueMatches(did, field)
+	}
+}
@@ -0,0 +1,95 @@
+package index
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestUpdateField(t *testing.T) {
+	m := NewMemOnlyIndex(nil)
+	m.Index(
+		&ExampleCity{Name: "Amsterdam", Country: "NL", TestID: "a"},
+		&ExampleCity{Name: "Sofia", Country: "BG", TestID: "b"},
+	)
+
+	count := func(field, text string) int {
+		return m.TopN(0, iq.Or(m.Terms(field, text)...), nil).Total
+	}
+
+	m.UpdateField(0, "country", []string{"Netherlands"})
+	if count("country", "nl") != 0 || count("country", "netherlands") != 1 || count("name", "amsterdam") != 1 {
+		t.Fatalf("unexpected postings after update")
+	}
+	city, ok := m.Get(0).(*ExampleCity)
+	if !ok || city.Country != "NL" || m.IndexedFields(0)["country"][0] != "Netherlands" {
+		t.Fatalf("unexpected forward document %v", m.Get(0))
+	}
+	if _, ok := m.GetByID("a").(*ExampleCity); !ok {
+		t.Fatalf("unexpected document by id %v", m.GetByID("a"))
+	}
+	m.Foreach(iq.Or(m.Terms("country", "netherlands")...), func(did int32, score float32, doc Document) {
+		u, ok := doc.(*UpdatedDocument)
+		if !ok || u.IndexableFields()["country"][0] != "Netherlands" {
+			t.Fatalf("unexpected matching document %v", doc)
+		}
+		if _, ok := u.Document.(*ExampleCity); !ok {
+			t.Fatalf("unexpected indexed document %v", u.Document)
+		}
+	})
+	if hits := m.TopN(1, iq.Or(m.Terms("name", "amsterdam")...), nil).Hits; len(hits) != 1 || hits[0].Document.IndexableFields()["country"][0] != "Netherlands" {
+		t.Fatalf("expected the hit to have the updated fields %v", hits)
+	}
+	if top := m.TopN(1, m.GeoWithin("lat", "lon", LatLon{Lat: 52.37, Lon: 4.89}, 10), nil); top.Total != 0 {
+		t.Fatalf("expected no document with a point yet")
+	}
+	m.UpdateField(0, "lat", []string{"52.37"})
+	m.UpdateField(0, "lon", []string{"4.89"})
+	if top := m.TopN(1, m.GeoWithin("lat", "lon", LatLon{Lat: 52.37, Lon: 4.89}, 10), nil); top.Total != 1 {
+		t.Fatalf("expected GeoWithin to use the updated point, got %d", top.Total)
+	}
+	m.UpdateField(0, "lat", nil)
+	m.UpdateField(0, "lon", nil)
+	m.UpdateField(0, "created_at", []string{strconv.FormatInt(time.Now().Add(-48*time.Hour).Unix(), 10)})
+	if top := m.TopN(1, iq.Or(m.Terms("name", "amsterdam")...), RecencyBoost("created_at", 24*time.Hour)); len(top.Hits) != 1 || top.Hits[0].Score > 0.26*m.TopN(1, iq.Or(m.Terms("name", "amsterdam")...), nil).Hits[0].Score {
+		t.Fatalf("expected RecencyBoost to decay the updated timestamp %v", top.Hits)
+	}
+	m.UpdateField(0, "created_at", nil)
+
+	// new field
+	m.UpdateField(0, "stock", []string{"in stock"})
+	m.UpdateField(0, "country", []string{"Holland"})
+	if count("stock", "stock") != 1 || count("country", "holland") != 1 || count("country", "netherlands") != 0 || m.FieldLength(0, "stock") != 2 {
+		t.Fatalf("unexpected postings after second update")
+	}
+
+	// removing the field
+	m.UpdateField(0, "stock", nil)
+	if count("stock", "stock") != 0 || m.FieldLength(0, "stock") != 0 {
+		t.Fatalf("expected stock to be removed")
+	}
+
+	m.UpdateField(1, "_id", []string{"c"})
+	if m.GetByID("b") != nil || m.GetByID("c") == nil {
+		t.Fatalf("expected id to be updated")
+	}
+
+	if _, ok := m.IndexedFields(1)["_id"]; !ok || m.IndexedFields(1)["_id"][0] != "c" {
+		t.Fatalf("unexpected indexed fields %v", m.IndexedFields(1))
+	}
+	m.Compact()
+	if m.IndexedFields(0)["country"][0] != "Holland" {
+		t.Fatalf("expected the updated fields to survive Compact, got %v", m.IndexedFields(0))
+	}
+
+	m.Delete(0)
+	if count("country", "holland") != 0 || count("name", "amsterdam") != 0 || m.GetByID("a") != nil {
+		t.Fatalf("expected updated document to be deleted")
+	}
+	m.UpdateField(0, "country", []string{"NL"})
+	if count("country", "nl") != 0 || m.IndexedFields(0) != nil {
+		t.Fatalf("expected deleted document not to be updated")
+	}
+}
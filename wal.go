@@ -0,0 +1,291 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// WAL is append only log of the operations on a MemOnlyIndex, so the index can be brought up to date after a restart
+// by replaying the log, without serializing the whole index on every change.
+// Index the documents through the WAL, the record is written before the index is changed.
+//
+// Replayed documents have the IndexableFields(), DocumentID(), Boost() and FieldBoosts() of the original ones (declared analyzers are lost),
+// documents with IndexableReaders() can not be logged. Delete records use document ids, so replay into the same state the log
+// was started from: an empty index, or the snapshot saved by Checkpoint
+//
+// Example:
+//  m := index.NewMemOnlyIndex(nil)
+//  wal, err := index.OpenWAL("/var/lib/cities.wal", m)
+//  if err != nil {
+//  	panic(err)
+//  }
+//  defer wal.Close()
+//  if err := wal.Replay(); err != nil {
+//  	panic(err)
+//  }
+//  _, err = wal.Index(&ExampleCity{Name: "Amsterdam", Country: "NL"})
+type WAL struct {
+	fn    string
+	f     *os.File
+	index *MemOnlyIndex
+
+	// Sync makes every write fsync the log, slower but the operations survive a crash of the machine, not only of the process
+	Sync bool
+	sync.Mutex
+}
+
+// ErrWALReaderDocument is returned by WAL.Index for documents with IndexableReaders(), the readers can not be logged and indexed too
+var ErrWALReaderDocument = errors.New("reader documents can not be logged")
+
+type walRecord struct {
+	Op          string              `json:"op"`
+	Fields      map[string][]string `json:"fields,omitempty"`
+	DocumentID  *int32              `json:"document_id,omitempty"`
+	Boost       *float32            `json:"boost,omitempty"`
+	FieldBoosts map[string]float32  `json:"field_boosts,omitempty"`
+	DID         int32               `json:"did,omitempty"`
+	ID          string              `json:"id,omitempty"`
+}
+
+func newWALIndexRecord(d Document) (walRecord, error) {
+	if _, ok := d.(ReaderDocument); ok {
+		return walRecord{}, ErrWALReaderDocument
+	}
+	r := walRecord{Op: walIndex, Fields: d.IndexableFields()}
+	if dd, ok := d.(DocumentWithID); ok {
+		did := dd.DocumentID()
+		r.DocumentID = &did
+	}
+	if bd, ok := d.(BoostedDocument); ok {
+		boost := bd.Boost()
+		r.Boost = &boost
+	}
+	if fd, ok := d.(FieldBoostedDocument); ok {
+		r.FieldBoosts = fd.FieldBoosts()
+	}
+	return r, nil
+}
+
+// walDocument is the replayed document of an index record with more than fields, it marshals as MapDocument
+type walDocument struct {
+	r walRecord
+}
+
+func (d *walDocument) IndexableFields() map[string][]string {
+	return d.r.Fields
+}
+
+func (d *walDocument) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.r.Fields)
+}
+
+func (d *walDocument) Boost() float32 {
+	if d.r.Boost == nil {
+		return 1
+	}
+	return *d.r.Boost
+}
+
+func (d *walDocument) FieldBoosts() map[string]float32 {
+	return d.r.FieldBoosts
+}
+
+// walDocumentWithID is walDocument of a DocumentWithID
+type walDocumentWithID struct {
+	walDocument
+}
+
+func (d *walDocumentWithID) DocumentID() int32 {
+	return *d.r.DocumentID
+}
+
+func (r walRecord) document() Document {
+	if r.DocumentID != nil {
+		return &walDocumentWithID{walDocument{r: r}}
+	}
+	if r.Boost != nil || len(r.FieldBoosts) > 0 {
+		return &walDocument{r: r}
+	}
+	return MapDocument(r.Fields)
+}
+
+const (
+	walIndex      = "index"
+	walDelete     = "delete"
+	walDeleteByID = "delete_id"
+)
+
+// OpenWAL opens (or creates) the log at fn for the index
+func OpenWAL(fn string, m *MemOnlyIndex) (*WAL, error) {
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &WAL{fn: fn, f: f, index: m}, nil
+}
+
+// Replay applies all the logged operations to the index, call it once after OpenWAL.
+// A last record that is not complete (the process crashed while writing it) was not applied to the index,
+// it is truncated from the log, so the following records are written after the last complete one
+func (w *WAL) Replay() error {
+	w.Lock()
+	defer w.Unlock()
+
+	f, err := os.Open(w.fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	lineNo := 0
+	offset := int64(0)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) == 0 {
+			return nil
+		}
+		lineNo++
+
+		var r walRecord
+		torn := line[len(line)-1] != '\n'
+		if !torn {
+			if jerr := json.Unmarshal(line, &r); jerr != nil {
+				if _, perr := br.Peek(1); perr != io.EOF {
+					return fmt.Errorf("line %d: %w", lineNo, jerr)
+				}
+				torn = true
+			}
+		}
+		if torn {
+			return w.f.Truncate(offset)
+		}
+		offset += int64(len(line))
+
+		switch r.Op {
+		case walIndex:
+			w.index.Index(r.document())
+		case walDelete:
+			w.index.Delete(r.DID)
+		case walDeleteByID:
+			w.index.DeleteByID(r.ID)
+		default:
+			return fmt.Errorf("line %d: unknown operation %q", lineNo, r.Op)
+		}
+	}
+}
+
+func (w *WAL) append(records ...walRecord) error {
+	buf := []byte{}
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, data...)
+		buf = append(buf, '\n')
+	}
+
+	_, err := w.f.Write(buf)
+	if err != nil {
+		return err
+	}
+	if w.Sync {
+		return w.f.Sync()
+	}
+	return nil
+}
+
+// Index logs and indexes the documents, the index is not changed if the log can not be written
+func (w *WAL) Index(docs ...Document) ([]int32, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	records := make([]walRecord, len(docs))
+	for i, d := range docs {
+		r, err := newWALIndexRecord(d)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = r
+	}
+	if err := w.append(records...); err != nil {
+		return nil, err
+	}
+	return w.index.Index(docs...), nil
+}
+
+// Delete logs and deletes the document
+func (w *WAL) Delete(did int32) error {
+	w.Lock()
+	defer w.Unlock()
+
+	if err := w.append(walRecord{Op: walDelete, DID: did}); err != nil {
+		return err
+	}
+	w.index.Delete(did)
+	return nil
+}
+
+// DeleteByID logs and deletes the document
+func (w *WAL) DeleteByID(uuid string) error {
+	w.Lock()
+	defer w.Unlock()
+
+	if err := w.append(walRecord{Op: walDeleteByID, ID: uuid}); err != nil {
+		return err
+	}
+	w.index.DeleteByID(uuid)
+	return nil
+}
+
+// Truncate empties the log, e.g. after the index was saved elsewhere, see Checkpoint
+func (w *WAL) Truncate() error {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.truncateLocked()
+}
+
+func (w *WAL) truncateLocked() error {
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+	if w.Sync {
+		return w.f.Sync()
+	}
+	return nil
+}
+
+// Checkpoint calls save (e.g. to write a snapshot of the index) while no operation is logged and truncates the log if it succeeds,
+// so replaying the log over the saved snapshot applies only the operations that came after it
+//
+// Example:
+//  err := wal.Checkpoint(func() error {
+//  	return saveSnapshot(m)
+//  })
+func (w *WAL) Checkpoint(save func() error) error {
+	w.Lock()
+	defer w.Unlock()
+
+	if err := save(); err != nil {
+		return err
+	}
+	return w.truncateLocked()
+}
+
+// Close the log file
+func (w *WAL) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.f.Close()
+}
@@ -0,0 +1,257 @@
+package index
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	iq "github.com/rekki/go-query"
+)
+
+func TestWAL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "cities.wal")
+
+	wal, err := OpenWAL(fn, NewMemOnlyIndex(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Replay(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = wal.Index(
+		&ExampleCity{TestID: "ams", Name: "Amsterdam", Country: "NL"},
+		&ExampleCity{TestID: "sof", Name: "Sofia", Country: "BG"},
+		&ExampleCity{TestID: "rot", Name: "Rotterdam", Country: "NL"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.DeleteByID("sof"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMemOnlyIndex(nil)
+	wal, err = OpenWAL(fn, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	if err := wal.Replay(); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	m.Foreach(m.MatchAll(), func(did int32, score float32, doc Document) {
+		if doc.IndexableFields()["name"][0] != "Rotterdam" {
+			t.Fatalf("unexpected document %v", doc)
+		}
+		n++
+	})
+	if n != 1 || m.GetByID("rot") == nil {
+		t.Fatalf("expected only rot, got %d", n)
+	}
+
+	// appending after replay keeps working
+	if _, err := wal.Index(&ExampleCity{TestID: "ein", Name: "Eindhoven", Country: "NL"}); err != nil {
+		t.Fatal(err)
+	}
+	n = 0
+	m.Foreach(iq.Or(m.Terms("country", "nl")...), func(did int32, score float32, doc Document) {
+		n++
+	})
+	if n != 2 {
+		t.Fatalf("expected 2 got %d", n)
+	}
+}
+
+func TestWALTornTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "cities.wal")
+
+	wal, err := OpenWAL(fn, NewMemOnlyIndex(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wal.Index(&ExampleCity{TestID: "ams", Name: "Amsterdam"}, &ExampleCity{TestID: "sof", Name: "Sofia"}); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	complete, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the process crashed in the middle of the next record
+	if err := ioutil.WriteFile(fn, append(complete, `{"op":"index","fields":{"name":["Rott`...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	replay := func() *MemOnlyIndex {
+		m := NewMemOnlyIndex(nil)
+		wal, err := OpenWAL(fn, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer wal.Close()
+		if err := wal.Replay(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wal.Index(&ExampleCity{TestID: "rot", Name: "Rotterdam"}); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	m := replay()
+	if m.GetByID("ams") == nil || m.GetByID("sof") == nil || m.GetByID("rot") == nil {
+		t.Fatalf("expected the complete records replayed")
+	}
+
+	// the log was truncated before the new record was appended, so it replays again
+	m = replay()
+	if top := m.TopN(0, iq.Or(m.Terms("name", "rotterdam")...), nil); top.Total != 2 || m.GetByID("sof") == nil {
+		t.Fatalf("expected the log to replay after the torn tail, got %d", top.Total)
+	}
+
+	// a broken record followed by others is an error
+	broken := append([]byte("{broken}\n"), complete...)
+	if err := ioutil.WriteFile(fn, broken, 0600); err != nil {
+		t.Fatal(err)
+	}
+	wal, err = OpenWAL(fn, NewMemOnlyIndex(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	if err := wal.Replay(); err == nil {
+		t.Fatalf("expected an error for the broken record")
+	}
+}
+
+func TestWALDocumentIDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "cities.wal")
+
+	open := func() (*WAL, *MemOnlyIndex) {
+		m := NewMemOnlyIndex(nil)
+		m.UseDocumentID = true
+		wal, err := OpenWAL(fn, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wal.Replay(); err != nil {
+			t.Fatal(err)
+		}
+		return wal, m
+	}
+
+	wal, _ := open()
+	_, err = wal.Index(
+		&ExampleCity{ID: 10, Name: "Amsterdam"},
+		&boostedCity{ExampleCity: ExampleCity{ID: 20, Name: "Amsterdam"}, boost: 2},
+		&fieldBoostedCity{ExampleCity: ExampleCity{ID: 30, Name: "Amsterdam", Country: "Amsterdam"}, boosts: map[string]float32{"country": 3}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Delete(10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wal.Index(&streamedDocument{name: "Sofia", body: "capital"}); !errors.Is(err, ErrWALReaderDocument) {
+		t.Fatalf("expected reader document error, got %v", err)
+	}
+	wal.Close()
+
+	wal, m := open()
+	defer wal.Close()
+	if m.Get(10) != nil || m.Get(20) == nil || m.Get(30) == nil {
+		t.Fatalf("expected the documents replayed with their ids")
+	}
+	scores := map[int32]float32{}
+	m.Foreach(iq.Or(m.Terms("name", "amsterdam")...), func(did int32, score float32, doc Document) {
+		scores[did] = score
+	})
+	if len(scores) != 2 || scores[20] != 2*scores[30] {
+		t.Fatalf("expected the boost replayed, got %v", scores)
+	}
+	scores = map[int32]float32{}
+	m.Foreach(iq.Or(m.Terms("country", "amsterdam")...), func(did int32, score float32, doc Document) {
+		scores[did] = score
+	})
+	if len(scores) != 1 || scores[30] <= 1 {
+		t.Fatalf("expected the field boost replayed, got %v", scores)
+	}
+}
+
+func TestWALCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "cities.wal")
+
+	wal, err := OpenWAL(fn, NewMemOnlyIndex(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	if _, err := wal.Index(&ExampleCity{TestID: "ams", Name: "Amsterdam"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wal.Checkpoint(func() error { return errors.New("disk full") }); err == nil {
+		t.Fatalf("expected the save error")
+	}
+	if data, _ := ioutil.ReadFile(fn); len(data) == 0 {
+		t.Fatalf("expected the log kept when the save fails")
+	}
+	if err := wal.Checkpoint(func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wal.Index(&ExampleCity{TestID: "sof", Name: "Sofia"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the operations after the checkpoint are replayed over the snapshot
+	snapshot := NewMemOnlyIndex(nil)
+	snapshot.Index(&ExampleCity{TestID: "ams", Name: "Amsterdam"})
+	replay, err := OpenWAL(fn, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	if err := replay.Replay(); err != nil {
+		t.Fatal(err)
+	}
+	if top := snapshot.TopN(0, snapshot.MatchAll(), nil); top.Total != 2 || snapshot.GetByID("sof") == nil {
+		t.Fatalf("expected ams and sof once, got %d", top.Total)
+	}
+
+	if err := wal.Truncate(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(fn); len(data) != 0 {
+		t.Fatalf("expected an empty log, got %q", data)
+	}
+}